@@ -3,6 +3,7 @@ package block
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
@@ -21,10 +22,26 @@ type Block struct {
 
 var blockchain []Block
 
+// Returned by AddMinedBlock when the block is already in the chain
+var ErrKnownBlock = errors.New("Block is already in the chain")
+
+// Returned by AddMinedBlock when the block doesn't extend the last block
+var ErrPrevHashMismatch = errors.New("Block previous hash doesn't match the last block hash")
+
 func GetBlockchain() []Block {
 	return blockchain
 }
 
+// Returns block with the given hash
+func GetBlockByHash(hash string) (Block, bool) {
+	for _, b := range blockchain {
+		if b.Hash == hash {
+			return b, true
+		}
+	}
+	return Block{}, false
+}
+
 // Sets new chain if old one is smaller
 func SetBlockchain(chain []Block) {
 	if len(chain) > len(blockchain) {
@@ -142,15 +159,49 @@ func GreateBlock(data string) Block {
 
 // Adds mined block to the chain
 func AddMinedBlock(data Block) error {
+	if len(blockchain) < 1 {
+		return fmt.Errorf("Can't add block to an empty chain")
+	}
 	lastBlock := blockchain[len(blockchain)-1]
 
+	if _, ok := GetBlockByHash(data.Hash); ok {
+		return ErrKnownBlock
+	}
+
 	_, err := IsBlockCorrect(data)
 
-	if err == nil && data.PrevHash == lastBlock.Hash {
-		blockchain = append(blockchain, data)
+	if err != nil {
+		return err
+	}
 
+	if data.PrevHash != lastBlock.Hash {
+		return ErrPrevHashMismatch
 	}
-	return err
+
+	blockchain = append(blockchain, data)
+	return nil
+}
+
+// Checks that every block in the chain is correct and linked to the previous one
+func IsChainValid(chain []Block) (bool, error) {
+	for i, b := range chain {
+		if _, err := IsBlockCorrect(b); err != nil {
+			return false, fmt.Errorf("Block %v is not correct: %w", i, err)
+		}
+
+		if b.Index != i {
+			return false, fmt.Errorf("Block %v has index %v", i, b.Index)
+		}
+
+		prevHash := ""
+		if i > 0 {
+			prevHash = chain[i-1].Hash
+		}
+		if b.PrevHash != prevHash {
+			return false, fmt.Errorf("Block %v: %w", i, ErrPrevHashMismatch)
+		}
+	}
+	return true, nil
 }
 
 // Number of leading zeroes required for the hash
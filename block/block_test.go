@@ -1,6 +1,7 @@
 package block
 
 import (
+	"errors"
 	"strings"
 	"testing"
 )
@@ -174,3 +175,58 @@ func TestMineBlockWrongNonce(t *testing.T) {
 		t.Errorf(`MineBlock() didn't return wrong nonce error %v`, err)
 	}
 }
+
+// Creates a correctly mined block on top of prev, or the genesis block if prev is nil
+func mineTestBlock(t *testing.T, prev *Block, data string) Block {
+	b := Block{Time: "2025-01-01T12:00:00Z", Data: data}
+	if prev != nil {
+		b.Index = prev.Index + 1
+		b.PrevHash = prev.Hash
+	}
+	var err error
+	b.Hash, b.Nonce, err = MineBlock(b)
+	if err != nil {
+		t.Fatalf("MineBlock() returned an error: %v", err)
+	}
+	return b
+}
+
+// Calls block.IsChainValid with a linked chain, checking for a valid return value
+func TestIsChainValid(t *testing.T) {
+	genesis := mineTestBlock(t, nil, "Genesis")
+	next := mineTestBlock(t, &genesis, "Next")
+
+	if _, err := IsChainValid([]Block{genesis, next}); err != nil {
+		t.Errorf("IsChainValid() returned an error: %v", err)
+	}
+}
+
+// Calls block.IsChainValid with blocks in wrong order, checking if there is error message
+func TestIsChainValidBadLinkage(t *testing.T) {
+	genesis := mineTestBlock(t, nil, "Genesis")
+	next := mineTestBlock(t, &genesis, "Next")
+	next.Index = 0
+
+	if _, err := IsChainValid([]Block{next, genesis}); err == nil {
+		t.Error("IsChainValid() didn't return an error for wrong linkage")
+	}
+}
+
+// Calls block.AddMinedBlock with known and unlinked blocks, checking the returned errors
+func TestAddMinedBlockErrors(t *testing.T) {
+	genesis := mineTestBlock(t, nil, "Genesis")
+	next := mineTestBlock(t, &genesis, "Next")
+	unlinked := mineTestBlock(t, &next, "Unlinked")
+	blockchain = []Block{genesis}
+	defer func() { blockchain = nil }()
+
+	if err := AddMinedBlock(genesis); !errors.Is(err, ErrKnownBlock) {
+		t.Errorf("AddMinedBlock() with known block = %v, want %v", err, ErrKnownBlock)
+	}
+	if err := AddMinedBlock(unlinked); !errors.Is(err, ErrPrevHashMismatch) {
+		t.Errorf("AddMinedBlock() with unlinked block = %v, want %v", err, ErrPrevHashMismatch)
+	}
+	if err := AddMinedBlock(next); err != nil {
+		t.Errorf("AddMinedBlock() returned an error: %v", err)
+	}
+}
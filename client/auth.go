@@ -0,0 +1,57 @@
+package client
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Header carrying a static API key
+const APIKeyHeader = "X-API-Key"
+
+// Authorization scheme of HMAC signed requests
+const HMACScheme = "GoChain-HMAC-SHA256"
+
+// Returns hex HMAC-SHA256 of the request with the secret.
+// The signed string is the method, request URI, Unix timestamp, nonce and hex SHA-256 of the body, one per line.
+func HMACSignature(secret []byte, method string, uri string, timestamp int64, nonce string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%v\n%v\n%v\n%v\n%x", method, uri, timestamp, nonce, bodyHash)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Returns PrepareRequest function setting the API key header
+func APIKey(key string) func(req *http.Request) {
+	return func(req *http.Request) {
+		req.Header.Set(APIKeyHeader, key)
+	}
+}
+
+// Returns PrepareRequest function signing requests with the HMAC key.
+// Every request gets a random nonce, so the node accepts each signature once.
+func SignHMAC(keyID string, secret []byte) func(req *http.Request) {
+	return func(req *http.Request) {
+		var body []byte
+		if req.GetBody != nil {
+			if reader, err := req.GetBody(); err == nil {
+				body, _ = io.ReadAll(reader)
+			}
+		} else if req.Body != nil {
+			body, _ = io.ReadAll(req.Body)
+			req.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		timestamp := time.Now().Unix()
+		nonce := rand.Text()
+		signature := HMACSignature(secret, req.Method, req.URL.RequestURI(), timestamp, nonce, body)
+		req.Header.Set("Authorization", HMACScheme+" KeyId="+keyID+", Timestamp="+strconv.FormatInt(timestamp, 10)+", Nonce="+nonce+", Signature="+signature)
+	}
+}
@@ -0,0 +1,304 @@
+// Package client calls the HTTP API of a GoChain node.
+package client
+
+import (
+	"GoChain/block"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default settings of a client
+const (
+	defaultRetries      = 2
+	defaultRetryBackoff = 200 * time.Millisecond
+)
+
+// Returned when the requested block doesn't exist or the chain is empty
+var ErrNotFound = errors.New("Not found")
+
+// Sends HTTP requests, implemented by *http.Client and the node's peer client
+type Transport interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Settings of a client
+type Config struct {
+	// Sends the requests, http.DefaultClient if nil
+	Transport Transport
+	// Attempts after the first one for reads failing with network errors, 429 or 5xx.
+	// Negative disables retries, zero uses the default.
+	Retries int
+	// Wait before the first retry, doubled on every attempt
+	RetryBackoff time.Duration
+	// Called on every request before it is sent, e.g. to set headers
+	PrepareRequest func(req *http.Request)
+}
+
+// Error response of the node
+type APIError struct {
+	StatusCode int
+	Message    string
+
+	// Wait requested by a rate limited response
+	retryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("Unexpected response: %v, %v", e.StatusCode, e.Message)
+}
+
+// Makes errors.Is(err, ErrNotFound) true for 404 responses
+func (e *APIError) Is(target error) bool {
+	return target == ErrNotFound && e.StatusCode == http.StatusNotFound
+}
+
+// Client of a node API
+type Client struct {
+	baseURL string
+	config  Config
+}
+
+// Creates client for the node at baseURL, like http://node1:8001
+func New(baseURL string, config Config) *Client {
+	if config.Transport == nil {
+		config.Transport = http.DefaultClient
+	}
+	switch {
+	case config.Retries == 0:
+		config.Retries = defaultRetries
+	case config.Retries < 0:
+		config.Retries = 0
+	}
+	if config.RetryBackoff <= 0 {
+		config.RetryBackoff = defaultRetryBackoff
+	}
+	return &Client{baseURL: strings.TrimSuffix(baseURL, "/"), config: config}
+}
+
+// Peer known to the node
+type Peer struct {
+	Address         string    `json:"address"`
+	NodeID          string    `json:"nodeId"`
+	FirstSeen       time.Time `json:"firstSeen"`
+	LastSeen        time.Time `json:"lastSeen"`
+	LastSuccess     time.Time `json:"lastSuccess,omitzero"`
+	Failures        int       `json:"failures"`
+	LatencyMs       int64     `json:"latencyMs"`
+	Height          int       `json:"height"`
+	ProtocolVersion int       `json:"protocolVersion"`
+	Capabilities    []string  `json:"capabilities"`
+	WireAddress     string    `json:"wireAddress,omitempty"`
+	State           string    `json:"state"`
+	Incarnation     uint64    `json:"incarnation"`
+	Outbound        bool      `json:"outbound"`
+	Score           float64   `json:"score"`
+	ScoreUpdated    time.Time `json:"scoreUpdated,omitzero"`
+}
+
+// Identity, version and chain, sync and mining state of the node
+type Status struct {
+	NodeID          string     `json:"nodeId"`
+	Address         string     `json:"address"`
+	Version         string     `json:"version"`
+	UptimeSeconds   int64      `json:"uptimeSeconds"`
+	ChainID         string     `json:"chainId"`
+	Height          int        `json:"height"`
+	Tip             string     `json:"tip"`
+	Sync            SyncStatus `json:"sync"`
+	Peers           int        `json:"peers"`
+	Mining          string     `json:"mining"`
+	ProtocolVersion int        `json:"protocolVersion"`
+	Capabilities    []string   `json:"capabilities"`
+}
+
+// Sync state of the node compared with the median height of its peers
+type SyncStatus struct {
+	State          string `json:"state"`
+	BestPeerHeight int    `json:"bestPeerHeight"`
+}
+
+// Request or response body wrapping its payload in data
+type dataBody[T any] struct {
+	Data T `json:"data"`
+}
+
+// Body of error responses
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Returns the last block of the chain
+func (c *Client) Tip(ctx context.Context) (block.Block, error) {
+	data, err := get[dataBody[block.Block]](ctx, c, "/tip")
+	return data.Data, err
+}
+
+// Returns block with the hash
+func (c *Client) Block(ctx context.Context, hash string) (block.Block, error) {
+	data, err := get[dataBody[block.Block]](ctx, c, "/blocks/"+url.PathEscape(hash))
+	return data.Data, err
+}
+
+// Returns block at the index
+func (c *Client) BlockByIndex(ctx context.Context, index int) (block.Block, error) {
+	data, err := get[dataBody[block.Block]](ctx, c, "/blocks/by-index/"+strconv.Itoa(index))
+	return data.Data, err
+}
+
+// Returns the entire chain
+func (c *Client) Blocks(ctx context.Context) ([]block.Block, error) {
+	data, err := get[dataBody[[]block.Block]](ctx, c, "/chain")
+	return data.Data, err
+}
+
+// Returns peers known to the node
+func (c *Client) Peers(ctx context.Context) ([]Peer, error) {
+	data, err := get[dataBody[[]Peer]](ctx, c, "/nodes")
+	return data.Data, err
+}
+
+// Returns identity and chain state of the node
+func (c *Client) Status(ctx context.Context) (Status, error) {
+	return get[Status](ctx, c, "/status")
+}
+
+// Mines block with the data on the node and returns it.
+// Mining is not repeated on failure, so the request is never retried.
+func (c *Client) Submit(ctx context.Context, data string) (block.Block, error) {
+	body, err := json.Marshal(dataBody[string]{Data: data})
+	if err != nil {
+		return block.Block{}, fmt.Errorf("encode json: %w", err)
+	}
+
+	resp, err := c.do(ctx, "POST", "/add", body, false)
+	if err != nil {
+		return block.Block{}, err
+	}
+	result, err := decode[dataBody[block.Block]](resp)
+	return result.Data, err
+}
+
+// Sends GET request to the path and decodes the response
+func get[T any](ctx context.Context, c *Client, path string) (T, error) {
+	resp, err := c.do(ctx, "GET", path, nil, true)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return decode[T](resp)
+}
+
+// Decodes JSON response body
+func decode[T any](resp *http.Response) (T, error) {
+	defer resp.Body.Close()
+	var v T
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		return v, fmt.Errorf("decode json: %w", err)
+	}
+	return v, nil
+}
+
+// Sends request, retrying if allowed, and returns a successful response.
+// Error responses are returned as *APIError.
+func (c *Client) do(ctx context.Context, method string, path string, body []byte, retry bool) (*http.Response, error) {
+	attempts := 1
+	if retry {
+		attempts += c.config.Retries
+	}
+
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			if waitErr := c.wait(ctx, attempt, err); waitErr != nil {
+				return nil, waitErr
+			}
+		}
+
+		var resp *http.Response
+		resp, err = c.send(ctx, method, path, body)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			continue
+		}
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return resp, nil
+		}
+
+		err = apiError(resp)
+		if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+// Sends one request
+func (c *Client) send(ctx context.Context, method string, path string, body []byte) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create request for %v: %w", c.baseURL, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.config.PrepareRequest != nil {
+		c.config.PrepareRequest(req)
+	}
+
+	resp, err := c.config.Transport.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Error connecting to host: %v, %w", c.baseURL, err)
+	}
+	return resp, nil
+}
+
+// Waits before the retry, honouring Retry-After of rate limited responses
+func (c *Client) wait(ctx context.Context, attempt int, err error) error {
+	delay := c.config.RetryBackoff << (attempt - 1)
+	delay += rand.N(delay/2 + 1)
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.retryAfter > 0 {
+		delay = apiErr.retryAfter
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Reads error response into *APIError
+func apiError(resp *http.Response) *APIError {
+	defer resp.Body.Close()
+
+	err := &APIError{StatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+	var data errorResponse
+	if json.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&data) == nil && data.Error != "" {
+		err.Message = data.Error
+	}
+	if seconds, parseErr := strconv.Atoi(resp.Header.Get("Retry-After")); parseErr == nil {
+		err.retryAfter = time.Duration(seconds) * time.Second
+	}
+	return err
+}
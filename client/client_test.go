@@ -0,0 +1,227 @@
+package client
+
+import (
+	"GoChain/block"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Creates client of the test server with short retry backoff
+func newTestClient(url string) *Client {
+	return New(url, Config{Retries: 2, RetryBackoff: time.Millisecond})
+}
+
+// Calls Tip on a node failing twice with 503, checking that the third attempt is returned
+func TestTipRetries(t *testing.T) {
+	var calls atomic.Int32
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"data": {"Index": 4, "Hash": "tip"}}`)
+	}))
+	defer node.Close()
+
+	tip, err := newTestClient(node.URL).Tip(context.Background())
+
+	if err != nil || tip.Hash != "tip" || calls.Load() != 3 {
+		t.Errorf("Tip() = %+v, %v after %v calls, want tip after 3 calls", tip, err, calls.Load())
+	}
+}
+
+// Calls Block for a missing block, checking that the error matches ErrNotFound and carries the message
+func TestBlockNotFound(t *testing.T) {
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"error": "Block not found: abc"}`)
+	}))
+	defer node.Close()
+
+	_, err := newTestClient(node.URL).Block(context.Background(), "abc")
+
+	var apiErr *APIError
+	if !errors.Is(err, ErrNotFound) || !errors.As(err, &apiErr) || apiErr.Message != "Block not found: abc" {
+		t.Errorf("Block() returned %v, want not found API error", err)
+	}
+}
+
+// Calls Submit on a failing node, checking that mining is not requested twice
+func TestSubmitNotRetried(t *testing.T) {
+	var calls atomic.Int32
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer node.Close()
+
+	if _, err := newTestClient(node.URL).Submit(context.Background(), "data"); err == nil || calls.Load() != 1 {
+		t.Errorf("Submit() returned %v after %v calls, want error after 1 call", err, calls.Load())
+	}
+}
+
+// Cancels the context while the client waits to retry, checking that it returns right away
+func TestRetryCancelled(t *testing.T) {
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer node.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+
+	_, err := newTestClient(node.URL).Blocks(ctx)
+
+	if !errors.Is(err, context.DeadlineExceeded) || time.Since(start) > time.Second {
+		t.Errorf("Blocks() returned %v after %v, want deadline exceeded", err, time.Since(start))
+	}
+}
+
+// Sends requests through a custom transport, checking that it and the request hook are used
+func TestCustomTransport(t *testing.T) {
+	var header string
+	transport := transportFunc(func(req *http.Request) (*http.Response, error) {
+		header = req.Header.Get("Node-ID")
+		rec := httptest.NewRecorder()
+		fmt.Fprint(rec, `{"data": [{"address": "node2:8002", "nodeId": "id2"}]}`)
+		return rec.Result(), nil
+	})
+	c := New("http://node1:8001", Config{
+		Transport:      transport,
+		PrepareRequest: func(req *http.Request) { req.Header.Set("Node-ID", "id1") },
+	})
+
+	peers, err := c.Peers(context.Background())
+
+	if err != nil || len(peers) != 1 || peers[0].NodeID != "id2" || header != "id1" {
+		t.Errorf("Peers() = %+v, %v with Node-ID %q, want node2 with Node-ID id1", peers, err, header)
+	}
+}
+
+// Transport calling a function
+type transportFunc func(req *http.Request) (*http.Response, error)
+
+func (f transportFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Drops the first event stream after one tip, checking that the subscription resumes after it
+func TestSubscribeResumes(t *testing.T) {
+	var since atomic.Value
+	var calls atomic.Int32
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		if calls.Add(1) == 1 {
+			fmt.Fprint(w, ": keepalive\n\nid: 1\nevent: new-tip\ndata: {\"type\": \"new-tip\", \"height\": 1, \"data\": {\"Index\": 1}}\n\n")
+			return
+		}
+		since.Store(r.URL.Query().Get("since"))
+		fmt.Fprint(w, "id: 2\nevent: new-tip\ndata: {\"type\": \"new-tip\", \"height\": 2, \"data\": {\"Index\": 2}}\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer node.Close()
+
+	sub, err := newTestClient(node.URL).Subscribe(context.Background(), []string{EventNewTip}, 0)
+	if err != nil {
+		t.Fatalf("Subscribe() returned an error: %v", err)
+	}
+	defer sub.Close()
+
+	for want := 1; want <= 2; want++ {
+		select {
+		case event := <-sub.Events():
+			if b, err := event.Block(); err != nil || b.Index != want {
+				t.Errorf("Event %v = %+v, %v, want block %v", want, b, err, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Event %v not received", want)
+		}
+	}
+	if since.Load() != "1" {
+		t.Errorf("Resumed with since=%v, want 1", since.Load())
+	}
+}
+
+// Announces the block on a later tip, checking that WaitForInclusion returns it
+// once it has the requested confirmations
+func TestWaitForInclusion(t *testing.T) {
+	var height atomic.Int32
+	tips := make(chan struct{})
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/events":
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.(http.Flusher).Flush()
+			for range tips {
+				fmt.Fprintf(w, "event: new-tip\ndata: {\"type\": \"new-tip\", \"height\": %d}\n\n", height.Load())
+				w.(http.Flusher).Flush()
+			}
+		case r.URL.Path == "/tip":
+			fmt.Fprintf(w, `{"data": {"Index": %d}}`, height.Load())
+		case strings.HasPrefix(r.URL.Path, "/blocks/") && height.Load() >= 2:
+			fmt.Fprint(w, `{"data": {"Index": 2, "Hash": "wanted"}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error": "Block not found"}`)
+		}
+	}))
+	defer node.Close()
+	defer close(tips)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	result := make(chan block.Block, 1)
+	go func() {
+		b, err := newTestClient(node.URL).WaitForInclusion(ctx, "wanted", 1)
+		if err != nil {
+			t.Errorf("WaitForInclusion() returned an error: %v", err)
+		}
+		result <- b
+	}()
+
+	for h := int32(1); h <= 3; h++ {
+		height.Store(h)
+		tips <- struct{}{}
+	}
+
+	if b := <-result; b.Hash != "wanted" {
+		t.Errorf("WaitForInclusion() = %+v, want block wanted", b)
+	}
+}
+
+// Submits data with an HMAC signing client, checking the signature received by the node
+func TestSignHMAC(t *testing.T) {
+	secret := []byte("secret")
+	var header, want string
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get("Authorization")
+		body, _ := io.ReadAll(r.Body)
+		timestamp := header[strings.Index(header, "Timestamp=")+len("Timestamp=") : strings.Index(header, ", Nonce")]
+		nonce := header[strings.Index(header, "Nonce=")+len("Nonce=") : strings.Index(header, ", Signature")]
+		unix, _ := strconv.ParseInt(timestamp, 10, 64)
+		want = HMACSignature(secret, r.Method, r.URL.RequestURI(), unix, nonce, body)
+		fmt.Fprint(w, `{"data": {"Data": "signed"}}`)
+	}))
+	defer node.Close()
+
+	c := New(node.URL, Config{PrepareRequest: SignHMAC("ingest", secret)})
+	if _, err := c.Submit(context.Background(), "signed"); err != nil {
+		t.Fatalf("Submit() returned an error: %v", err)
+	}
+
+	if !strings.HasPrefix(header, HMACScheme+" KeyId=ingest, ") || !strings.HasSuffix(header, "Signature="+want) {
+		t.Errorf("Authorization = %q, want signature %v", header, want)
+	}
+}
@@ -0,0 +1,239 @@
+package client
+
+import (
+	"GoChain/block"
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of events streamed by the node
+const (
+	EventNewTip       = "new-tip"
+	EventReorg        = "reorg"
+	EventMempoolEntry = "mempool-entry"
+	EventPeerJoin     = "peer-join"
+	EventPeerLeave    = "peer-leave"
+)
+
+// Event streamed by the node.
+// Data holds the block of new-tip events and the details of the other kinds.
+type Event struct {
+	Type   string          `json:"type"`
+	Height int             `json:"height"`
+	Time   time.Time       `json:"time"`
+	Data   json.RawMessage `json:"data"`
+}
+
+// Returns block of a new-tip event
+func (e Event) Block() (block.Block, error) {
+	var b block.Block
+	if e.Type != EventNewTip {
+		return b, fmt.Errorf("Event %v doesn't carry a block", e.Type)
+	}
+	if err := json.Unmarshal(e.Data, &b); err != nil {
+		return b, fmt.Errorf("decode json: %w", err)
+	}
+	return b, nil
+}
+
+// Stream of node events.
+// Dropped connections are resumed after the last received tip.
+type Subscription struct {
+	events chan Event
+	// Context of the caller, the stream itself is also cancelled by Close
+	parent context.Context
+	cancel context.CancelFunc
+
+	mu  sync.Mutex
+	err error
+}
+
+// Returns channel of events, closed when the subscription ends
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Returns the reason the subscription ended, nil if it was closed
+func (s *Subscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.err
+}
+
+// Ends the subscription
+func (s *Subscription) Close() {
+	s.cancel()
+}
+
+// Subscribes to events of the types, all types if empty.
+// With since of zero or more, blocks above that height are replayed first.
+func (c *Client) Subscribe(parent context.Context, types []string, since int) (*Subscription, error) {
+	ctx, cancel := context.WithCancel(parent)
+
+	resp, err := c.openEvents(ctx, types, since)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	s := &Subscription{events: make(chan Event), parent: parent, cancel: cancel}
+	go s.run(ctx, c, resp, types, since)
+	return s, nil
+}
+
+// Opens GET /events stream
+func (c *Client) openEvents(ctx context.Context, types []string, since int) (*http.Response, error) {
+	query := url.Values{}
+	if len(types) > 0 {
+		query.Set("types", strings.Join(types, ","))
+	}
+	if since >= 0 {
+		query.Set("since", strconv.Itoa(since))
+	}
+
+	path := "/events"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	return c.do(ctx, "GET", path, nil, true)
+}
+
+// Reads events until the context is done, reconnecting when the stream drops
+func (s *Subscription) run(ctx context.Context, c *Client, resp *http.Response, types []string, since int) {
+	defer close(s.events)
+
+	failures := 0
+	for {
+		received, err := s.read(ctx, resp, &since)
+		if ctx.Err() != nil {
+			s.finish(s.parent.Err())
+			return
+		}
+
+		if received {
+			failures = 0
+		}
+		for {
+			failures++
+			if failures > c.config.Retries+1 {
+				s.finish(fmt.Errorf("Event stream from %v ended: %w", c.baseURL, err))
+				return
+			}
+			if waitErr := c.wait(ctx, failures, err); waitErr != nil {
+				s.finish(s.parent.Err())
+				return
+			}
+			if resp, err = c.openEvents(ctx, types, since); err == nil {
+				break
+			}
+		}
+	}
+}
+
+// Reads events of one connection, moving since past received tips.
+// Returns whether any event was received.
+func (s *Subscription) read(ctx context.Context, resp *http.Response, since *int) (bool, error) {
+	defer resp.Body.Close()
+
+	received := false
+	var eventType string
+	var data strings.Builder
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if data.Len() == 0 {
+				continue
+			}
+			var event Event
+			if err := json.Unmarshal([]byte(data.String()), &event); err != nil {
+				return received, fmt.Errorf("decode json: %w", err)
+			}
+			if event.Type == "" {
+				event.Type = eventType
+			}
+			eventType = ""
+			data.Reset()
+
+			select {
+			case s.events <- event:
+			case <-ctx.Done():
+				return received, ctx.Err()
+			}
+			received = true
+			if event.Type == EventNewTip && event.Height > *since {
+				*since = event.Height
+			}
+		case strings.HasPrefix(line, ":"):
+			// Keepalive comment
+		case strings.HasPrefix(line, "event:"):
+			eventType = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return received, err
+	}
+	return received, errors.New("Stream closed by the node")
+}
+
+// Records why the subscription ended
+func (s *Subscription) finish(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.err = err
+}
+
+// Waits until the block with the hash is in the chain with at least the given number
+// of blocks on top of it, and returns it. Tips and reorgs trigger a new check.
+func (c *Client) WaitForInclusion(ctx context.Context, hash string, confirmations int) (block.Block, error) {
+	// Subscribe before the first check so no tip is missed in between
+	sub, err := c.Subscribe(ctx, []string{EventNewTip, EventReorg}, -1)
+	if err != nil {
+		return block.Block{}, err
+	}
+	defer sub.Close()
+
+	for {
+		b, err := c.Block(ctx, hash)
+		switch {
+		case err == nil:
+			tip, err := c.Tip(ctx)
+			if err != nil {
+				return block.Block{}, err
+			}
+			if tip.Index-b.Index >= confirmations {
+				return b, nil
+			}
+		case !errors.Is(err, ErrNotFound):
+			return block.Block{}, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return block.Block{}, ctx.Err()
+		case _, ok := <-sub.Events():
+			if !ok {
+				if err := sub.Err(); err != nil {
+					return block.Block{}, err
+				}
+				return block.Block{}, ctx.Err()
+			}
+		}
+	}
+}
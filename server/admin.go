@@ -0,0 +1,318 @@
+package server
+
+import (
+	"GoChain/block"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// Default admin listener address, overridable with ADMIN_ADDR.
+// The listener only starts when ADMIN_TOKEN is set.
+const defaultAdminAddr = "127.0.0.1:8101"
+
+// Returned by node operations that mine while mining is paused
+var ErrMiningPaused = errors.New("Mining is paused")
+
+// Set while mining is paused by the operator
+var miningPaused atomic.Bool
+
+// Peer database of the node, replaced in Run
+var peerDB = NewPeerDB(defaultPeerDBPath, defaultPeerDBMaxAge)
+
+// Checks that the admin listener address is on the loopback interface
+func checkAdminAddr(address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("Invalid admin address %q: %w", address, err)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("Admin address %q is not a loopback address", address)
+	}
+	return nil
+}
+
+// Allows requests with the bearer token in the Authorization header
+func requireToken(logger *slog.Logger, token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+				logger.Warn("Rejected admin request without valid token", "remote", r.RemoteAddr, "route", r.Method+" "+r.URL.Path)
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				_ = encode(w, r, http.StatusUnauthorized, ErrorData{Error: "Missing or invalid admin token"})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Returns routes of the admin API
+func adminRoutes(logger *slog.Logger) []Route {
+	miningResponses := map[int]any{http.StatusOK: MiningStateData{}}
+
+	routes := []Route{
+		{
+			Method: "GET", Path: "/admin/peers", Class: routeAdmin, Summary: "Lists peers with scores and active bans",
+			Handler:   handleAdminPeers(logger),
+			Responses: map[int]any{http.StatusOK: AdminPeersData{}},
+		},
+		{
+			Method: "POST", Path: "/admin/peers", Class: routeAdmin, Summary: "Connects to node and adds it to peers",
+			Handler:   handleAdminAddPeer(logger),
+			Request:   AdminPeerRequestData{},
+			Responses: map[int]any{http.StatusOK: AdminPeersData{}, http.StatusBadRequest: ErrorData{}, http.StatusBadGateway: ErrorData{}},
+		},
+		{
+			Method: "DELETE", Path: "/admin/peers/{address}", Class: routeAdmin, Summary: "Removes peer and forgets its address",
+			Handler:   handleAdminRemovePeer(logger),
+			Responses: map[int]any{http.StatusOK: AdminPeersData{}, http.StatusNotFound: ErrorData{}},
+		},
+		{
+			Method: "POST", Path: "/admin/ban", Class: routeAdmin, Summary: "Bans node",
+			Handler:   handleAdminBan(logger),
+			Request:   BanRequestData{},
+			Responses: map[int]any{http.StatusOK: AdminPeersData{}, http.StatusBadRequest: ErrorData{}},
+		},
+		{
+			Method: "POST", Path: "/admin/unban", Class: routeAdmin, Summary: "Removes ban of node",
+			Handler:   handleAdminUnban(logger),
+			Request:   UnbanRequestData{},
+			Responses: map[int]any{http.StatusOK: AdminPeersData{}, http.StatusBadRequest: ErrorData{}, http.StatusNotFound: ErrorData{}},
+		},
+		{
+			Method: "POST", Path: "/admin/mining/pause", Class: routeAdmin, Summary: "Pauses mining, submitted data is refused",
+			Handler:   handleAdminMining(logger, true),
+			Responses: miningResponses,
+		},
+		{
+			Method: "POST", Path: "/admin/mining/resume", Class: routeAdmin, Summary: "Resumes mining",
+			Handler:   handleAdminMining(logger, false),
+			Responses: miningResponses,
+		},
+		{
+			Method: "POST", Path: "/admin/resync", Class: routeAdmin, Summary: "Syncs peers and chain from node",
+			Handler:   handleAdminResync(logger),
+			Request:   AdminPeerRequestData{},
+			Responses: map[int]any{http.StatusOK: NodeStatusData{}, http.StatusBadRequest: ErrorData{}, http.StatusBadGateway: ErrorData{}},
+		},
+		{
+			Method: "POST", Path: "/admin/compact", Class: routeAdmin, Summary: "Rewrites peer database with current peers and bans only",
+			Handler:   handleAdminCompact(logger),
+			Responses: map[int]any{http.StatusOK: CompactData{}, http.StatusInternalServerError: ErrorData{}},
+		},
+		{
+			Method: "GET", Path: "/admin/log-levels", Class: routeAdmin, Summary: "Lists log level of each component",
+			Handler:   handleGetLogLevels(logger),
+			Responses: map[int]any{http.StatusOK: LogLevelsData{}},
+		},
+		{
+			Method: "POST", Path: "/admin/log-levels", Class: routeAdmin, Summary: "Changes log levels of components",
+			Handler:   handleSetLogLevels(logger),
+			Request:   LogLevelsData{},
+			Responses: map[int]any{http.StatusOK: LogLevelsData{}, http.StatusBadRequest: ErrorData{}},
+		},
+		{
+			Method: "GET", Path: "/admin/state", Class: routeAdmin, Summary: "Dumps node state",
+			Handler:   handleAdminState(logger),
+			Responses: map[int]any{http.StatusOK: StateDumpData{}},
+		},
+		{
+			Method: "GET", Path: "/admin/openapi.json", Class: routeAdmin, Summary: "Returns this OpenAPI document",
+			Responses: map[int]any{http.StatusOK: map[string]any{}},
+		},
+	}
+
+	for i := range routes {
+		if routes[i].Path == "/admin/openapi.json" {
+			routes[i].Handler = handleOpenAPI(logger, routes)
+		}
+	}
+	return routes
+}
+
+// Creates handler of the admin listener.
+// Every route needs a request from localhost with the bearer token.
+func NewAdminServer(logger *slog.Logger, token string) http.Handler {
+	mux := http.NewServeMux()
+	for _, route := range adminRoutes(logger) {
+		mux.Handle(route.Method+" "+route.Path, observeRoute(route)(requireLocalhost(logger)(requireToken(logger, token)(route.Handler))))
+	}
+	return mux
+}
+
+// Defines the JSON body for POST /admin/peers and POST /admin/resync requests
+type AdminPeerRequestData struct {
+	Address string `json:"address"`
+}
+
+// Connects to the node and adds it to peers.
+// Route: POST /admin/peers
+func handleAdminAddPeer(logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Info("Request", "route", "POST /admin/peers")
+
+			data, err := decode[AdminPeerRequestData](r)
+			if err != nil || validateNodeAddr(data.Address) != nil {
+				_ = encode(w, r, http.StatusBadRequest, ErrorData{Error: "Invalid request body"})
+				return
+			}
+
+			if err := connectPeer(data.Address); err != nil {
+				_ = encode(w, r, http.StatusBadGateway, ErrorData{Error: err.Error()})
+				return
+			}
+			addressBook.Remove(data.Address)
+
+			logger.Info("Peer added by operator", "peer", data.Address)
+			_ = encode(w, r, http.StatusOK, AdminPeersData{Peers: peers.List(), Bans: banList.List()})
+		},
+	)
+}
+
+// Removes peer, drops its queued messages and forgets its address.
+// The peer may come back through peer exchange unless it is banned.
+// Route: DELETE /admin/peers/{address}
+func handleAdminRemovePeer(logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Info("Request", "route", "DELETE /admin/peers/{address}")
+
+			address := r.PathValue("address")
+			if !peers.Contains(address) {
+				_ = encode(w, r, http.StatusNotFound, ErrorData{Error: "Node is not a peer"})
+				return
+			}
+
+			peers.Remove(address)
+			addressBook.Remove(address)
+			gossiper.outbox.Drop(address)
+
+			logger.Info("Peer removed by operator", "peer", address)
+			_ = encode(w, r, http.StatusOK, AdminPeersData{Peers: peers.List(), Bans: banList.List()})
+		},
+	)
+}
+
+// Defines the JSON body for POST /admin/mining/pause and POST /admin/mining/resume responses
+type MiningStateData struct {
+	Mining string `json:"mining"`
+}
+
+// Pauses or resumes mining. Blocks being mined are finished.
+// Route: POST /admin/mining/pause and POST /admin/mining/resume
+func handleAdminMining(logger *slog.Logger, pause bool) http.Handler {
+	route := "POST /admin/mining/resume"
+	if pause {
+		route = "POST /admin/mining/pause"
+	}
+
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Info("Request", "route", route)
+
+			if miningPaused.Swap(pause) != pause {
+				logger.Info("Mining state changed by operator", "paused", pause)
+			}
+			_ = encode(w, r, http.StatusOK, MiningStateData{Mining: miningState()})
+		},
+	)
+}
+
+// Syncs peers and chain from the node, replacing the chain if the node has a longer valid one.
+// Route: POST /admin/resync
+func handleAdminResync(logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Info("Request", "route", "POST /admin/resync")
+
+			data, err := decode[AdminPeerRequestData](r)
+			if err != nil || validateNodeAddr(data.Address) != nil {
+				_ = encode(w, r, http.StatusBadRequest, ErrorData{Error: "Invalid request body"})
+				return
+			}
+
+			if err := syncNode(r.Context(), data.Address); err != nil {
+				_ = encode(w, r, http.StatusBadGateway, ErrorData{Error: err.Error()})
+				return
+			}
+
+			logger.Info("Resynced by operator", "peer", data.Address, "height", len(block.GetBlockchain()))
+			_ = encode(w, r, http.StatusOK, nodeStatus())
+		},
+	)
+}
+
+// Defines the JSON body for POST /admin/compact response
+type CompactData struct {
+	Removed int `json:"removed"`
+	Peers   int `json:"peers"`
+}
+
+// Rewrites the peer database keeping only current peers and active bans.
+// Route: POST /admin/compact
+func handleAdminCompact(logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Info("Request", "route", "POST /admin/compact")
+
+			current := peers.List()
+			removed, err := peerDB.Compact(current, banList.List())
+			if err != nil {
+				logger.Error("Failed to compact peer database", "err", err)
+				_ = encode(w, r, http.StatusInternalServerError, ErrorData{Error: err.Error()})
+				return
+			}
+
+			logger.Info("Peer database compacted", "removed", removed)
+			_ = encode(w, r, http.StatusOK, CompactData{Removed: removed, Peers: len(current)})
+		},
+	)
+}
+
+// Defines the JSON body for GET /admin/state response
+type StateDumpData struct {
+	Status      NodeStatusData    `json:"status"`
+	Peers       []Peer            `json:"peers"`
+	Bans        []Ban             `json:"bans"`
+	AddressBook int               `json:"addressBook"`
+	Outbox      OutboxStateData   `json:"outbox"`
+	LogLevels   map[string]string `json:"logLevels"`
+	Chain       []block.Block     `json:"chain"`
+}
+
+// Defines outbound queue state in the GET /admin/state response
+type OutboxStateData struct {
+	Pending int    `json:"pending"`
+	Dropped uint64 `json:"dropped"`
+}
+
+// Returns status, peers, bans, queues, log levels and the chain of the node.
+// Route: GET /admin/state
+func handleAdminState(logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Info("Request", "route", "GET /admin/state")
+
+			_ = encode(w, r, http.StatusOK, StateDumpData{
+				Status:      nodeStatus(),
+				Peers:       peers.List(),
+				Bans:        banList.List(),
+				AddressBook: addressBook.Len(),
+				Outbox:      OutboxStateData{Pending: gossiper.outbox.Pending(), Dropped: gossiper.outbox.Dropped()},
+				LogLevels:   logLevels.List(),
+				Chain:       block.GetBlockchain(),
+			})
+		},
+	)
+}
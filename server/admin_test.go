@@ -0,0 +1,119 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Sends admin requests without, with a wrong and with the right token,
+// checking that only the right token is accepted
+func TestRequireToken(t *testing.T) {
+	handler := requireToken(slog.New(slog.DiscardHandler), "secret")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		header string
+		want   int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"secret", http.StatusUnauthorized},
+		{"Bearer secret", http.StatusOK},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/admin/peers", nil)
+		if test.header != "" {
+			req.Header.Set("Authorization", test.header)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != test.want {
+			t.Errorf("Authorization %q status = %v, want %v", test.header, rec.Code, test.want)
+		}
+	}
+}
+
+// Sends admin requests to the admin and the public handler,
+// checking that admin routes are only served by the admin handler
+func TestAdminRoutesOnlyOnAdminServer(t *testing.T) {
+	logger := slog.New(slog.DiscardHandler)
+	public := http.NewServeMux()
+	addRoutes(public, logger)
+
+	req := httptest.NewRequest("GET", "/admin/peers", nil)
+	req.RemoteAddr = "127.0.0.1:1234"
+	req.Header.Set("Authorization", "Bearer secret")
+
+	rec := httptest.NewRecorder()
+	public.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Public GET /admin/peers = %v, want %v", rec.Code, http.StatusNotFound)
+	}
+
+	rec = httptest.NewRecorder()
+	NewAdminServer(logger, "secret").ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Admin GET /admin/peers = %v, want %v", rec.Code, http.StatusOK)
+	}
+}
+
+// Pauses and resumes mining, checking the mining state and that data is refused while paused
+func TestAdminMiningPause(t *testing.T) {
+	ensureGenesis(t)
+	logger := slog.New(slog.DiscardHandler)
+	t.Cleanup(func() { miningPaused.Store(false) })
+
+	handleAdminMining(logger, true).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/admin/mining/pause", nil))
+	if state := miningState(); state != miningPause {
+		t.Errorf("Mining state after pause = %v, want %v", state, miningPause)
+	}
+	if _, err := submitData(context.Background(), logger, "paused"); !errors.Is(err, ErrMiningPaused) {
+		t.Errorf("submitData() while paused returned %v, want ErrMiningPaused", err)
+	}
+
+	handleAdminMining(logger, false).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/admin/mining/resume", nil))
+	if state := miningState(); state != miningIdle {
+		t.Errorf("Mining state after resume = %v, want %v", state, miningIdle)
+	}
+}
+
+// Sends DELETE /admin/peers/{address} for a peer and an unknown node, checking that the peer is removed
+func TestHandleAdminRemovePeer(t *testing.T) {
+	peers = NewPeerSet()
+	t.Cleanup(func() { peers = NewPeerSet() })
+	peers.Add("node1:8001", "")
+
+	mux := http.NewServeMux()
+	mux.Handle("DELETE /admin/peers/{address}", handleAdminRemovePeer(slog.New(slog.DiscardHandler)))
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("DELETE", "/admin/peers/node1:8001", nil))
+	if rec.Code != http.StatusOK || peers.Contains("node1:8001") {
+		t.Errorf("DELETE /admin/peers/node1:8001 = %v, peer still known: %v", rec.Code, peers.Contains("node1:8001"))
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("DELETE", "/admin/peers/node2:8002", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("DELETE /admin/peers/node2:8002 = %v, want %v", rec.Code, http.StatusNotFound)
+	}
+}
+
+// Calls checkAdminAddr with loopback and other addresses, checking which are accepted
+func TestCheckAdminAddr(t *testing.T) {
+	for _, address := range []string{"127.0.0.1:8101", "localhost:8101", "[::1]:8101"} {
+		if err := checkAdminAddr(address); err != nil {
+			t.Errorf("checkAdminAddr(%q) returned an error: %v", address, err)
+		}
+	}
+	for _, address := range []string{"0.0.0.0:8101", ":8101", "192.0.2.1:8101", "127.0.0.1"} {
+		if err := checkAdminAddr(address); err == nil {
+			t.Errorf("checkAdminAddr(%q) returned no error", address)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Default limit of hello exchanges dialed back to an address announced in Node-Addr,
+// in dials per second and burst, overridable with RATE_LIMIT_DIAL_BACK as "rate,burst"
+const (
+	defaultDialBackRate  = 0.1
+	defaultDialBackBurst = 2
+)
+
+// Limits hello exchanges dialed back to each address announced by requests, set in NewServer
+var dialBackLimiter = NewRateLimiter(defaultDialBackRate, defaultDialBackBurst)
+
+// Checks that address is a dialable host:port pair
+func validateNodeAddr(address string) error {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("Node address %q is not in host:port format", address)
+	}
+
+	portNumber, err := strconv.Atoi(port)
+	if err != nil || portNumber < 1 || portNumber > 65535 {
+		return fmt.Errorf("Node address %q has invalid port", address)
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		if ip.IsUnspecified() || ip.IsMulticast() {
+			return fmt.Errorf("Node address %q is not dialable", address)
+		}
+		return nil
+	}
+
+	if host == "" || len(host) > 253 {
+		return fmt.Errorf("Node address %q has invalid host", address)
+	}
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return fmt.Errorf("Node address %q has invalid host", address)
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return fmt.Errorf("Node address %q has invalid host", address)
+			}
+		}
+	}
+	return nil
+}
+
+// Defines the JSON body for POST /hello request
+type HelloRequestData struct {
+	Nonce string `json:"nonce"`
+}
+
+// Defines the JSON body for POST /hello response
+type HelloData struct {
+	NodeID    string `json:"nodeId"`
+	Address   string `json:"address"`
+	Signature string `json:"signature"`
+}
+
+// Returns the message signed in the hello exchange
+func helloMessage(nonce string, address string) []byte {
+	return []byte("GoChain hello\n" + nonce + "\n" + address)
+}
+
+// Proves that this node controls its advertised address by signing the challenge.
+// Route: POST /hello
+func handleHello(logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Info("Request", "route", "POST /hello")
+
+			data, err := decode[HelloRequestData](r)
+
+			if err != nil || data.Nonce == "" {
+				_ = encode(w, r, http.StatusBadRequest, ErrorData{Error: "Invalid request body"})
+				return
+			}
+
+			localAddr := localAddress()
+			_ = encode(w, r, http.StatusOK, HelloData{
+				NodeID:    identity.ID,
+				Address:   localAddr,
+				Signature: hex.EncodeToString(identity.Sign(helloMessage(data.Nonce, localAddr))),
+			})
+		},
+	)
+}
+
+// Dials the address back and checks the signed hello response.
+// If nodeID is not empty, the remote must prove it is that node.
+// Returns the node ID of the remote.
+func verifyNodeAddr(address string, nodeID string) (string, error) {
+	nonceBytes := make([]byte, 32)
+	if _, err := rand.Read(nonceBytes); err != nil {
+		return "", fmt.Errorf("Failed to generate hello nonce: %w", err)
+	}
+	nonce := hex.EncodeToString(nonceBytes)
+
+	body, err := encodeRequest(HelloRequestData{Nonce: nonce})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest("POST", peerURL(address, "/hello"), body)
+	if err != nil {
+		return "", fmt.Errorf("Failed to create request for node %v: %v", address, err)
+	}
+	setPeerHeaders(req)
+
+	// Not retried, so a single request can't make this node dial an address repeatedly
+	resp, err := peerClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("Error connecting to host: %v, %v", address, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Unexpected response: %v, from %v", resp.StatusCode, address)
+	}
+
+	data, err := decodeResponse[HelloData](resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("Error decoding POST /hello: %v", err)
+	}
+
+	if data.Address != address {
+		return "", fmt.Errorf("Node at %v advertises address %v", address, data.Address)
+	}
+	if nodeID != "" && data.NodeID != nodeID {
+		return "", fmt.Errorf("Node at %v is %v, expected %v", address, data.NodeID, nodeID)
+	}
+	signature, err := hex.DecodeString(data.Signature)
+	if err != nil {
+		return "", fmt.Errorf("Node at %v sent malformed signature", address)
+	}
+	if err := verifyNodeSignature(data.NodeID, helloMessage(nonce, address), signature); err != nil {
+		return "", err
+	}
+	return data.NodeID, nil
+}
+
+// Admission attempt shared by concurrent callers for the same address
+type admission struct {
+	done chan struct{}
+	err  error
+}
+
+// Addresses with admission in progress
+var pendingAdmissions = struct {
+	sync.Mutex
+	addresses map[string]*admission
+}{addresses: make(map[string]*admission)}
+
+// Checks if admission of the address is in progress
+func admissionPending(address string) bool {
+	pendingAdmissions.Lock()
+	defer pendingAdmissions.Unlock()
+
+	_, ok := pendingAdmissions.addresses[address]
+	return ok
+}
+
+// Verifies the address with a hello exchange and adds it to known peers.
+// Concurrent calls for the same address wait for the first attempt.
+func admitPeer(address string, nodeID string) error {
+	if err := validateNodeAddr(address); err != nil {
+		return err
+	}
+	if address == localAddress() || nodeID == identity.ID {
+		return fmt.Errorf("Node address %v is this node", address)
+	}
+	if banList.IsBanned(address, nodeID) {
+		return fmt.Errorf("Node %v is banned", address)
+	}
+	if knownID, ok := peers.NodeID(address); ok && nodeID != "" && knownID == nodeID {
+		peers.Add(address, nodeID)
+		return nil
+	}
+
+	pendingAdmissions.Lock()
+	if pending, ok := pendingAdmissions.addresses[address]; ok {
+		pendingAdmissions.Unlock()
+		<-pending.done
+		return pending.err
+	}
+	pending := &admission{done: make(chan struct{})}
+	pendingAdmissions.addresses[address] = pending
+	pendingAdmissions.Unlock()
+
+	pending.err = verifyAndAddPeer(address, nodeID)
+
+	pendingAdmissions.Lock()
+	delete(pendingAdmissions.addresses, address)
+	pendingAdmissions.Unlock()
+	close(pending.done)
+
+	return pending.err
+}
+
+// Runs the hello exchange and adds the verified node to known peers
+func verifyAndAddPeer(address string, nodeID string) error {
+	verifiedID, err := verifyNodeAddr(address, nodeID)
+	if err != nil {
+		return fmt.Errorf("Failed to verify node %v: %w", address, err)
+	}
+	if verifiedID == identity.ID {
+		return fmt.Errorf("Node address %v is this node", address)
+	}
+	if banList.IsBanned(address, verifiedID) {
+		return fmt.Errorf("Node %v is banned", address)
+	}
+
+	if peers.AddVerified(address, verifiedID) {
+		membership.Joined(address, verifiedID)
+		go gossiper.Publish(context.Background(), gossipPeer, address+"/"+verifiedID, PeerAnnouncement{Address: address, NodeID: verifiedID})
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Calls validateNodeAddr with valid and invalid addresses, checking the result
+func TestValidateNodeAddr(t *testing.T) {
+	valid := []string{"node1:8001", "127.0.0.1:8001", "[::1]:8001", "example.com:443"}
+	invalid := []string{"", "node1", "node1:0", "node1:99999", "node1:port", "0.0.0.0:8001", ":8001", "bad_host:8001", "-node:8001"}
+
+	for _, address := range valid {
+		if err := validateNodeAddr(address); err != nil {
+			t.Errorf("validateNodeAddr(%q) returned an error: %v", address, err)
+		}
+	}
+	for _, address := range invalid {
+		if err := validateNodeAddr(address); err == nil {
+			t.Errorf("validateNodeAddr(%q) didn't return an error", address)
+		}
+	}
+}
+
+// Starts a node serving POST /hello, returning its address
+func startHelloNode(t *testing.T) string {
+	srv := httptest.NewServer(handleHello(slog.New(slog.DiscardHandler)))
+	t.Cleanup(srv.Close)
+
+	address := strings.TrimPrefix(srv.URL, "http://")
+	t.Setenv("LOCAL_ADDR", address)
+	return address
+}
+
+// Calls verifyNodeAddr against a node serving POST /hello, checking that the node ID is returned
+func TestVerifyNodeAddr(t *testing.T) {
+	address := startHelloNode(t)
+
+	nodeID, err := verifyNodeAddr(address, identity.ID)
+
+	if err != nil || nodeID != identity.ID {
+		t.Errorf("verifyNodeAddr() = %v, %v, want %v", nodeID, err, identity.ID)
+	}
+}
+
+// Calls verifyNodeAddr with a node ID the remote doesn't control, checking if there is error message
+func TestVerifyNodeAddrWrongNodeID(t *testing.T) {
+	address := startHelloNode(t)
+	other := mustGenerateIdentity()
+
+	_, err := verifyNodeAddr(address, other.ID)
+
+	if err == nil {
+		t.Error("verifyNodeAddr() didn't return an error for wrong node ID")
+	}
+}
+
+// Sends a request without Node-Addr header, checking that the client isn't added as a peer
+func TestCheckIfNodeRecognisedPlainClient(t *testing.T) {
+	peers = NewPeerSet()
+	handler := checkIfNodeRecognised(slog.New(slog.DiscardHandler))(http.NotFoundHandler())
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/chain", nil))
+
+	if peers.Len() != 0 {
+		t.Errorf("Plain client was added as peer: %v", peers.Addresses())
+	}
+}
+
+// Sends a request with malformed Node-Addr header, checking that it is rejected
+func TestCheckIfNodeRecognisedInvalidAddr(t *testing.T) {
+	handler := checkIfNodeRecognised(slog.New(slog.DiscardHandler))(http.NotFoundHandler())
+	req := httptest.NewRequest("GET", "/chain", nil)
+	req.Header.Set("Node-Addr", "not an address")
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Status = %v, want %v", rec.Code, http.StatusBadRequest)
+	}
+}
+
+// Sends requests naming an address with a new Node-ID each time, checking that the address is dialed back
+// at most the burst of the dial-back limit, and not at all once it is admitted
+func TestCheckIfNodeRecognisedLimitsDialBack(t *testing.T) {
+	var hellos atomic.Int32
+	hello := handleHello(slog.New(slog.DiscardHandler))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hellos.Add(1)
+		hello.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	address := strings.TrimPrefix(srv.URL, "http://")
+
+	peers = NewPeerSet()
+	previous := dialBackLimiter
+	dialBackLimiter = NewRateLimiter(defaultDialBackRate, defaultDialBackBurst)
+	t.Cleanup(func() { dialBackLimiter = previous })
+	handler := checkIfNodeRecognised(slog.New(slog.DiscardHandler))(http.NotFoundHandler())
+	send := func() {
+		req := httptest.NewRequest("GET", "/chain", nil)
+		req.Header.Set("Node-Addr", address)
+		req.Header.Set("Node-ID", mustGenerateIdentity().ID)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	for range 10 {
+		send()
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if hellos.Load() > defaultDialBackBurst {
+		t.Errorf("Address was dialed back %v times, want at most %v", hellos.Load(), defaultDialBackBurst)
+	}
+
+	dialBackLimiter = NewRateLimiter(defaultDialBackRate, defaultDialBackBurst)
+	peers.Add(address, "admitted")
+	before := hellos.Load()
+	send()
+	time.Sleep(50 * time.Millisecond)
+	if hellos.Load() != before {
+		t.Error("Admitted address was dialed back for a request with another Node-ID")
+	}
+}
@@ -0,0 +1,547 @@
+package server
+
+import (
+	"GoChain/client"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scopes of API clients
+const (
+	// Reads the chain, peers and node state
+	scopeRead = "read"
+	// Submits data to be mined
+	scopeSubmit = "submit"
+)
+
+// Known scopes, in the order listed in errors
+var authScopes = []string{scopeRead, scopeSubmit}
+
+// Default authentication settings, overridable with AUTH_ANONYMOUS_SCOPES and AUTH_HMAC_MAX_SKEW
+const (
+	defaultAnonymousScopes = scopeRead
+	defaultHMACMaxSkew     = 5 * time.Minute
+)
+
+// Largest request body read to check an HMAC signature
+const maxSignedBodySize = 1 << 20
+
+var (
+	// Returned by an authenticator when the request carries none of its credentials
+	ErrNoCredentials = errors.New("No credentials")
+	// Returned for unknown, expired or badly signed credentials
+	ErrInvalidCredentials = errors.New("Invalid credentials")
+	// Returned when a caller without credentials needs a scope anonymous callers don't have
+	ErrUnauthenticated = errors.New("Credentials required")
+	// Returned when the credentials of the caller don't grant the scope
+	ErrForbidden = errors.New("Scope not granted")
+	// Returned when the caller has used up its submissions
+	ErrQuotaExceeded = errors.New("Quota exceeded")
+)
+
+// Caller of the API identified by its credentials
+type Principal struct {
+	ID     string
+	Scopes []string
+	// Submissions allowed to the caller, nil if unlimited
+	Quota *Quota
+	// Set for callers without credentials
+	Anonymous bool
+}
+
+// Reports whether the caller was granted the scope
+func (p Principal) Has(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+// Authenticates requests carrying one kind of credentials.
+// Returns an error wrapping ErrNoCredentials if the request carries none of its kind,
+// so the next authenticator can be tried.
+type Authenticator interface {
+	Authenticate(r *http.Request) (Principal, error)
+}
+
+// Client authentication of the node.
+// Authenticators are tried in turn, the first one finding its credentials in the request decides.
+// Callers without credentials get the anonymous scopes, peers proven by their TLS certificate may always read.
+type Auth struct {
+	authenticators []Authenticator
+	anonymous      []string
+	challenges     []string
+}
+
+// Client authentication used by the node, nil if every client may read and submit
+var auth *Auth
+
+// Creates client authentication giving callers without credentials the anonymous scopes
+func NewAuth(anonymous []string, authenticators ...Authenticator) *Auth {
+	a := &Auth{authenticators: authenticators, anonymous: anonymous}
+	for _, authenticator := range authenticators {
+		if c, ok := authenticator.(interface{ Challenge() string }); ok {
+			a.challenges = append(a.challenges, c.Challenge())
+		}
+	}
+	return a
+}
+
+// Returns the caller of the request
+func (a *Auth) Authenticate(r *http.Request) (Principal, error) {
+	for _, authenticator := range a.authenticators {
+		principal, err := authenticator.Authenticate(r)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		return principal, err
+	}
+
+	if header := r.Header.Get("Authorization"); header != "" {
+		scheme, _, _ := strings.Cut(header, " ")
+		return Principal{}, fmt.Errorf("%w: unsupported authorization scheme %q", ErrInvalidCredentials, scheme)
+	}
+	if nodeID, ok := tlsPeerID(r); ok {
+		return Principal{ID: "peer:" + nodeID, Scopes: []string{scopeRead}}, nil
+	}
+	return Principal{ID: "anonymous", Scopes: a.anonymous, Anonymous: true}, nil
+}
+
+type principalKey struct{}
+
+// Returns context carrying the caller
+func withPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// Returns the caller carried by the context, false if the request was not authenticated
+func principalFrom(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(Principal)
+	return principal, ok
+}
+
+// Checks that the caller of the request was granted the scope.
+// Requests that were not authenticated are allowed, as they are when client authentication is disabled.
+func authorize(r *http.Request, scope string) error {
+	principal, ok := principalFrom(r.Context())
+	switch {
+	case !ok || principal.Has(scope):
+		return nil
+	case principal.Anonymous:
+		return fmt.Errorf("%w: %v scope is not granted without credentials", ErrUnauthenticated, scope)
+	}
+	return fmt.Errorf("%w: %v has no %v scope", ErrForbidden, principal.ID, scope)
+}
+
+// Takes one submission from the quota of the caller of the request
+func takeQuota(r *http.Request) error {
+	principal, _ := principalFrom(r.Context())
+	if allowed, retryAfter := principal.Quota.Take(); !allowed {
+		return &quotaError{id: principal.ID, retryAfter: retryAfter}
+	}
+	return nil
+}
+
+// Error for callers that used up their quota
+type quotaError struct {
+	id         string
+	retryAfter time.Duration
+}
+
+func (e *quotaError) Error() string {
+	return fmt.Sprintf("%v: %v may submit again in %v", ErrQuotaExceeded, e.id, e.retryAfter.Round(time.Second))
+}
+
+// Makes errors.Is(err, ErrQuotaExceeded) true
+func (e *quotaError) Is(target error) bool {
+	return target == ErrQuotaExceeded
+}
+
+// Authenticates API clients and rejects requests whose caller wasn't granted the scope.
+// Routes without scope only authenticate and leave the checks to the handler.
+// Submissions also take one from the quota of the caller.
+func requireScope(logger *slog.Logger, scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if auth == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			principal, err := auth.Authenticate(r)
+			if err == nil {
+				r = r.WithContext(withPrincipal(r.Context(), principal))
+				if scope != "" {
+					err = authorize(r, scope)
+				}
+				if err == nil && scope == scopeSubmit {
+					err = takeQuota(r)
+				}
+			}
+			if err != nil {
+				logger.Info("Rejected client", "route", r.Method+" "+r.URL.Path, "remote", r.RemoteAddr, "principal", principal.ID, "err", err)
+				writeAuthError(w, r, err)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Writes response for an authentication or authorization error
+func writeAuthError(w http.ResponseWriter, r *http.Request, err error) {
+	var quotaErr *quotaError
+	switch {
+	case errors.As(err, &quotaErr):
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(quotaErr.retryAfter.Seconds()))))
+		_ = encode(w, r, http.StatusTooManyRequests, ErrorData{Error: err.Error()})
+	case errors.Is(err, ErrForbidden):
+		_ = encode(w, r, http.StatusForbidden, ErrorData{Error: err.Error()})
+	default:
+		if len(auth.challenges) > 0 {
+			w.Header().Set("WWW-Authenticate", strings.Join(auth.challenges, ", "))
+		}
+		_ = encode(w, r, http.StatusUnauthorized, ErrorData{Error: err.Error()})
+	}
+}
+
+// Number of submissions allowed within a fixed window
+type Quota struct {
+	limit  int
+	window time.Duration
+
+	mu    sync.Mutex
+	start time.Time
+	used  int
+}
+
+// Creates quota of limit submissions per window
+func NewQuota(limit int, window time.Duration) *Quota {
+	return &Quota{limit: limit, window: window}
+}
+
+// Parses quota in "limit/window" format, e.g. "100/1h"
+func ParseQuota(value string) (*Quota, error) {
+	limitValue, windowValue, ok := strings.Cut(value, "/")
+	if !ok {
+		return nil, fmt.Errorf("Quota %q is not in limit/window format", value)
+	}
+	limit, err := strconv.Atoi(strings.TrimSpace(limitValue))
+	if err != nil || limit < 0 {
+		return nil, fmt.Errorf("Quota %q has invalid limit", value)
+	}
+	window, err := time.ParseDuration(strings.TrimSpace(windowValue))
+	if err != nil || window <= 0 {
+		return nil, fmt.Errorf("Quota %q has invalid window", value)
+	}
+	return NewQuota(limit, window), nil
+}
+
+// Takes one submission from the quota, nil quota is unlimited.
+// If the quota is used up, returns false and the time until the window ends.
+func (q *Quota) Take() (bool, time.Duration) {
+	if q == nil {
+		return true, 0
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(q.start) >= q.window {
+		q.start = now
+		q.used = 0
+	}
+	if q.used >= q.limit {
+		return false, q.start.Add(q.window).Sub(now)
+	}
+	q.used++
+	return true, 0
+}
+
+// Quotas with the same limit for callers known only when they first call, e.g. JWT subjects
+type quotaSet struct {
+	limit  int
+	window time.Duration
+
+	mu     sync.Mutex
+	quotas map[string]*Quota
+}
+
+// Creates quota set using the limit and window of the quota, nil if the quota is nil
+func newQuotaSet(quota *Quota) *quotaSet {
+	if quota == nil {
+		return nil
+	}
+	return &quotaSet{limit: quota.limit, window: quota.window, quotas: make(map[string]*Quota)}
+}
+
+// Returns quota of the caller, nil for the nil set
+func (s *quotaSet) get(id string) *Quota {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Quotas whose window has ended are full again and can be dropped
+	if len(s.quotas) >= rateLimiterCleanupSize {
+		for key, q := range s.quotas {
+			q.mu.Lock()
+			ended := time.Since(q.start) >= q.window
+			q.mu.Unlock()
+			if ended {
+				delete(s.quotas, key)
+			}
+		}
+	}
+
+	q, ok := s.quotas[id]
+	if !ok {
+		q = NewQuota(s.limit, s.window)
+		s.quotas[id] = q
+	}
+	return q
+}
+
+// Authenticates requests with a static key in the X-API-Key header.
+// Keys are kept as SHA-256 hashes so the keys file doesn't reveal them.
+type APIKeyAuthenticator struct {
+	keys map[[sha256.Size]byte]Principal
+}
+
+func (a *APIKeyAuthenticator) Authenticate(r *http.Request) (Principal, error) {
+	key := r.Header.Get(client.APIKeyHeader)
+	if key == "" {
+		return Principal{}, ErrNoCredentials
+	}
+	principal, ok := a.keys[sha256.Sum256([]byte(key))]
+	if !ok {
+		return Principal{}, fmt.Errorf("%w: unknown API key", ErrInvalidCredentials)
+	}
+	return principal, nil
+}
+
+// Secret of an HMAC key and the caller it identifies
+type hmacKey struct {
+	secret    []byte
+	principal Principal
+}
+
+// Authenticates requests signed with a shared secret, see client.SignHMAC.
+// Requests are accepted only within the allowed clock skew and each nonce of a key only once.
+type HMACAuthenticator struct {
+	keys    map[string]hmacKey
+	maxSkew time.Duration
+
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+func (a *HMACAuthenticator) Challenge() string {
+	return client.HMACScheme
+}
+
+func (a *HMACAuthenticator) Authenticate(r *http.Request) (Principal, error) {
+	params, ok := strings.CutPrefix(r.Header.Get("Authorization"), client.HMACScheme+" ")
+	if !ok {
+		return Principal{}, ErrNoCredentials
+	}
+
+	fields := map[string]string{}
+	for _, param := range strings.Split(params, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+		fields[name] = value
+	}
+
+	key, ok := a.keys[fields["KeyId"]]
+	if !ok {
+		return Principal{}, fmt.Errorf("%w: unknown HMAC key %q", ErrInvalidCredentials, fields["KeyId"])
+	}
+	timestamp, err := strconv.ParseInt(fields["Timestamp"], 10, 64)
+	if err != nil {
+		return Principal{}, fmt.Errorf("%w: invalid timestamp", ErrInvalidCredentials)
+	}
+	signedAt := time.Unix(timestamp, 0)
+	if skew := time.Since(signedAt); skew > a.maxSkew || skew < -a.maxSkew {
+		return Principal{}, fmt.Errorf("%w: timestamp is more than %v off", ErrInvalidCredentials, a.maxSkew)
+	}
+
+	// Body is read for the signature and put back for the handler
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxSignedBodySize+1))
+	if err != nil || len(body) > maxSignedBodySize {
+		return Principal{}, fmt.Errorf("%w: body can't be read for the signature", ErrInvalidCredentials)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	nonce := fields["Nonce"]
+	if nonce == "" {
+		return Principal{}, fmt.Errorf("%w: missing nonce", ErrInvalidCredentials)
+	}
+	want := client.HMACSignature(key.secret, r.Method, r.URL.RequestURI(), timestamp, nonce, body)
+	if !hmac.Equal([]byte(fields["Signature"]), []byte(want)) {
+		return Principal{}, fmt.Errorf("%w: signature doesn't match", ErrInvalidCredentials)
+	}
+	if !a.remember(fields["KeyId"]+" "+nonce, signedAt) {
+		return Principal{}, fmt.Errorf("%w: nonce was already used", ErrInvalidCredentials)
+	}
+	return key.principal, nil
+}
+
+// Records nonce of a key, returning false if it was seen before.
+// Nonces older than the allowed skew are forgotten, their requests are rejected by timestamp.
+func (a *HMACAuthenticator) remember(nonce string, signedAt time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if len(a.seen) >= rateLimiterCleanupSize {
+		for key, at := range a.seen {
+			if time.Since(at) > a.maxSkew {
+				delete(a.seen, key)
+			}
+		}
+	}
+
+	if _, ok := a.seen[nonce]; ok {
+		return false
+	}
+	a.seen[nonce] = signedAt
+	return true
+}
+
+// Defines the JSON file of API keys and HMAC keys
+type authKeysFile struct {
+	Keys []authKeyEntry `json:"keys"`
+}
+
+// Defines a key of the keys file.
+// Either the hex SHA-256 of an API key or an HMAC secret is given.
+type authKeyEntry struct {
+	ID           string   `json:"id"`
+	APIKeySHA256 string   `json:"apiKeySha256,omitempty"`
+	HMACSecret   string   `json:"hmacSecret,omitempty"`
+	Scopes       []string `json:"scopes"`
+	Quota        string   `json:"quota,omitempty"`
+}
+
+// Loads API keys and HMAC keys from the keys file
+func LoadAuthKeys(path string, maxSkew time.Duration) (*APIKeyAuthenticator, *HMACAuthenticator, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to read keys file: %w", err)
+	}
+	var file authKeysFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return nil, nil, fmt.Errorf("Failed to decode keys file %v: %w", path, err)
+	}
+
+	apiKeys := &APIKeyAuthenticator{keys: make(map[[sha256.Size]byte]Principal)}
+	hmacKeys := &HMACAuthenticator{keys: make(map[string]hmacKey), maxSkew: maxSkew, seen: make(map[string]time.Time)}
+	ids := map[string]bool{}
+
+	for _, entry := range file.Keys {
+		if entry.ID == "" || ids[entry.ID] {
+			return nil, nil, fmt.Errorf("Key %q in %v has empty or duplicate id", entry.ID, path)
+		}
+		ids[entry.ID] = true
+
+		if err := checkScopes(entry.Scopes); err != nil {
+			return nil, nil, fmt.Errorf("Key %v: %w", entry.ID, err)
+		}
+		principal := Principal{ID: entry.ID, Scopes: entry.Scopes}
+		if entry.Quota != "" {
+			if principal.Quota, err = ParseQuota(entry.Quota); err != nil {
+				return nil, nil, fmt.Errorf("Key %v: %w", entry.ID, err)
+			}
+		}
+
+		switch {
+		case entry.APIKeySHA256 != "" && entry.HMACSecret == "":
+			hash, err := hex.DecodeString(entry.APIKeySHA256)
+			if err != nil || len(hash) != sha256.Size {
+				return nil, nil, fmt.Errorf("Key %v: apiKeySha256 is not a hex SHA-256 hash", entry.ID)
+			}
+			apiKeys.keys[[sha256.Size]byte(hash)] = principal
+		case entry.HMACSecret != "" && entry.APIKeySHA256 == "":
+			hmacKeys.keys[entry.ID] = hmacKey{secret: []byte(entry.HMACSecret), principal: principal}
+		default:
+			return nil, nil, fmt.Errorf("Key %v needs either apiKeySha256 or hmacSecret", entry.ID)
+		}
+	}
+	return apiKeys, hmacKeys, nil
+}
+
+// Checks that every scope is known
+func checkScopes(scopes []string) error {
+	for _, scope := range scopes {
+		if !slices.Contains(authScopes, scope) {
+			return fmt.Errorf("Unknown scope %q, want one of %v", scope, strings.Join(authScopes, ", "))
+		}
+	}
+	return nil
+}
+
+// Parses comma separated scopes, "none" for no scopes
+func parseScopes(value string) ([]string, error) {
+	if value == "none" {
+		return []string{}, nil
+	}
+	scopes := []string{}
+	for _, scope := range strings.Split(value, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, checkScopes(scopes)
+}
+
+// Sets up client authentication from environment variables, nil if no credentials are configured.
+// API keys and HMAC keys are read from AUTH_KEYS_FILE, JWTs are verified with the keys in AUTH_JWKS_FILE.
+func authFromEnv() (*Auth, error) {
+	keysPath, jwksPath := os.Getenv("AUTH_KEYS_FILE"), os.Getenv("AUTH_JWKS_FILE")
+	if keysPath == "" && jwksPath == "" {
+		return nil, nil
+	}
+
+	anonymous, err := parseScopes(envString("AUTH_ANONYMOUS_SCOPES", defaultAnonymousScopes))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid AUTH_ANONYMOUS_SCOPES: %w", err)
+	}
+
+	var authenticators []Authenticator
+	if keysPath != "" {
+		apiKeys, hmacKeys, err := LoadAuthKeys(keysPath, envDuration("AUTH_HMAC_MAX_SKEW", defaultHMACMaxSkew))
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, apiKeys, hmacKeys)
+	}
+	if jwksPath != "" {
+		keys, err := LoadJWKS(jwksPath)
+		if err != nil {
+			return nil, err
+		}
+		var quota *Quota
+		if value := os.Getenv("AUTH_JWT_QUOTA"); value != "" {
+			if quota, err = ParseQuota(value); err != nil {
+				return nil, fmt.Errorf("Invalid AUTH_JWT_QUOTA: %w", err)
+			}
+		}
+		authenticators = append(authenticators, NewJWTAuthenticator(keys, os.Getenv("AUTH_JWT_ISSUER"), os.Getenv("AUTH_JWT_AUDIENCE"), quota))
+	}
+	return NewAuth(anonymous, authenticators...), nil
+}
@@ -0,0 +1,190 @@
+package server
+
+import (
+	"GoChain/client"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Writes keys file with a read-only API key and an HMAC key allowed to submit once an hour,
+// enabling authentication without anonymous scopes for the test
+func useTestAuth(t *testing.T) {
+	hash := sha256.Sum256([]byte("reader-key"))
+	path := filepath.Join(t.TempDir(), "keys.json")
+	content := `{"keys": [
+		{"id": "reader", "apiKeySha256": "` + hex.EncodeToString(hash[:]) + `", "scopes": ["read"]},
+		{"id": "ingest", "hmacSecret": "ingest-secret", "scopes": ["read", "submit"], "quota": "1/1h"}
+	]}`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Writing keys file returned an error: %v", err)
+	}
+
+	apiKeys, hmacKeys, err := LoadAuthKeys(path, time.Minute)
+	if err != nil {
+		t.Fatalf("LoadAuthKeys() returned an error: %v", err)
+	}
+	auth = NewAuth([]string{}, apiKeys, hmacKeys)
+	t.Cleanup(func() { auth = nil })
+}
+
+// Returns status code of the client error, 200 for no error
+func statusOf(err error) int {
+	var apiErr *client.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode
+	}
+	if err != nil {
+		return 0
+	}
+	return http.StatusOK
+}
+
+// Calls the node with anonymous, API key and HMAC clients,
+// checking that each gets only its scopes and that the quota limits submissions
+func TestAuthenticatedRoutes(t *testing.T) {
+	ensureGenesis(t)
+	useTestAuth(t)
+	mux := http.NewServeMux()
+	addRoutes(mux, slog.New(slog.DiscardHandler))
+	node := httptest.NewServer(mux)
+	defer node.Close()
+
+	ctx := context.Background()
+	anonymous := client.New(node.URL, client.Config{Retries: -1})
+	reader := client.New(node.URL, client.Config{Retries: -1, PrepareRequest: client.APIKey("reader-key")})
+	ingest := client.New(node.URL, client.Config{Retries: -1, PrepareRequest: client.SignHMAC("ingest", []byte("ingest-secret"))})
+	forged := client.New(node.URL, client.Config{Retries: -1, PrepareRequest: client.SignHMAC("ingest", []byte("guess"))})
+
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"Anonymous Tip()", second(anonymous.Tip(ctx)), http.StatusUnauthorized},
+		{"Unknown API key Tip()", second(client.New(node.URL, client.Config{Retries: -1, PrepareRequest: client.APIKey("guess")}).Tip(ctx)), http.StatusUnauthorized},
+		{"Forged HMAC Tip()", second(forged.Tip(ctx)), http.StatusUnauthorized},
+		{"API key Tip()", second(reader.Tip(ctx)), http.StatusOK},
+		{"API key Submit()", second(reader.Submit(ctx, "reader")), http.StatusForbidden},
+		{"HMAC Tip()", second(ingest.Tip(ctx)), http.StatusOK},
+		{"HMAC Submit()", second(ingest.Submit(ctx, "ingest")), http.StatusOK},
+		{"HMAC Submit() over quota", second(ingest.Submit(ctx, "ingest")), http.StatusTooManyRequests},
+	}
+	for _, test := range tests {
+		if got := statusOf(test.err); got != test.want {
+			t.Errorf("%v returned %v, want status %v", test.name, test.err, test.want)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Anonymous GET /healthz = %v, want %v", rec.Code, http.StatusOK)
+	}
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/tip", nil))
+	if got := rec.Header().Get("WWW-Authenticate"); got != client.HMACScheme {
+		t.Errorf("WWW-Authenticate = %q, want %q", got, client.HMACScheme)
+	}
+}
+
+// Returns the error of a two value call
+func second[T any](_ T, err error) error {
+	return err
+}
+
+// Calls data_submit and node_status over JSON-RPC with a read-only key, checking that only reading is allowed
+func TestRPCScopes(t *testing.T) {
+	ensureGenesis(t)
+	useTestAuth(t)
+	handler := requireScope(slog.New(slog.DiscardHandler), "")(handleRPC(slog.New(slog.DiscardHandler), NewRateLimiter(1, 1)))
+
+	call := func(body string) string {
+		req := httptest.NewRequest("POST", "/rpc", strings.NewReader(body))
+		req.Header.Set(client.APIKeyHeader, "reader-key")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Body.String()
+	}
+
+	if body := call(`{"jsonrpc": "2.0", "method": "data_submit", "params": ["reader"], "id": 1}`); !strings.Contains(body, `"code":-32004`) {
+		t.Errorf("data_submit with read-only key = %v, want error -32004", body)
+	}
+	if body := call(`{"jsonrpc": "2.0", "method": "node_status", "id": 1}`); !strings.Contains(body, `"result"`) {
+		t.Errorf("node_status with read-only key = %v, want result", body)
+	}
+}
+
+// Sends the same signed request twice and one signed too long ago, checking that both are rejected
+func TestHMACReplay(t *testing.T) {
+	useTestAuth(t)
+	sign := client.SignHMAC("ingest", []byte("ingest-secret"))
+
+	req := httptest.NewRequest("GET", "/tip", nil)
+	sign(req)
+	if _, err := auth.Authenticate(req); err != nil {
+		t.Fatalf("Authenticate() returned an error: %v", err)
+	}
+	if _, err := auth.Authenticate(req); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Authenticate() of a replayed request returned %v, want ErrInvalidCredentials", err)
+	}
+
+	old := time.Now().Add(-time.Hour).Unix()
+	stale := httptest.NewRequest("GET", "/tip", nil)
+	stale.Header.Set("Authorization", client.HMACScheme+" KeyId=ingest, Timestamp="+
+		strconv.FormatInt(old, 10)+", Nonce=n, Signature="+client.HMACSignature([]byte("ingest-secret"), "GET", "/tip", old, "n", nil))
+	if _, err := auth.Authenticate(stale); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Authenticate() of a request signed an hour ago returned %v, want ErrInvalidCredentials", err)
+	}
+}
+
+// Takes from a quota of two per hour, checking that the third submission waits for the window
+func TestQuota(t *testing.T) {
+	quota, err := ParseQuota("2/1h")
+	if err != nil {
+		t.Fatalf("ParseQuota() returned an error: %v", err)
+	}
+	quota.Take()
+	quota.Take()
+
+	if allowed, retryAfter := quota.Take(); allowed || retryAfter <= 59*time.Minute {
+		t.Errorf("Third Take() = %v, %v, want false with an hour wait", allowed, retryAfter)
+	}
+
+	for _, value := range []string{"", "10", "x/1h", "10/x", "10/0s", "-1/1h"} {
+		if _, err := ParseQuota(value); err == nil {
+			t.Errorf("ParseQuota(%q) returned no error", value)
+		}
+	}
+}
+
+// Loads keys files with invalid entries, checking that each is rejected
+func TestLoadAuthKeysInvalid(t *testing.T) {
+	hash := strings.Repeat("ab", sha256.Size)
+	for _, keys := range []string{
+		`{"id": "", "hmacSecret": "s", "scopes": ["read"]}`,
+		`{"id": "a", "hmacSecret": "s", "scopes": ["read"]}, {"id": "a", "hmacSecret": "s", "scopes": ["read"]}`,
+		`{"id": "a", "hmacSecret": "s", "apiKeySha256": "` + hash + `", "scopes": ["read"]}`,
+		`{"id": "a", "scopes": ["read"]}`,
+		`{"id": "a", "apiKeySha256": "abcd", "scopes": ["read"]}`,
+		`{"id": "a", "hmacSecret": "s", "scopes": ["write"]}`,
+		`{"id": "a", "hmacSecret": "s", "scopes": ["submit"], "quota": "many"}`,
+	} {
+		path := filepath.Join(t.TempDir(), "keys.json")
+		os.WriteFile(path, []byte(`{"keys": [`+keys+`]}`), 0o600)
+
+		if _, _, err := LoadAuthKeys(path, time.Minute); err == nil {
+			t.Errorf("LoadAuthKeys() with %v returned no error", keys)
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package server
+
+import (
+	"GoChain/block"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of peer misbehaviour
+const (
+	offenceInvalidBlock   = "invalid-block"
+	offenceDecodeFailure  = "decode-failure"
+	offenceInvalidChain   = "invalid-chain"
+	offenceInvalidMessage = "invalid-message"
+)
+
+// Score added to a peer for each offence
+var offenceWeights = map[string]int{
+	offenceInvalidBlock:   50,
+	offenceDecodeFailure:  20,
+	offenceInvalidChain:   100,
+	offenceInvalidMessage: 20,
+}
+
+// Default ban settings, overridable with BAN_THRESHOLD, BAN_DURATION and SCORE_HALF_LIFE
+const (
+	defaultBanThreshold  = 100
+	defaultBanDuration   = 24 * time.Hour
+	defaultScoreHalfLife = time.Hour
+)
+
+// Score at which a peer is banned, how long the ban lasts and how fast scores decay
+type BanPolicy struct {
+	Threshold float64
+	Duration  time.Duration
+	HalfLife  time.Duration
+}
+
+// Ban policy used by the node, replaced in NewServer
+var banPolicy = BanPolicy{Threshold: defaultBanThreshold, Duration: defaultBanDuration, HalfLife: defaultScoreHalfLife}
+
+// Temporarily banned node
+type Ban struct {
+	Address string    `json:"address"`
+	NodeID  string    `json:"nodeId,omitempty"`
+	Reason  string    `json:"reason"`
+	Until   time.Time `json:"until"`
+}
+
+// Thread-safe list of banned nodes keyed by address
+type BanList struct {
+	mu   sync.RWMutex
+	bans map[string]Ban
+}
+
+// Banned nodes
+var banList = NewBanList()
+
+// Creates an empty ban list
+func NewBanList() *BanList {
+	return &BanList{bans: make(map[string]Ban)}
+}
+
+// Bans node at address until the ban expires
+func (l *BanList) Ban(ban Ban) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.bans[ban.Address] = ban
+}
+
+// Removes ban of the address, returning false if it wasn't banned
+func (l *BanList) Unban(address string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, ok := l.bans[address]
+	delete(l.bans, address)
+	return ok
+}
+
+// Checks if the address or node ID has an active ban
+func (l *BanList) IsBanned(address string, nodeID string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	now := time.Now()
+	for _, ban := range l.bans {
+		if now.After(ban.Until) {
+			continue
+		}
+		if ban.Address == address || (nodeID != "" && ban.NodeID == nodeID) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns active bans sorted by address, dropping expired ones
+func (l *BanList) List() []Ban {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	list := []Ban{}
+	for address, ban := range l.bans {
+		if now.After(ban.Until) {
+			delete(l.bans, address)
+			continue
+		}
+		list = append(list, ban)
+	}
+	slices.SortFunc(list, func(a, b Ban) int { return strings.Compare(a.Address, b.Address) })
+	return list
+}
+
+// Misbehaviour scores of clients without a proven peer identity, keyed by IP
+type hostScores struct {
+	mu     sync.Mutex
+	scores map[string]hostScore
+}
+
+// Decaying score of one client IP
+type hostScore struct {
+	score   float64
+	updated time.Time
+}
+
+// Number of client IPs scored before decayed entries are dropped
+const maxHostScores = 10000
+
+// Scores of clients penalised by IP
+var unprovenScores = &hostScores{scores: make(map[string]hostScore)}
+
+// Adds weight to the decayed score of the IP, returning the new score
+func (s *hostScores) Penalize(ip string, weight int, halfLife time.Duration) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if len(s.scores) >= maxHostScores {
+		for key, entry := range s.scores {
+			if decayedScore(entry.score, entry.updated, now, halfLife) < 1 {
+				delete(s.scores, key)
+			}
+		}
+	}
+
+	entry := s.scores[ip]
+	entry.score = decayedScore(entry.score, entry.updated, now, halfLife) + float64(weight)
+	entry.updated = now
+	s.scores[ip] = entry
+	return entry.score
+}
+
+// Returns IP of the client sending the request
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Returns who is accountable for the request: the address of the peer if its TLS certificate proves it,
+// otherwise the client IP, so a Node-Addr header alone can't get another node penalised
+func requestSender(r *http.Request) string {
+	if _, ok := tlsPeerID(r); ok {
+		return r.Header.Get("Node-Addr")
+	}
+	return remoteIP(r)
+}
+
+// Adds offence weight to the score of the peer or client IP and bans it if it reaches the threshold.
+// Callers pass peer addresses only for proven identities, see requestSender.
+func penalizePeer(logger *slog.Logger, address string, offence string) {
+	score, ok := peers.Penalize(address, offenceWeights[offence], banPolicy.HalfLife)
+	if !ok {
+		if net.ParseIP(address) == nil {
+			return
+		}
+		score = unprovenScores.Penalize(address, offenceWeights[offence], banPolicy.HalfLife)
+	}
+	logger.Info("Peer penalised", "peer", address, "offence", offence, "score", score)
+
+	if score >= banPolicy.Threshold {
+		banPeer(logger, address, fmt.Sprintf("Misbehaviour score %.1f after %v", score, offence), banPolicy.Duration)
+	}
+}
+
+// Bans node and disconnects it
+func banPeer(logger *slog.Logger, address string, reason string, duration time.Duration) {
+	nodeID, _ := peers.NodeID(address)
+	banList.Ban(Ban{Address: address, NodeID: nodeID, Reason: reason, Until: time.Now().Add(duration)})
+	peers.Remove(address)
+	addressBook.Remove(address)
+	logger.Warn("Peer banned", "peer", address, "duration", duration, "reason", reason)
+}
+
+// Returns offence for an error from adding a block, empty if the peer isn't at fault.
+// Blocks not linking to the tip aren't offences, an honest peer on another fork sends them too.
+func blockOffence(err error) string {
+	switch {
+	case err == nil, errors.Is(err, block.ErrKnownBlock), errors.Is(err, block.ErrPrevHashMismatch):
+		return ""
+	default:
+		return offenceInvalidBlock
+	}
+}
+
+// Allows requests only from the loopback interface
+func requireLocalhost(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host, _, err := net.SplitHostPort(r.RemoteAddr)
+			if ip := net.ParseIP(host); err != nil || ip == nil || !ip.IsLoopback() {
+				logger.Warn("Rejected admin request", "remote", r.RemoteAddr)
+				_ = encode(w, r, http.StatusForbidden, ErrorData{Error: "Admin API is only available from localhost"})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Defines the JSON body for GET /admin/peers response
+type AdminPeersData struct {
+	Peers []Peer `json:"peers"`
+	Bans  []Ban  `json:"bans"`
+}
+
+// Returns peers with their scores and active bans.
+// Route: GET /admin/peers
+func handleAdminPeers(logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Info("Request", "route", "GET /admin/peers")
+
+			list := peers.List()
+			now := time.Now()
+			for i := range list {
+				list[i].Score = decayedScore(list[i].Score, list[i].ScoreUpdated, now, banPolicy.HalfLife)
+			}
+			_ = encode(w, r, http.StatusOK, AdminPeersData{Peers: list, Bans: banList.List()})
+		},
+	)
+}
+
+// Defines the JSON body for POST /admin/ban request
+type BanRequestData struct {
+	Address  string `json:"address"`
+	Duration string `json:"duration"`
+	Reason   string `json:"reason"`
+}
+
+// Bans node for the given duration, or the default ban duration.
+// Route: POST /admin/ban
+func handleAdminBan(logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Info("Request", "route", "POST /admin/ban")
+
+			data, err := decode[BanRequestData](r)
+
+			if err != nil || validateNodeAddr(data.Address) != nil {
+				_ = encode(w, r, http.StatusBadRequest, ErrorData{Error: "Invalid request body"})
+				return
+			}
+
+			duration := banPolicy.Duration
+			if data.Duration != "" {
+				duration, err = time.ParseDuration(data.Duration)
+				if err != nil || duration <= 0 {
+					_ = encode(w, r, http.StatusBadRequest, ErrorData{Error: "Invalid ban duration"})
+					return
+				}
+			}
+			if data.Reason == "" {
+				data.Reason = "Banned by operator"
+			}
+
+			banPeer(logger, data.Address, data.Reason, duration)
+			_ = encode(w, r, http.StatusOK, AdminPeersData{Peers: peers.List(), Bans: banList.List()})
+		},
+	)
+}
+
+// Defines the JSON body for POST /admin/unban request
+type UnbanRequestData struct {
+	Address string `json:"address"`
+}
+
+// Removes ban of the node.
+// Route: POST /admin/unban
+func handleAdminUnban(logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Info("Request", "route", "POST /admin/unban")
+
+			data, err := decode[UnbanRequestData](r)
+
+			if err != nil {
+				_ = encode(w, r, http.StatusBadRequest, ErrorData{Error: "Invalid request body"})
+				return
+			}
+
+			if !banList.Unban(data.Address) {
+				_ = encode(w, r, http.StatusNotFound, ErrorData{Error: fmt.Sprintf("Node %v is not banned", data.Address)})
+				return
+			}
+			logger.Info("Peer unbanned", "peer", data.Address)
+			_ = encode(w, r, http.StatusOK, AdminPeersData{Peers: peers.List(), Bans: banList.List()})
+		},
+	)
+}
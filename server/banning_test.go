@@ -0,0 +1,161 @@
+package server
+
+import (
+	"GoChain/block"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Calls penalizePeer until the score reaches the threshold, checking that the peer is banned and removed
+func TestPenalizePeerBans(t *testing.T) {
+	peers = NewPeerSet()
+	banList = NewBanList()
+	peers.Add("node1:8001", "id1")
+	logger := slog.New(slog.DiscardHandler)
+
+	penalizePeer(logger, "node1:8001", offenceInvalidBlock)
+	if banList.IsBanned("node1:8001", "") {
+		t.Fatal("Peer banned below the threshold")
+	}
+
+	penalizePeer(logger, "node1:8001", offenceInvalidChain)
+	if !banList.IsBanned("node1:8001", "") || !banList.IsBanned("other:8001", "id1") {
+		t.Error("Peer not banned by address and node ID at the threshold")
+	}
+	if peers.Contains("node1:8001") {
+		t.Error("Banned peer is still in the peer set")
+	}
+}
+
+// Sends malformed POST /gossip requests naming a known peer in Node-Addr without a client certificate,
+// checking that the client IP is banned instead of the named peer
+func TestPenalizeUnprovenSender(t *testing.T) {
+	peers = NewPeerSet()
+	banList = NewBanList()
+	banPolicy = BanPolicy{Threshold: defaultBanThreshold, Duration: defaultBanDuration, HalfLife: defaultScoreHalfLife}
+	unprovenScores = &hostScores{scores: make(map[string]hostScore)}
+	peers.Add("node1:8001", "id1")
+	logger := slog.New(slog.DiscardHandler)
+	handler := checkIfNodeRecognised(logger)(handleGossip(logger))
+
+	send := func() int {
+		req := httptest.NewRequest("POST", "/gossip", strings.NewReader("{"))
+		req.Header.Set("Node-Addr", "node1:8001")
+		req.Header.Set("Node-ID", "id1")
+		req.RemoteAddr = "192.0.2.7:4000"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	// Scores decay between requests, so one more than threshold / weight
+	for range defaultBanThreshold/offenceWeights[offenceDecodeFailure] + 1 {
+		send()
+	}
+
+	if peer, _ := peers.Get("node1:8001"); banList.IsBanned("node1:8001", "id1") || peer.Score != 0 {
+		t.Errorf("Peer named in Node-Addr was penalised: %+v", peer)
+	}
+	if !banList.IsBanned("192.0.2.7", "") {
+		t.Fatal("Client IP not banned at the threshold")
+	}
+	if code := send(); code != http.StatusForbidden {
+		t.Errorf("Status of a banned client = %v, want %v", code, http.StatusForbidden)
+	}
+}
+
+// Calls decayedScore after one half life, checking that the score is halved
+func TestDecayedScore(t *testing.T) {
+	now := time.Now()
+
+	score := decayedScore(80, now.Add(-time.Hour), now, time.Hour)
+
+	if score != 40 {
+		t.Errorf("decayedScore() = %v, want 40", score)
+	}
+}
+
+// Calls BanList.IsBanned with an expired ban, checking that it is ignored
+func TestBanListExpired(t *testing.T) {
+	list := NewBanList()
+	list.Ban(Ban{Address: "node1:8001", Until: time.Now().Add(-time.Second)})
+
+	if list.IsBanned("node1:8001", "") {
+		t.Error("IsBanned() returned true for an expired ban")
+	}
+}
+
+// Calls blockOffence with block errors, checking the offence mapping
+func TestBlockOffence(t *testing.T) {
+	cases := map[error]string{
+		nil:                       "",
+		block.ErrKnownBlock:       "",
+		block.ErrPrevHashMismatch: "",
+		errors.New("bad hash"):    offenceInvalidBlock,
+	}
+
+	for err, want := range cases {
+		if got := blockOffence(err); got != want {
+			t.Errorf("blockOffence(%v) = %q, want %q", err, got, want)
+		}
+	}
+}
+
+// Sends request from a banned node, checking that it is rejected
+func TestCheckIfNodeRecognisedBanned(t *testing.T) {
+	banList = NewBanList()
+	banList.Ban(Ban{Address: "node1:8001", Until: time.Now().Add(time.Hour)})
+	handler := checkIfNodeRecognised(slog.New(slog.DiscardHandler))(http.NotFoundHandler())
+	req := httptest.NewRequest("GET", "/chain", nil)
+	req.Header.Set("Node-Addr", "node1:8001")
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Status = %v, want %v", rec.Code, http.StatusForbidden)
+	}
+}
+
+// Sends admin request from a remote address, checking that it is rejected
+func TestRequireLocalhost(t *testing.T) {
+	handler := requireLocalhost(slog.New(slog.DiscardHandler))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	remote := httptest.NewRequest("GET", "/admin/peers", nil)
+	remote.RemoteAddr = "192.0.2.1:1234"
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, remote)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Remote status = %v, want %v", rec.Code, http.StatusForbidden)
+	}
+
+	local := httptest.NewRequest("GET", "/admin/peers", nil)
+	local.RemoteAddr = "127.0.0.1:1234"
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, local)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Local status = %v, want %v", rec.Code, http.StatusOK)
+	}
+}
+
+// Sends POST /admin/ban and POST /admin/unban, checking that the ban is added and removed
+func TestHandleAdminBanUnban(t *testing.T) {
+	banList = NewBanList()
+	logger := slog.New(slog.DiscardHandler)
+
+	rec := httptest.NewRecorder()
+	handleAdminBan(logger).ServeHTTP(rec, httptest.NewRequest("POST", "/admin/ban", strings.NewReader(`{"address": "node1:8001", "duration": "1h"}`)))
+	if rec.Code != http.StatusOK || !banList.IsBanned("node1:8001", "") {
+		t.Fatalf("POST /admin/ban = %v, node not banned", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handleAdminUnban(logger).ServeHTTP(rec, httptest.NewRequest("POST", "/admin/unban", strings.NewReader(`{"address": "node1:8001"}`)))
+	if rec.Code != http.StatusOK || banList.IsBanned("node1:8001", "") {
+		t.Errorf("POST /admin/unban = %v, node still banned", rec.Code)
+	}
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Reads string environment variable, returning def if it is unset
+func envString(name string, def string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return def
+}
+
+// Reads integer environment variable, returning def if it is unset or invalid
+func envInt(name string, def int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		slog.Warn("Invalid environment value, using default", "name", name, "value", value, "default", def)
+		return def
+	}
+	return n
+}
+
+// Reads duration environment variable, returning def if it is unset or invalid
+func envDuration(name string, def time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		slog.Warn("Invalid environment value, using default", "name", name, "value", value, "default", def)
+		return def
+	}
+	return d
+}
+
+// Reads boolean environment variable, returning def if it is unset or invalid
+func envBool(name string, def bool) bool {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		slog.Warn("Invalid environment value, using default", "name", name, "value", value, "default", def)
+		return def
+	}
+	return b
+}
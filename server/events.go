@@ -0,0 +1,299 @@
+package server
+
+import (
+	"GoChain/block"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of events pushed to clients
+const (
+	eventNewTip       = "new-tip"
+	eventReorg        = "reorg"
+	eventMempoolEntry = "mempool-entry"
+	eventPeerJoin     = "peer-join"
+	eventPeerLeave    = "peer-leave"
+)
+
+// All event kinds, used when the client doesn't filter
+var eventTypes = []string{eventNewTip, eventReorg, eventMempoolEntry, eventPeerJoin, eventPeerLeave}
+
+// Events buffered per subscriber, a subscriber falling further behind is disconnected
+const eventBufferSize = 64
+
+// Interval of keepalive messages on idle streams
+const eventKeepAlive = 15 * time.Second
+
+// Event pushed to clients over GET /events and GET /ws
+type Event struct {
+	Type   string    `json:"type"`
+	Height int       `json:"height"`
+	Time   time.Time `json:"time"`
+	Data   any       `json:"data"`
+}
+
+// Defines data of reorg event
+type ReorgData struct {
+	ForkHeight int    `json:"forkHeight"`
+	OldTip     string `json:"oldTip"`
+	NewTip     string `json:"newTip"`
+}
+
+// Defines data of mempool-entry event
+type MempoolEntryData struct {
+	Data string `json:"data"`
+}
+
+// Receives events of the subscribed types
+type subscriber struct {
+	types  []string
+	events chan Event
+	// Closed when the subscriber fell behind and was dropped
+	dropped chan struct{}
+}
+
+// Fans out node events to subscribed clients
+type EventBus struct {
+	mu          sync.Mutex
+	subscribers map[*subscriber]struct{}
+}
+
+// Events of the node
+var events = NewEventBus()
+
+// Creates event bus without subscribers
+func NewEventBus() *EventBus {
+	return &EventBus{subscribers: make(map[*subscriber]struct{})}
+}
+
+// Subscribes to events of the types
+func (b *EventBus) Subscribe(types []string) *subscriber {
+	s := &subscriber{types: types, events: make(chan Event, eventBufferSize), dropped: make(chan struct{})}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.subscribers[s] = struct{}{}
+	return s
+}
+
+// Removes subscriber
+func (b *EventBus) Unsubscribe(s *subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.subscribers, s)
+}
+
+// Sends event to subscribers of its type without blocking.
+// Subscribers with full buffers are dropped and can resume from their last height.
+func (b *EventBus) Publish(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for s := range b.subscribers {
+		if !slices.Contains(s.types, event.Type) {
+			continue
+		}
+		select {
+		case s.events <- event:
+		default:
+			delete(b.subscribers, s)
+			close(s.dropped)
+		}
+	}
+}
+
+// Publishes new-tip event for the block
+func publishNewTip(b block.Block) {
+	events.Publish(Event{Type: eventNewTip, Height: b.Index, Data: b})
+}
+
+// Publishes events for a chain replacing the old one.
+// Reorg is reported if the old tip is not part of the new chain.
+func publishChainReplaced(old []block.Block, chain []block.Block) {
+	if len(chain) == 0 {
+		return
+	}
+
+	fork := 0
+	for fork < len(old) && fork < len(chain) && old[fork].Hash == chain[fork].Hash {
+		fork++
+	}
+	if fork < len(old) {
+		metrics.reorgs.Inc()
+		metrics.reorgDepth.Observe(float64(len(old) - fork))
+		events.Publish(Event{
+			Type:   eventReorg,
+			Height: chain[len(chain)-1].Index,
+			Data:   ReorgData{ForkHeight: fork, OldTip: old[len(old)-1].Hash, NewTip: chain[len(chain)-1].Hash},
+		})
+	}
+	for _, b := range chain[fork:] {
+		publishNewTip(b)
+	}
+}
+
+// Returns event types requested with the types query parameter, all types if empty
+func parseEventTypes(r *http.Request) ([]string, error) {
+	value := r.URL.Query().Get("types")
+	if value == "" {
+		return eventTypes, nil
+	}
+
+	types := []string{}
+	for _, t := range strings.Split(value, ",") {
+		t = strings.TrimSpace(t)
+		if !slices.Contains(eventTypes, t) {
+			return nil, fmt.Errorf("Unknown event type %q", t)
+		}
+		types = append(types, t)
+	}
+	return types, nil
+}
+
+// Returns height to resume from, given by the since query parameter or the Last-Event-ID header.
+// Returns -1 if the client doesn't resume.
+func parseResumeHeight(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("since")
+	if value == "" {
+		value = r.Header.Get("Last-Event-ID")
+	}
+	if value == "" {
+		return -1, nil
+	}
+	height, err := strconv.Atoi(value)
+	if err != nil || height < 0 {
+		return 0, fmt.Errorf("Invalid resume height %q", value)
+	}
+	return height, nil
+}
+
+// Stream of events for one client.
+// Blocks above the resume height are replayed as new-tip events before live events,
+// and live new-tip events for replayed blocks are skipped.
+type eventStream struct {
+	sub      *subscriber
+	replay   []Event
+	replayed map[string]bool
+}
+
+// Subscribes to events and prepares replay of blocks above the resume height
+func openEventStream(types []string, since int) *eventStream {
+	stream := &eventStream{sub: events.Subscribe(types), replayed: make(map[string]bool)}
+
+	if since >= 0 && slices.Contains(types, eventNewTip) {
+		for _, b := range block.GetBlockchain() {
+			if b.Index > since {
+				stream.replay = append(stream.replay, Event{Type: eventNewTip, Height: b.Index, Time: time.Now(), Data: b})
+				stream.replayed[b.Hash] = true
+			}
+		}
+	}
+	return stream
+}
+
+// Returns next event.
+// ok is false when it is time for a keepalive, open is false once done is closed or the client fell behind.
+func (s *eventStream) next(done <-chan struct{}, keepAlive <-chan time.Time) (Event, bool, bool) {
+	if len(s.replay) > 0 {
+		event := s.replay[0]
+		s.replay = s.replay[1:]
+		return event, true, true
+	}
+
+	for {
+		select {
+		case <-done:
+			return Event{}, false, false
+		case <-s.sub.dropped:
+			return Event{}, false, false
+		case <-keepAlive:
+			return Event{}, false, true
+		case event := <-s.sub.events:
+			if b, ok := event.Data.(block.Block); ok && event.Type == eventNewTip && s.replayed[b.Hash] {
+				continue
+			}
+			return event, true, true
+		}
+	}
+}
+
+func (s *eventStream) close() {
+	events.Unsubscribe(s.sub)
+}
+
+// Streams events as Server-Sent Events.
+// Query parameters: types filters by comma separated event types,
+// since replays blocks above the height, also taken from Last-Event-ID on reconnect.
+// Route: GET /events
+func handleEvents(logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Info("Request", "route", "GET /events")
+
+			types, err := parseEventTypes(r)
+			if err != nil {
+				_ = encode(w, r, http.StatusBadRequest, ErrorData{Error: err.Error()})
+				return
+			}
+			since, err := parseResumeHeight(r)
+			if err != nil {
+				_ = encode(w, r, http.StatusBadRequest, ErrorData{Error: err.Error()})
+				return
+			}
+
+			flusher, ok := w.(http.Flusher)
+			if !ok {
+				_ = encode(w, r, http.StatusInternalServerError, ErrorData{Error: "Streaming is not supported"})
+				return
+			}
+
+			stream := openEventStream(types, since)
+			defer stream.close()
+
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.WriteHeader(http.StatusOK)
+			flusher.Flush()
+
+			ticker := time.NewTicker(eventKeepAlive)
+			defer ticker.Stop()
+
+			for {
+				event, ok, open := stream.next(r.Context().Done(), ticker.C)
+				if !open {
+					return
+				}
+				if !ok {
+					fmt.Fprint(w, ": keepalive\n\n")
+					flusher.Flush()
+					continue
+				}
+
+				data, err := json.Marshal(event)
+				if err != nil {
+					logger.Error("Failed to encode event", "event", event.Type, "err", err)
+					continue
+				}
+				// New tips carry their height as ID, so reconnecting clients resume after it
+				if event.Type == eventNewTip {
+					fmt.Fprintf(w, "id: %d\n", event.Height)
+				}
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+				flusher.Flush()
+			}
+		},
+	)
+}
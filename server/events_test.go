@@ -0,0 +1,165 @@
+package server
+
+import (
+	"GoChain/block"
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Waits until the event bus has n subscribers or a second passes
+func waitForSubscribers(n int) {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		events.mu.Lock()
+		count := len(events.subscribers)
+		events.mu.Unlock()
+		if count >= n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// Publishes events of two types, checking that the subscriber only gets the filtered type
+func TestEventBusFilter(t *testing.T) {
+	bus := NewEventBus()
+	sub := bus.Subscribe([]string{eventPeerJoin})
+
+	bus.Publish(Event{Type: eventNewTip})
+	bus.Publish(Event{Type: eventPeerJoin})
+
+	if event := <-sub.events; event.Type != eventPeerJoin || len(sub.events) != 0 {
+		t.Errorf("Received %v with %v more, want only peer-join", event.Type, len(sub.events))
+	}
+}
+
+// Publishes more events than the buffer holds, checking that the subscriber is dropped
+func TestEventBusDropsSlowSubscriber(t *testing.T) {
+	bus := NewEventBus()
+	sub := bus.Subscribe(eventTypes)
+
+	for i := 0; i <= eventBufferSize; i++ {
+		bus.Publish(Event{Type: eventNewTip, Height: i})
+	}
+
+	select {
+	case <-sub.dropped:
+	default:
+		t.Error("Slow subscriber was not dropped")
+	}
+}
+
+// Calls publishChainReplaced with a diverging chain, checking that reorg and new tips are published
+func TestPublishChainReplacedReorg(t *testing.T) {
+	sub := events.Subscribe(eventTypes)
+	defer events.Unsubscribe(sub)
+
+	old := []block.Block{{Index: 0, Hash: "g"}, {Index: 1, Hash: "a"}}
+	chain := []block.Block{{Index: 0, Hash: "g"}, {Index: 1, Hash: "b"}, {Index: 2, Hash: "c"}}
+	publishChainReplaced(old, chain)
+
+	reorg := <-sub.events
+	data, ok := reorg.Data.(ReorgData)
+	if reorg.Type != eventReorg || !ok || data.ForkHeight != 1 || data.OldTip != "a" || data.NewTip != "c" {
+		t.Errorf("First event = %+v, want reorg from a to c at height 1", reorg)
+	}
+	if first, second := <-sub.events, <-sub.events; first.Height != 1 || second.Height != 2 {
+		t.Errorf("New tips at heights %v and %v, want 1 and 2", first.Height, second.Height)
+	}
+}
+
+// Calls parseEventTypes with an unknown type, checking that it is rejected
+func TestParseEventTypesUnknown(t *testing.T) {
+	req := httptest.NewRequest("GET", "/events?types=new-tip,other", nil)
+
+	if _, err := parseEventTypes(req); err == nil {
+		t.Error("parseEventTypes() accepted an unknown type")
+	}
+}
+
+// Opens GET /events resuming from genesis, checking that later blocks are replayed with their height as ID
+func TestHandleEventsResume(t *testing.T) {
+	if len(block.GetBlockchain()) < 1 {
+		if err := block.CreateGenesisBlock(); err != nil {
+			t.Fatalf("CreateGenesisBlock() returned an error: %v", err)
+		}
+	}
+	if len(block.GetBlockchain()) < 2 {
+		block.AddBlockToChain(block.GreateBlock("events test"))
+	}
+
+	srv := httptest.NewServer(handleEvents(slog.New(slog.DiscardHandler)))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL+"/events?types=new-tip", nil)
+	req.Header.Set("Last-Event-ID", "0")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /events returned an error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	reader := bufio.NewReader(resp.Body)
+	id, _ := reader.ReadString('\n')
+	eventLine, _ := reader.ReadString('\n')
+
+	if id != "id: 1\n" || eventLine != "event: new-tip\n" {
+		t.Errorf("First event lines = %q, %q, want id 1 and new-tip", id, eventLine)
+	}
+}
+
+// Opens GET /ws and publishes a peer event, checking the handshake and the pushed message
+func TestHandleWebSocket(t *testing.T) {
+	srv := httptest.NewServer(handleWebSocket(slog.New(slog.DiscardHandler)))
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatalf("Dial() returned an error: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Second))
+
+	io.WriteString(conn, "GET /ws?types=peer-join HTTP/1.1\r\nHost: test\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n")
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil || resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Handshake response = %+v, %v, want 101 with RFC 6455 accept key", resp, err)
+	}
+
+	waitForSubscribers(1)
+	events.Publish(Event{Type: eventPeerJoin, Data: PeerAnnouncement{Address: "node1:8001"}})
+
+	head := make([]byte, 2)
+	io.ReadFull(reader, head)
+	length := int(head[1])
+	if length == 126 {
+		ext := make([]byte, 2)
+		io.ReadFull(reader, ext)
+		length = int(binary.BigEndian.Uint16(ext))
+	}
+	payload := make([]byte, length)
+	io.ReadFull(reader, payload)
+
+	var event struct {
+		Type string           `json:"type"`
+		Data PeerAnnouncement `json:"data"`
+	}
+	if head[0] != 0x80|wsOpText || json.Unmarshal(payload, &event) != nil || event.Type != eventPeerJoin || event.Data.Address != "node1:8001" {
+		t.Errorf("Frame %x with %s, want text frame with peer-join of node1:8001", head[0], payload)
+	}
+}
@@ -2,17 +2,15 @@ package server
 
 import (
 	"GoChain/block"
+	"GoChain/client"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
-	"maps"
-	"math"
-	"math/rand"
+	"log/slog"
 	"net/http"
 	"os"
-	"slices"
 	"strings"
 )
 
@@ -33,183 +31,98 @@ func decodeResponse[T any](body io.ReadCloser) (T, error) {
 	return v, nil
 }
 
-// Checks nodes to make sure they are alive
-func checkNodes(logger *log.Logger) {
-
-	// Initialise local address
+// Returns the address this node listens on and advertises to peers
+func localAddress() string {
 	localAddr := strings.Join(strings.Split(os.Getenv("LOCAL_ADDR"), ","), "")
 	if len(localAddr) < 1 || localAddr == "" {
 		localAddr = "0.0.0.0:8001"
-		log.Println("Local address setup from .env failed, using default value")
-	}
-
-	knownNodes := slices.Collect(maps.Keys(nodes))
-	checkLimit := int(math.RoundToEven(math.Sqrt(float64(len(knownNodes)))))
-
-	nodesToCheck := []string{}
-
-	for {
-		// Loop as long is needed
-		if len(nodesToCheck) == checkLimit {
-			break
-		}
-
-		randInt := rand.Intn(len(knownNodes))
-
-		if !slices.Contains(nodesToCheck, knownNodes[randInt]) {
-			nodesToCheck = append(nodesToCheck, knownNodes[randInt])
-		}
-	}
-	logger.Printf("Nodes to check: %v", nodesToCheck)
-
-	for _, s := range nodesToCheck {
-		func() {
-			url := "http://" + s + "/ping"
-
-			req, err := http.NewRequest("GET", url, nil)
-
-			if err != nil {
-				logger.Printf("Failed to create request for node %v: %v\n", s, err)
-				return
-			}
-
-			req.Header.Set("Content-Type", "application/json")
-			req.Header.Set("Node-Addr", localAddr)
-
-			client := &http.Client{}
-
-			resp, err := client.Do(req)
-
-			if err != nil {
-				logger.Printf("Error connecting to host: %v, %v", s, err)
-				removeNode(s)
-				return
-			}
-
-			defer resp.Body.Close()
-
-			if resp.StatusCode != http.StatusOK {
-				logger.Printf("Unexpected response: %v, from %v", resp.StatusCode, s)
-			}
-
-			/*data, decodeErr := decodeResponse[GetPingData](resp.Body)
-
-			if decodeErr != nil {
-				logger.Printf("Error decoding %v GET /ping: %v", s, decodeErr)
-			}*/
-
-		}()
+		slog.Warn("Local address setup from .env failed, using default value", "address", localAddr)
 	}
-
+	return localAddr
 }
 
-func getNodes(bootstrapNode string) error {
-
-	// Initialise local address
-	localAddr := strings.Join(strings.Split(os.Getenv("LOCAL_ADDR"), ","), "")
-	if len(localAddr) < 1 || localAddr == "" {
-		localAddr = "0.0.0.0:8001"
-		log.Println("Local address setup from .env failed, using default value")
-	}
-
-	url := "http://" + bootstrapNode + "/nodes"
-
-	req, err := http.NewRequest("GET", url, nil)
-
-	if err != nil {
-		return fmt.Errorf("Failed to create request for node %v: %v\n", bootstrapNode, err)
+// Sets headers identifying this node on a request to a peer
+// and the trace context of the request, if any
+func setPeerHeaders(req *http.Request) {
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Node-Addr", localAddress())
+	req.Header.Set("Node-ID", identity.ID)
+	if value := traceParent(req.Context()); value != "" {
+		req.Header.Set(traceParentHeader, value)
 	}
+}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Node-Addr", localAddr)
+// Returns API client of the peer sending requests through the shared peer client,
+// which already retries failed reads
+func peerAPI(address string) *client.Client {
+	return client.New(peerURL(address, ""), client.Config{
+		Transport:      peerClient,
+		Retries:        -1,
+		PrepareRequest: setPeerHeaders,
+	})
+}
 
-	client := &http.Client{}
+func getNodes(ctx context.Context, bootstrapNode string) error {
 
-	resp, err := client.Do(req)
+	nodes, err := peerAPI(bootstrapNode).Peers(ctx)
 
 	if err != nil {
-		return fmt.Errorf("Error connecting to host: %v, %v", bootstrapNode, err)
-	}
-
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("Unexpected response: %v, from %v", resp.StatusCode, bootstrapNode)
+		return fmt.Errorf("Failed to get nodes from %v: %w", bootstrapNode, err)
 	}
 
-	addNode(bootstrapNode)
-
-	data, decodeErr := decodeResponse[GetNodesData](resp.Body)
-
-	if decodeErr != nil {
-		return fmt.Errorf("Error decoding GET /nodes: %v,", decodeErr)
+	if err := connectPeer(bootstrapNode); err != nil {
+		return err
 	}
 
-	if len(data.Data) > 0 {
-		for _, node := range data.Data {
-			addNode(node)
+	for _, node := range nodes {
+		if node.Address == localAddress() || peers.Contains(node.Address) {
+			continue
+		}
+		if err := connectPeer(node.Address); err != nil {
+			slog.Info("Peer not connected", "peer", node.Address, "err", err)
 		}
 	}
 
 	return nil
 }
 
-func getChain(bootstrapNode string) error {
+func getChain(ctx context.Context, bootstrapNode string) error {
 
-	// Initialise local address
-	localAddr := strings.Join(strings.Split(os.Getenv("LOCAL_ADDR"), ","), "")
-	if len(localAddr) < 1 || localAddr == "" {
-		localAddr = "0.0.0.0:8001"
-		log.Println("Local address setup from .env failed, using default value")
-	}
-
-	url := "http://" + bootstrapNode + "/chain"
-
-	req, err := http.NewRequest("GET", url, nil)
-
-	if err != nil {
-		return fmt.Errorf("Failed to create request for node %v: %v\n", bootstrapNode, err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Node-Addr", localAddr)
-
-	client := &http.Client{}
-
-	resp, err := client.Do(req)
+	chain, err := peerAPI(bootstrapNode).Blocks(ctx)
 
 	if err != nil {
-		return fmt.Errorf("Error connecting to host: %v, %v", bootstrapNode, err)
-	}
-
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("Unexpected response: %v, from %v", resp.StatusCode, bootstrapNode)
+		return fmt.Errorf("Failed to get chain from %v: %w", bootstrapNode, err)
 	}
 
-	data, decodeErr := decodeResponse[GetChainData](resp.Body)
-
-	if decodeErr != nil {
-		return fmt.Errorf("Error decoding GET /chain: %v,", decodeErr)
+	if _, err := block.IsChainValid(chain); err != nil {
+		penalizePeer(slog.Default(), bootstrapNode, offenceInvalidChain)
+		return fmt.Errorf("Invalid chain from %v: %w", bootstrapNode, err)
 	}
 
-	if len(data.Data) > 0 {
-		block.SetBlockchain(data.Data)
+	old := block.GetBlockchain()
+	if len(chain) > len(old) {
+		block.SetBlockchain(chain)
+		publishChainReplaced(old, chain)
 	}
 
 	return nil
 }
 
 // Synchronises current node chain and nodes list with bootstrap node
-func syncNode(bootstrapNode string) error {
-
-	nodeErr := getNodes(bootstrapNode)
+func syncNode(ctx context.Context, bootstrapNode string) (err error) {
+	ctx, span := tracer.Start(ctx, spanSync, spanClient, "peer", bootstrapNode)
+	defer func() {
+		span.SetAttributes("height", len(block.GetBlockchain()))
+		span.SetError(err)
+		span.End()
+	}()
+
+	nodeErr := getNodes(ctx, bootstrapNode)
 	if nodeErr != nil {
 		return nodeErr
 	}
 
-	chainErr := getChain(bootstrapNode)
+	chainErr := getChain(ctx, bootstrapNode)
 	if chainErr != nil {
 		return chainErr
 	}
@@ -218,51 +131,10 @@ func syncNode(bootstrapNode string) error {
 
 }
 
-// Distributes mined block amongst known peers
-func shareMinedBlock(logger *log.Logger, block block.Block) {
-
-	// Initialise local address
-	localAddr := strings.Join(strings.Split(os.Getenv("LOCAL_ADDR"), ","), "")
-	if len(localAddr) < 1 || localAddr == "" {
-		localAddr = "0.0.0.0:8001"
-		log.Println("Local address setup from .env failed, using default value")
+// Queues mined block for broadcast to known peers, returning without waiting for delivery.
+// Broadcast continues the trace carried by ctx.
+func shareMinedBlock(ctx context.Context, logger *slog.Logger, block block.Block) {
+	if err := gossiper.Publish(ctx, gossipBlock, block.Hash, block); err != nil {
+		logger.Error("Failed to share block", "block_hash", block.Hash, "err", err)
 	}
-
-	for node := range nodes {
-		body, encodeErr := encodeRequest(ReceiveBlockData{Data: block})
-
-		if encodeErr != nil {
-			logger.Printf("Failed to encode payload: %v\n", encodeErr)
-			continue
-		}
-
-		url := "http://" + node + "/receive-block"
-
-		req, err := http.NewRequest("POST", url, body)
-
-		if err != nil {
-			logger.Printf("Failed to create request for node %v: %v\n", node, err)
-			continue
-
-		}
-
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("Node-Addr", localAddr)
-
-		client := &http.Client{}
-
-		resp, err := client.Do(req)
-
-		if err != nil {
-			logger.Printf("Block sharing on node %v failed: %v\n", node, err)
-			continue
-		}
-
-		defer resp.Body.Close()
-
-		if resp.StatusCode != http.StatusOK {
-			fmt.Printf("HTTP request code on node %v: %v\n", node, resp.StatusCode)
-		}
-	}
-
 }
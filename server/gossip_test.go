@@ -1,7 +1,13 @@
 package server
 
 import (
+	"GoChain/block"
+	"GoChain/client"
+	"context"
 	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 )
@@ -66,7 +72,7 @@ func TestDecodeResponseEmptyInput(t *testing.T) {
 func TestGetNodesCantConnect(t *testing.T) {
 
 	bootstrapNode := "http://127.0.0.1:8888"
-	err := getNodes(bootstrapNode)
+	err := getNodes(context.Background(), bootstrapNode)
 
 	if err == nil {
 		t.Error("getNodes() didn't return any errors")
@@ -77,7 +83,7 @@ func TestGetNodesCantConnect(t *testing.T) {
 func TestGetChainCantConnect(t *testing.T) {
 
 	bootstrapNode := "http://127.0.0.1:8888"
-	err := getChain(bootstrapNode)
+	err := getChain(context.Background(), bootstrapNode)
 
 	if err == nil {
 		t.Error("getChain() didn't return any errors")
@@ -88,9 +94,44 @@ func TestGetChainCantConnect(t *testing.T) {
 func TestSyncNodeCantConnect(t *testing.T) {
 
 	bootstrapNode := "http://127.0.0.1:8888"
-	err := getChain(bootstrapNode)
+	err := getChain(context.Background(), bootstrapNode)
 
 	if err == nil {
 		t.Error("syncNode() didn't return any errors")
 	}
 }
+
+// Calls the node routes with the client package, checking that the client decodes every response
+func TestClientAgainstRoutes(t *testing.T) {
+	ensureGenesis(t)
+	mux := http.NewServeMux()
+	addRoutes(mux, slog.New(slog.DiscardHandler))
+	node := httptest.NewServer(mux)
+	defer node.Close()
+
+	ctx := context.Background()
+	c := client.New(node.URL, client.Config{})
+
+	mined, err := c.Submit(ctx, "client")
+	if err != nil || mined.Data != "client" {
+		t.Fatalf("Submit() = %+v, %v, want block with data client", mined, err)
+	}
+	if tip, err := c.Tip(ctx); err != nil || tip.Hash != mined.Hash {
+		t.Errorf("Tip() = %+v, %v, want mined block", tip, err)
+	}
+	if b, err := c.BlockByIndex(ctx, mined.Index); err != nil || b.Hash != mined.Hash {
+		t.Errorf("BlockByIndex(%v) = %+v, %v, want mined block", mined.Index, b, err)
+	}
+	if chain, err := c.Blocks(ctx); err != nil || len(chain) != len(block.GetBlockchain()) {
+		t.Errorf("Blocks() = %v blocks, %v, want %v", len(chain), err, len(block.GetBlockchain()))
+	}
+	if status, err := c.Status(ctx); err != nil || status.NodeID != identity.ID {
+		t.Errorf("Status() = %+v, %v, want node ID %v", status, err, identity.ID)
+	}
+	if _, err := c.Peers(ctx); err != nil {
+		t.Errorf("Peers() returned an error: %v", err)
+	}
+	if b, err := c.WaitForInclusion(ctx, mined.Hash, 0); err != nil || b.Hash != mined.Hash {
+		t.Errorf("WaitForInclusion() = %+v, %v, want mined block", b, err)
+	}
+}
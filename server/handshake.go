@@ -0,0 +1,190 @@
+package server
+
+import (
+	"GoChain/block"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+)
+
+// Oldest protocol version this node can talk to
+const minProtocolVersion = 1
+
+// Protocol features this node supports, negotiated in the handshake
+var localCapabilities = []string{}
+
+// Defines the JSON body for POST /handshake request and response.
+// Height is the index of the chain tip, see chainHeight.
+type HandshakeData struct {
+	ProtocolVersion int      `json:"protocolVersion"`
+	ChainID         string   `json:"chainId"`
+	NodeID          string   `json:"nodeId"`
+	Address         string   `json:"address"`
+	Height          int      `json:"height"`
+	Capabilities    []string `json:"capabilities"`
+	WireAddress     string   `json:"wireAddress,omitempty"`
+}
+
+// Defines the JSON body for error responses
+type ErrorData struct {
+	Error string `json:"error"`
+}
+
+// Returns the ID of the chain this node follows, the genesis block hash.
+// Empty while the node has no chain yet.
+func chainID() string {
+	chain := block.GetBlockchain()
+	if len(chain) < 1 {
+		return ""
+	}
+	return chain[0].Hash
+}
+
+// Returns handshake describing this node
+func localHandshake() HandshakeData {
+	return HandshakeData{
+		ProtocolVersion: protocolVersion,
+		ChainID:         chainID(),
+		NodeID:          identity.ID,
+		Address:         localAddress(),
+		Height:          chainHeight(),
+		Capabilities:    localCapabilities,
+		WireAddress:     localWireAddress(),
+	}
+}
+
+// Error returned when remote node is incompatible with this node
+type HandshakeError struct {
+	Status int
+	Reason string
+}
+
+func (e *HandshakeError) Error() string {
+	return e.Reason
+}
+
+// Returns protocol version spoken with a node supporting versions up to remote, the lower of both
+func negotiateVersion(remote int) int {
+	return min(protocolVersion, remote)
+}
+
+// Checks that remote node speaks a supported protocol version on the same chain.
+// Nodes without a chain are still syncing and are accepted.
+func checkHandshake(remote HandshakeData) error {
+	if version := negotiateVersion(remote.ProtocolVersion); version < minProtocolVersion {
+		return &HandshakeError{
+			Status: http.StatusUpgradeRequired,
+			Reason: fmt.Sprintf("Protocol version %v is not supported, minimum is %v", version, minProtocolVersion),
+		}
+	}
+
+	localChainID := chainID()
+	if remote.ChainID != "" && localChainID != "" && remote.ChainID != localChainID {
+		return &HandshakeError{
+			Status: http.StatusConflict,
+			Reason: fmt.Sprintf("Chain ID %v doesn't match this node chain ID %v", remote.ChainID, localChainID),
+		}
+	}
+	return nil
+}
+
+// Returns capabilities supported by both nodes
+func negotiateCapabilities(remote []string) []string {
+	common := []string{}
+	for _, capability := range localCapabilities {
+		if slices.Contains(remote, capability) {
+			common = append(common, capability)
+		}
+	}
+	return common
+}
+
+// Exchanges versions, chain ID and capabilities with a connecting node.
+// Incompatible nodes are refused with the reason in the response.
+// Route: POST /handshake
+func handleHandshake(logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Info("Request", "route", "POST /handshake")
+
+			data, err := decode[HandshakeData](r)
+
+			if err != nil {
+				_ = encode(w, r, http.StatusBadRequest, ErrorData{Error: "Invalid request body"})
+				return
+			}
+
+			if data.NodeID != r.Header.Get("Node-ID") || data.Address != r.Header.Get("Node-Addr") {
+				_ = encode(w, r, http.StatusBadRequest, ErrorData{Error: "Handshake doesn't match Node-ID and Node-Addr headers"})
+				return
+			}
+
+			if err := checkHandshake(data); err != nil {
+				logger.Info("Handshake refused", "peer", data.Address, "err", err)
+				_ = encode(w, r, err.(*HandshakeError).Status, ErrorData{Error: err.Error()})
+				return
+			}
+
+			if err := admitPeer(data.Address, data.NodeID); err != nil {
+				logger.Info("Handshake refused", "peer", data.Address, "err", err)
+				_ = encode(w, r, http.StatusForbidden, ErrorData{Error: fmt.Sprintf("Address verification failed: %v", err)})
+				return
+			}
+
+			peers.RecordHandshake(data.Address, negotiateVersion(data.ProtocolVersion), data.Height, negotiateCapabilities(data.Capabilities))
+			peers.SetWireAddress(data.Address, data.WireAddress)
+			_ = encode(w, r, http.StatusOK, localHandshake())
+		},
+	)
+}
+
+// Performs handshake with the node at address and adds it to known peers
+func connectPeer(address string) error {
+	body, err := encodeRequest(localHandshake())
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", peerURL(address, "/handshake"), body)
+	if err != nil {
+		return fmt.Errorf("Failed to create request for node %v: %v", address, err)
+	}
+	setPeerHeaders(req)
+
+	resp, err := peerClient.DoIdempotent(req)
+	if err != nil {
+		return fmt.Errorf("Error connecting to host: %v, %v", address, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		data, decodeErr := decodeResponse[ErrorData](resp.Body)
+		if decodeErr != nil {
+			return fmt.Errorf("Unexpected response: %v, from %v", resp.StatusCode, address)
+		}
+		return fmt.Errorf("Node %v refused handshake: %v", address, data.Error)
+	}
+
+	data, err := decodeResponse[HandshakeData](resp.Body)
+	if err != nil {
+		return fmt.Errorf("Error decoding POST /handshake: %v", err)
+	}
+
+	if err := checkHandshake(data); err != nil {
+		return fmt.Errorf("Node %v is incompatible: %w", address, err)
+	}
+
+	if nodeTLS != nil && tlsNodeID(resp.TLS) != data.NodeID {
+		return fmt.Errorf("Node %v certificate is not bound to node ID %v", address, data.NodeID)
+	}
+
+	if err := admitPeer(address, data.NodeID); err != nil {
+		return err
+	}
+
+	peers.RecordHandshake(address, negotiateVersion(data.ProtocolVersion), data.Height, negotiateCapabilities(data.Capabilities))
+	peers.SetWireAddress(address, data.WireAddress)
+	peers.MarkOutbound(address)
+	return nil
+}
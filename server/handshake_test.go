@@ -0,0 +1,68 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Calls checkHandshake with an old protocol version, checking that it is refused
+func TestCheckHandshakeOldVersion(t *testing.T) {
+	err := checkHandshake(HandshakeData{ProtocolVersion: minProtocolVersion - 1})
+
+	handshakeErr, ok := err.(*HandshakeError)
+	if !ok || handshakeErr.Status != http.StatusUpgradeRequired {
+		t.Errorf("checkHandshake() = %v, want upgrade required error", err)
+	}
+}
+
+// Calls negotiateVersion and checkHandshake with a newer version, checking that the local version is spoken
+func TestNegotiateVersionNewerNode(t *testing.T) {
+	if version := negotiateVersion(protocolVersion + 1); version != protocolVersion {
+		t.Errorf("negotiateVersion() = %v, want %v", version, protocolVersion)
+	}
+	if err := checkHandshake(HandshakeData{ProtocolVersion: protocolVersion + 1}); err != nil {
+		t.Errorf("checkHandshake() with a newer version returned an error: %v", err)
+	}
+}
+
+// Calls checkHandshake with a node without chain, checking that it is accepted
+func TestCheckHandshakeSyncingNode(t *testing.T) {
+	err := checkHandshake(HandshakeData{ProtocolVersion: protocolVersion, ChainID: ""})
+
+	if err != nil {
+		t.Errorf("checkHandshake() returned an error: %v", err)
+	}
+}
+
+// Calls negotiateCapabilities, checking that only common capabilities are returned
+func TestNegotiateCapabilities(t *testing.T) {
+	saved := localCapabilities
+	defer func() { localCapabilities = saved }()
+	localCapabilities = []string{"a", "b", "c"}
+
+	common := negotiateCapabilities([]string{"c", "a", "z"})
+
+	if !slices.Equal(common, []string{"a", "c"}) {
+		t.Errorf("negotiateCapabilities() = %v, want [a c]", common)
+	}
+}
+
+// Sends POST /handshake with an unsupported version, checking that the reason is returned
+func TestHandleHandshakeRefused(t *testing.T) {
+	handler := handleHandshake(slog.New(slog.DiscardHandler))
+	body := `{"protocolVersion": 0, "nodeId": "abc", "address": "node9:8009"}`
+	req := httptest.NewRequest("POST", "/handshake", strings.NewReader(body))
+	req.Header.Set("Node-ID", "abc")
+	req.Header.Set("Node-Addr", "node9:8009")
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUpgradeRequired || !strings.Contains(rec.Body.String(), "not supported") {
+		t.Errorf("POST /handshake = %v %v, want refusal with reason", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,187 @@
+package server
+
+import (
+	"GoChain/block"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+// Default readiness settings, overridable with READY_MAX_LAG and CATCH_UP_INTERVAL
+const (
+	defaultReadyMaxLag     = 2
+	defaultCatchUpInterval = 30 * time.Second
+)
+
+// Sync states reported by GET /status
+const (
+	// No chain is loaded yet, the node is waiting for a seed
+	syncNoChain = "no-chain"
+	// The chain is more than the allowed lag behind the best peer
+	syncBehind = "syncing"
+	syncDone   = "synced"
+)
+
+// Mining states reported by GET /status
+const (
+	miningIdle   = "idle"
+	miningActive = "mining"
+	miningPause  = "paused"
+)
+
+// Returned by node operations needing a ready node
+var ErrNotReady = errors.New("Node is not ready")
+
+// Blocks the chain may lag behind the best peer while the node is ready, set in NewServer
+var readyMaxLag = defaultReadyMaxLag
+
+// Time the node started, reported as uptime
+var startTime = time.Now()
+
+// Version of the node binary
+var nodeVersion = buildVersion()
+
+// Number of blocks being mined
+var miningJobs atomic.Int32
+
+// Returns module version of the binary, or its VCS revision for development builds
+func buildVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "dev"
+	}
+	if info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" && len(setting.Value) >= 12 {
+			return "dev-" + setting.Value[:12]
+		}
+	}
+	return "dev"
+}
+
+// Defines sync state in the GET /status response
+type SyncStatus struct {
+	State          string `json:"state"`
+	BestPeerHeight int    `json:"bestPeerHeight"`
+}
+
+// Returns sync state of the chain compared with the best peer height
+func syncStatus() SyncStatus {
+	best := peers.BestHeight()
+	return SyncStatus{State: syncState(chainHeight(), best), BestPeerHeight: best}
+}
+
+// Returns sync state of a chain with the height, given the height of the best peer.
+// Heights are tip indexes, -1 for no chain.
+func syncState(height int, best int) string {
+	switch {
+	case height < 0:
+		return syncNoChain
+	case best-height > readyMaxLag:
+		return syncBehind
+	}
+	return syncDone
+}
+
+// Returns mining state of the node
+func miningState() string {
+	switch {
+	case miningJobs.Load() > 0:
+		return miningActive
+	case miningPaused.Load():
+		return miningPause
+	}
+	return miningIdle
+}
+
+// Returns an error wrapping ErrNotReady unless the chain is loaded.
+// Unlike checkReady it doesn't depend on heights reported by peers, so they can't hold back mining.
+func checkChainLoaded() error {
+	if len(block.GetBlockchain()) == 0 {
+		return fmt.Errorf("%w: no chain loaded", ErrNotReady)
+	}
+	return nil
+}
+
+// Returns an error wrapping ErrNotReady unless the chain is loaded and synced
+func checkReady() error {
+	status := syncStatus()
+	switch status.State {
+	case syncNoChain:
+		return fmt.Errorf("%w: no chain loaded", ErrNotReady)
+	case syncBehind:
+		return fmt.Errorf("%w: %v blocks behind best peer", ErrNotReady, status.BestPeerHeight-chainHeight())
+	}
+	return nil
+}
+
+// Checks at the interval whether the chain fell more than READY_MAX_LAG blocks behind the best peer,
+// and if so syncs it from a random peer reporting at least that height, until the context is cancelled
+func catchUp(ctx context.Context, logger *slog.Logger, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		status := syncStatus()
+		if status.State != syncBehind {
+			continue
+		}
+		candidates := peers.AtHeight(status.BestPeerHeight)
+		if len(candidates) == 0 {
+			continue
+		}
+		peer := candidates[rand.IntN(len(candidates))]
+		if err := getChain(ctx, peer); err != nil {
+			logger.Info("Catch-up sync failed", "peer", peer, "err", err)
+			continue
+		}
+		logger.Info("Caught up with peer", "peer", peer, "height", chainHeight())
+	}
+}
+
+// Defines the JSON body for GET /healthz and GET /readyz responses
+type HealthData struct {
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Reports that the node is running.
+// Route: GET /healthz
+func handleHealthz(logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Request", "route", "GET /healthz")
+			_ = encode(w, r, http.StatusOK, HealthData{Status: "ok"})
+		},
+	)
+}
+
+// Reports whether the node has a chain synced within READY_MAX_LAG blocks of the best peer.
+// Route: GET /readyz
+func handleReadyz(logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Request", "route", "GET /readyz")
+
+			if err := checkReady(); err != nil {
+				_ = encode(w, r, http.StatusServiceUnavailable, HealthData{Status: "not ready", Reason: err.Error()})
+				return
+			}
+			_ = encode(w, r, http.StatusOK, HealthData{Status: "ready"})
+		},
+	)
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Sends GET /readyz, returning the status code
+func readyzCode() int {
+	rec := httptest.NewRecorder()
+	handleReadyz(slog.New(slog.DiscardHandler)).ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	return rec.Code
+}
+
+// Calls syncState for chains without blocks, behind and within the allowed lag, checking the states
+func TestSyncState(t *testing.T) {
+	tests := []struct {
+		height, best int
+		want         string
+	}{
+		{-1, 0, syncNoChain},
+		{0, 0, syncDone},
+		{1, 2 + readyMaxLag, syncBehind},
+		{1, 1 + readyMaxLag, syncDone},
+		{5, 0, syncDone},
+	}
+
+	for _, test := range tests {
+		if got := syncState(test.height, test.best); got != test.want {
+			t.Errorf("syncState(%v, %v) = %v, want %v", test.height, test.best, got, test.want)
+		}
+	}
+}
+
+// Adds a peer ahead by more and then less than the allowed lag,
+// checking GET /readyz and the reported sync state
+func TestReadiness(t *testing.T) {
+	ensureGenesis(t)
+	height := chainHeight()
+	peers = NewPeerSet()
+	t.Cleanup(func() { peers = NewPeerSet() })
+	peers.Add("node1:8001", "")
+
+	peers.RecordHandshake("node1:8001", protocolVersion, height+readyMaxLag+1, nil)
+	if code := readyzCode(); code != http.StatusServiceUnavailable || nodeStatus().Sync.State != syncBehind {
+		t.Errorf("Behind best peer GET /readyz = %v with state %v, want 503 with %v", code, nodeStatus().Sync.State, syncBehind)
+	}
+
+	peers.RecordHandshake("node1:8001", protocolVersion, height+readyMaxLag, nil)
+	if code := readyzCode(); code != http.StatusOK || nodeStatus().Sync.State != syncDone {
+		t.Errorf("Within lag GET /readyz = %v with state %v, want 200 with %v", code, nodeStatus().Sync.State, syncDone)
+	}
+}
+
+// Adds peers reporting heights ahead of the chain where only one is far ahead,
+// checking that the node stays ready and the best height is their median
+func TestReadinessIgnoresSingleInflatedHeight(t *testing.T) {
+	ensureGenesis(t)
+	height := chainHeight()
+	peers = NewPeerSet()
+	t.Cleanup(func() { peers = NewPeerSet() })
+	for i, reported := range []int{height, height + 1, height + 1000} {
+		address := fmt.Sprintf("node%d:800%d", i+1, i+1)
+		peers.Add(address, "")
+		peers.RecordHandshake(address, protocolVersion, reported, nil)
+	}
+
+	if best := peers.BestHeight(); best != height+1 {
+		t.Errorf("BestHeight() = %v, want %v", best, height+1)
+	}
+	if code := readyzCode(); code != http.StatusOK {
+		t.Errorf("GET /readyz with one inflated peer height = %v, want 200", code)
+	}
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Cryptographic identity of the node.
+// Node ID is the hex encoded ed25519 public key.
+type Identity struct {
+	ID         string
+	PublicKey  ed25519.PublicKey
+	privateKey ed25519.PrivateKey
+}
+
+// Identity of this node, replaced in Run if NODE_KEY is set
+var identity = mustGenerateIdentity()
+
+// Creates a new random identity
+func GenerateIdentity() (*Identity, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to generate node key: %w", err)
+	}
+	return &Identity{ID: nodeIDFromKey(publicKey), PublicKey: publicKey, privateKey: privateKey}, nil
+}
+
+func mustGenerateIdentity() *Identity {
+	id, err := GenerateIdentity()
+	if err != nil {
+		panic(err)
+	}
+	return id
+}
+
+// Loads identity from hex encoded seed in file.
+// If the file doesn't exist, creates a new identity and saves it.
+func LoadIdentity(path string) (*Identity, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		id, err := GenerateIdentity()
+		if err != nil {
+			return nil, err
+		}
+		seed := hex.EncodeToString(id.privateKey.Seed())
+		if err := os.WriteFile(path, []byte(seed+"\n"), 0o600); err != nil {
+			return nil, fmt.Errorf("Failed to save node key: %w", err)
+		}
+		return id, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read node key: %w", err)
+	}
+
+	seed, err := hex.DecodeString(strings.TrimSpace(string(content)))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("Node key in %v is not a valid ed25519 seed", path)
+	}
+	privateKey := ed25519.NewKeyFromSeed(seed)
+	publicKey := privateKey.Public().(ed25519.PublicKey)
+	return &Identity{ID: nodeIDFromKey(publicKey), PublicKey: publicKey, privateKey: privateKey}, nil
+}
+
+// Signs message with the node private key
+func (id *Identity) Sign(message []byte) []byte {
+	return ed25519.Sign(id.privateKey, message)
+}
+
+// Returns node ID for the public key
+func nodeIDFromKey(publicKey ed25519.PublicKey) string {
+	return hex.EncodeToString(publicKey)
+}
+
+// Returns public key encoded in node ID
+func keyFromNodeID(nodeID string) (ed25519.PublicKey, error) {
+	key, err := hex.DecodeString(nodeID)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("Invalid node ID %q", nodeID)
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// Checks that signature over message was made by the node with given ID
+func verifyNodeSignature(nodeID string, message []byte, signature []byte) error {
+	publicKey, err := keyFromNodeID(nodeID)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(publicKey, message, signature) {
+		return fmt.Errorf("Signature doesn't match node %v", nodeID)
+	}
+	return nil
+}
@@ -0,0 +1,306 @@
+package server
+
+import (
+	"GoChain/block"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Capability of peers accepting POST /inv and POST /getdata
+const capabilityInv = "inv"
+
+// Number and lifetime of inventory hashes remembered per peer
+const (
+	peerInventorySize = 5000
+	peerInventoryTTL  = time.Hour
+)
+
+// Block hashes already requested with POST /getdata, so they aren't requested from several peers at once
+var requestedBlocks = newSeenCache(gossipSeenCacheSize, 30*time.Second)
+
+// Time a peer has to deliver blocks requested with getdata over the binary protocol
+const blockPullTimeout = 10 * time.Second
+
+// Peers that announced the blocks being pulled, at most this many per block
+var blockAnnouncers = newAnnouncers(gossipSeenCacheSize, 8)
+
+// Peers that announced each block being pulled, in the order of announcement.
+// When a peer doesn't deliver a block, it is pulled from the next one.
+type announcers struct {
+	mu      sync.Mutex
+	size    int
+	perHash int
+	byHash  map[string][]string
+}
+
+func newAnnouncers(size int, perHash int) *announcers {
+	return &announcers{size: size, perHash: perHash, byHash: make(map[string][]string)}
+}
+
+// Adds peer as announcer of the block, unless it is listed already or the limits are reached
+func (a *announcers) Add(hash string, address string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	list, ok := a.byHash[hash]
+	if (!ok && len(a.byHash) >= a.size) || len(list) >= a.perHash || slices.Contains(list, address) {
+		return
+	}
+	a.byHash[hash] = append(list, address)
+}
+
+// Removes the peer that didn't deliver the block and returns the next announcer to pull it from
+func (a *announcers) Next(hash string, tried string) (string, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	list := slices.DeleteFunc(a.byHash[hash], func(address string) bool { return address == tried })
+	if len(list) == 0 {
+		delete(a.byHash, hash)
+		return "", false
+	}
+	a.byHash[hash] = list
+	return list[0], true
+}
+
+// Forgets announcers of the block
+func (a *announcers) Delete(hash string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	delete(a.byHash, hash)
+}
+
+func init() {
+	localCapabilities = append(localCapabilities, capabilityInv)
+}
+
+// Defines the JSON body for POST /inv and POST /getdata requests.
+// TTL is the remaining hop count of the announced blocks, missing from nodes that don't send it.
+type InventoryData struct {
+	Hashes []string `json:"hashes"`
+	TTL    int      `json:"ttl,omitempty"`
+}
+
+// Defines the JSON body for POST /inv response
+type InvResponseData struct {
+	Requested int `json:"requested"`
+}
+
+// Defines the JSON body for POST /getdata response
+type GetDataResponseData struct {
+	Data []block.Block `json:"data"`
+}
+
+// Announces block hash to peer with POST /inv, unless the peer already knows it.
+// The hash is marked known before sending, so concurrent announcements send it once,
+// and unmarked if the peer didn't accept it, so the next announcement retries.
+func announceBlock(ctx context.Context, address string, hash string, ttl int) error {
+	if !peers.MarkKnown(address, hash) {
+		return nil
+	}
+
+	if err := sendInventory(ctx, address, hash, ttl); err != nil {
+		peers.ForgetKnown(address, hash)
+		return err
+	}
+	return nil
+}
+
+// Sends block hash to peer with POST /inv
+func sendInventory(ctx context.Context, address string, hash string, ttl int) error {
+	body, err := encodeRequest(InventoryData{Hashes: []string{hash}, TTL: ttl})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", peerURL(address, "/inv"), body)
+	if err != nil {
+		return fmt.Errorf("Failed to create request for node %v: %v", address, err)
+	}
+	setPeerHeaders(req)
+
+	resp, err := peerClient.DoIdempotent(req)
+	if err != nil {
+		return fmt.Errorf("Error connecting to host: %v, %w", address, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Unexpected response: %v, from %v", resp.StatusCode, address)
+	}
+	return nil
+}
+
+// Requests full blocks for the hashes from peer with POST /getdata
+func fetchBlocks(ctx context.Context, address string, hashes []string) ([]block.Block, error) {
+	body, err := encodeRequest(InventoryData{Hashes: hashes})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", peerURL(address, "/getdata"), body)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create request for node %v: %v", address, err)
+	}
+	setPeerHeaders(req)
+
+	resp, err := peerClient.DoIdempotent(req)
+	if err != nil {
+		return nil, fmt.Errorf("Error connecting to host: %v, %v", address, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Unexpected response: %v, from %v", resp.StatusCode, address)
+	}
+
+	data, err := decodeResponse[GetDataResponseData](resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding POST /getdata: %v", err)
+	}
+	return data.Data, nil
+}
+
+// Pulls announced blocks from peer and passes them to gossip for validation and relay.
+// The blocks continue the trace of the announcement carried by ctx and keep its TTL.
+// Blocks the peer doesn't deliver, or delivers invalid, are pulled from their next announcer.
+func pullBlocks(ctx context.Context, logger *slog.Logger, address string, hashes []string, ttl int) {
+	blocks, err := fetchBlocks(ctx, address, hashes)
+	if err != nil {
+		logger.Warn("Failed to fetch blocks", "peer", address, "err", err)
+	}
+
+	for _, b := range blocks {
+		receiveBlock(ctx, logger, b, address, ttl)
+	}
+	retryPull(ctx, logger, hashes, address, ttl)
+}
+
+// Pulls the blocks that are still missing from the chain from their next announcer after the tried peer.
+// Blocks without another announcer are no longer marked as requested, so the next announcement pulls them.
+func retryPull(ctx context.Context, logger *slog.Logger, hashes []string, tried string, ttl int) {
+	for _, hash := range hashes {
+		if _, ok := block.GetBlockByHash(hash); ok {
+			blockAnnouncers.Delete(hash)
+			continue
+		}
+		next, ok := blockAnnouncers.Next(hash, tried)
+		if !ok {
+			requestedBlocks.Forget(hash)
+			continue
+		}
+		logger.Info("Pulling block from next announcer", "block_hash", hash, "peer", next)
+		go pullBlocks(ctx, logger, next, []string{hash}, ttl)
+	}
+}
+
+// Returns TTL of announced blocks, full TTL if the sender didn't send one
+func announcedTTL(ttl int) int {
+	if ttl <= 0 {
+		return gossiper.ttl
+	}
+	return min(ttl, gossiper.ttl)
+}
+
+// Passes block pulled from peer to gossip for validation and relay.
+// The message keeps the TTL it was announced with, so the hop limit applies across pulls.
+func receiveBlock(ctx context.Context, logger *slog.Logger, b block.Block, from string, ttl int) {
+	msg, err := newGossipMessage(gossipBlock, b.Hash, announcedTTL(ttl), b)
+	if err != nil {
+		logger.Error("Failed to encode block", "block_hash", b.Hash, "err", err)
+		return
+	}
+	// The origin of a pulled block is unknown
+	msg.Origin = ""
+	msg.TraceParent = traceParent(ctx)
+	if _, err := gossiper.Receive(msg, from); err != nil {
+		logger.Info("Block rejected", "block_hash", b.Hash, "height", b.Index, "peer", from, "err", err)
+	}
+}
+
+// Receives announced block hashes and pulls the unknown ones with POST /getdata.
+// Route: POST /inv
+func handleInv(logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Info("Request", "route", "POST /inv")
+
+			data, err := decode[InventoryData](r)
+
+			if err != nil {
+				penalizePeer(logger, requestSender(r), offenceDecodeFailure)
+				_ = encode(w, r, http.StatusBadRequest, ErrorData{Error: "Invalid request body"})
+				return
+			}
+
+			// Blocks are only pulled from known peers. Node-Addr isn't proven without TLS,
+			// so the announcement marks hashes known to the peer only if it is,
+			// and a pull that fails is retried from the next announcer.
+			from := r.Header.Get("Node-Addr")
+			_, proven := tlsPeerID(r)
+			unknown := []string{}
+
+			if peers.Contains(from) {
+				for _, hash := range data.Hashes {
+					if proven {
+						peers.MarkKnown(from, hash)
+					}
+
+					if _, ok := block.GetBlockByHash(hash); ok {
+						continue
+					}
+					blockAnnouncers.Add(hash, from)
+					if !requestedBlocks.Seen(hash) {
+						unknown = append(unknown, hash)
+					}
+				}
+			}
+
+			if len(unknown) > 0 {
+				go pullBlocks(context.WithoutCancel(r.Context()), logger, from, unknown, data.TTL)
+			}
+
+			_ = encode(w, r, http.StatusOK, InvResponseData{Requested: len(unknown)})
+		},
+	)
+}
+
+// Returns full blocks for the requested hashes that this node has.
+// Route: POST /getdata
+func handleGetData(logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Info("Request", "route", "POST /getdata")
+
+			data, err := decode[InventoryData](r)
+
+			if err != nil {
+				penalizePeer(logger, requestSender(r), offenceDecodeFailure)
+				_ = encode(w, r, http.StatusBadRequest, ErrorData{Error: "Invalid request body"})
+				return
+			}
+
+			// Blocks are marked known to the requesting peer only if Node-Addr is proven
+			from := r.Header.Get("Node-Addr")
+			_, proven := tlsPeerID(r)
+			blocks := []block.Block{}
+
+			for _, hash := range data.Hashes {
+				if b, ok := block.GetBlockByHash(hash); ok {
+					if proven {
+						peers.MarkKnown(from, hash)
+					}
+					blocks = append(blocks, b)
+				}
+			}
+
+			_ = encode(w, r, http.StatusOK, GetDataResponseData{Data: blocks})
+		},
+	)
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"GoChain/block"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Calls announceBlock twice for the same hash, checking that the peer receives one POST /inv
+func TestAnnounceBlockOnce(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		_ = encode(w, r, http.StatusOK, InvResponseData{})
+	}))
+	defer srv.Close()
+
+	address := strings.TrimPrefix(srv.URL, "http://")
+	peers = NewPeerSet()
+	peers.Add(address, "")
+
+	for range 2 {
+		if err := announceBlock(context.Background(), address, "hash1", 3); err != nil {
+			t.Fatalf("announceBlock() returned an error: %v", err)
+		}
+	}
+
+	if requests.Load() != 1 {
+		t.Errorf("Peer received %v announcements, want 1", requests.Load())
+	}
+}
+
+// Announces a hash to a peer that fails the first POST /inv, checking that the next announcement is sent again
+func TestAnnounceBlockRetryAfterFailure(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_ = encode(w, r, http.StatusOK, InvResponseData{})
+	}))
+	defer srv.Close()
+
+	address := strings.TrimPrefix(srv.URL, "http://")
+	peers = NewPeerSet()
+	peers.Add(address, "")
+
+	if err := announceBlock(context.Background(), address, "hash1", 3); err == nil {
+		t.Fatal("announceBlock() to a failing peer returned no error")
+	}
+	if err := announceBlock(context.Background(), address, "hash1", 3); err != nil {
+		t.Fatalf("announceBlock() returned an error: %v", err)
+	}
+
+	if requests.Load() != 2 {
+		t.Errorf("Peer received %v announcements, want 2", requests.Load())
+	}
+}
+
+// Receives pulled blocks announced with TTL of one and three, checking that the TTL is kept rather than reset
+func TestReceiveBlockKeepsTTL(t *testing.T) {
+	g, sent := newTestGossiper(5, 5, "node1:8001", "node2:8002")
+	g.Handle(gossipBlock, func(msg GossipMessage, from string) error { return nil })
+	previous := gossiper
+	gossiper = g
+	t.Cleanup(func() { gossiper = previous })
+	logger := slog.New(slog.DiscardHandler)
+
+	receiveBlock(context.Background(), logger, block.Block{Hash: "last-hop"}, "node1:8001", 1)
+	receiveBlock(context.Background(), logger, block.Block{Hash: "relayed"}, "node1:8001", 3)
+	sent.wait(1)
+
+	sent.mu.Lock()
+	defer sent.mu.Unlock()
+	if msg, ok := sent.sent["node2:8002"]; !ok || msg.ID != gossipBlock+":relayed" || msg.TTL != 2 || msg.Origin != "" {
+		t.Errorf("Forwarded %+v, want only the relayed block with TTL 2 and unknown origin", msg)
+	}
+}
+
+// Pulls a block from an announcer that doesn't deliver it, checking that it is pulled from the next announcer
+// and no longer marked requested once no announcer is left
+func TestPullBlocksRetriesNextAnnouncer(t *testing.T) {
+	var pulled atomic.Int32
+	empty := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = encode(w, r, http.StatusOK, GetDataResponseData{Data: []block.Block{}})
+	}))
+	defer empty.Close()
+	hash := fmt.Sprintf("pull-test-%d", time.Now().UnixNano())
+	delivering := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pulled.Add(1)
+		_ = encode(w, r, http.StatusOK, GetDataResponseData{Data: []block.Block{{Hash: hash}}})
+	}))
+	defer delivering.Close()
+
+	g, _ := newTestGossiper(5, 5)
+	g.Handle(gossipBlock, func(msg GossipMessage, from string) error { return nil })
+	previous := gossiper
+	gossiper = g
+	t.Cleanup(func() { gossiper = previous })
+
+	first, second := strings.TrimPrefix(empty.URL, "http://"), strings.TrimPrefix(delivering.URL, "http://")
+	blockAnnouncers.Add(hash, first)
+	blockAnnouncers.Add(hash, second)
+	requestedBlocks.Seen(hash)
+
+	pullBlocks(context.Background(), slog.New(slog.DiscardHandler), first, []string{hash}, 3)
+
+	deadline := time.Now().Add(time.Second)
+	for requestedBlocks.Contains(hash) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if pulled.Load() != 1 {
+		t.Errorf("Next announcer was asked %v times, want 1", pulled.Load())
+	}
+	if requestedBlocks.Contains(hash) {
+		t.Error("Block missing from the chain is still marked requested after every announcer was tried")
+	}
+}
+
+// Sends POST /inv from an unknown node, checking that nothing is requested
+func TestHandleInvUnknownPeer(t *testing.T) {
+	peers = NewPeerSet()
+	req := httptest.NewRequest("POST", "/inv", strings.NewReader(`{"hashes": ["hash1"]}`))
+	req.Header.Set("Node-Addr", "node9:8009")
+	rec := httptest.NewRecorder()
+
+	handleInv(slog.New(slog.DiscardHandler)).ServeHTTP(rec, req)
+
+	data, err := decodeResponse[InvResponseData](io.NopCloser(rec.Body))
+	if err != nil || data.Requested != 0 {
+		t.Errorf("POST /inv = %+v, %v, want nothing requested", data, err)
+	}
+}
+
+// Sends POST /getdata with known and unknown hashes, checking that only known blocks are returned
+func TestHandleGetData(t *testing.T) {
+	if len(block.GetBlockchain()) < 1 {
+		if err := block.CreateGenesisBlock(); err != nil {
+			t.Fatalf("CreateGenesisBlock() returned an error: %v", err)
+		}
+	}
+	genesis := block.GetBlockchain()[0]
+	body := `{"hashes": ["` + genesis.Hash + `", "unknown"]}`
+	rec := httptest.NewRecorder()
+
+	handleGetData(slog.New(slog.DiscardHandler)).ServeHTTP(rec, httptest.NewRequest("POST", "/getdata", strings.NewReader(body)))
+
+	data, err := decodeResponse[GetDataResponseData](io.NopCloser(rec.Body))
+	if err != nil || len(data.Data) != 1 || data.Data[0].Hash != genesis.Hash {
+		t.Errorf("POST /getdata = %+v, %v, want genesis block only", data, err)
+	}
+}
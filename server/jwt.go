@@ -0,0 +1,285 @@
+package server
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Signing algorithms accepted in JWTs, each bound to one key type
+const (
+	jwtRS256 = "RS256"
+	jwtES256 = "ES256"
+	jwtEdDSA = "EdDSA"
+)
+
+// Allowed clock difference when checking exp and nbf claims
+const jwtLeeway = time.Minute
+
+// Smallest accepted RSA key
+const minRSAKeyBits = 2048
+
+// Defines a key of a JWKS file
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg,omitempty"`
+	Use string `json:"use,omitempty"`
+	// RSA keys
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// EC and OKP keys
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// Public key verifying JWTs signed with its algorithm
+type jwtKey struct {
+	alg string
+	key crypto.PublicKey
+}
+
+// Loads signing keys by key ID from a JWKS file.
+// Encryption keys are skipped, keys of other types are an error.
+func LoadJWKS(path string) (map[string]jwtKey, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read JWKS: %w", err)
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(content, &set); err != nil {
+		return nil, fmt.Errorf("Failed to decode JWKS %v: %w", path, err)
+	}
+
+	keys := make(map[string]jwtKey)
+	for _, k := range set.Keys {
+		if k.Use == "enc" {
+			continue
+		}
+		if _, ok := keys[k.Kid]; ok {
+			return nil, fmt.Errorf("JWKS %v has duplicate kid %q", path, k.Kid)
+		}
+		key, err := parseJWK(k)
+		if err != nil {
+			return nil, fmt.Errorf("JWKS %v key %q: %w", path, k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("JWKS %v has no signing keys", path)
+	}
+	return keys, nil
+}
+
+// Returns the public key and algorithm of a JWK
+func parseJWK(k jwk) (jwtKey, error) {
+	var key jwtKey
+	switch k.Kty {
+	case "RSA":
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+			return key, errors.New("Invalid RSA modulus or exponent")
+		}
+		pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if pub.N.BitLen() < minRSAKeyBits {
+			return key, fmt.Errorf("RSA key is shorter than %v bits", minRSAKeyBits)
+		}
+		key = jwtKey{alg: jwtRS256, key: pub}
+	case "EC":
+		if k.Crv != "P-256" {
+			return key, fmt.Errorf("Unsupported curve %q", k.Crv)
+		}
+		x, errX := base64.RawURLEncoding.DecodeString(k.X)
+		y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+		if errX != nil || errY != nil || len(x) != 32 || len(y) != 32 {
+			return key, errors.New("Invalid EC point")
+		}
+		// Checks that the point is on the curve
+		if _, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return key, fmt.Errorf("Invalid EC point: %w", err)
+		}
+		key = jwtKey{alg: jwtES256, key: &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}}
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if k.Crv != "Ed25519" || err != nil || len(x) != ed25519.PublicKeySize {
+			return key, errors.New("Invalid Ed25519 key")
+		}
+		key = jwtKey{alg: jwtEdDSA, key: ed25519.PublicKey(x)}
+	default:
+		return key, fmt.Errorf("Unsupported key type %q", k.Kty)
+	}
+
+	if k.Alg != "" && k.Alg != key.alg {
+		return key, fmt.Errorf("Unsupported algorithm %q for %v key", k.Alg, k.Kty)
+	}
+	return key, nil
+}
+
+// Audience claim given as a string or a list of strings
+type jwtAudience []string
+
+func (a *jwtAudience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = jwtAudience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return errors.New("aud is neither a string nor a list of strings")
+	}
+	*a = list
+	return nil
+}
+
+// Defines the claims read from a JWT.
+// Scopes are given space separated in scope or as a list in scp.
+type jwtClaims struct {
+	Issuer    string      `json:"iss"`
+	Subject   string      `json:"sub"`
+	Audience  jwtAudience `json:"aud"`
+	ExpiresAt *float64    `json:"exp"`
+	NotBefore *float64    `json:"nbf"`
+	Scope     string      `json:"scope"`
+	Scp       []string    `json:"scp"`
+}
+
+// Returns scopes granted by the claims
+func (c jwtClaims) scopes() []string {
+	return append(strings.Fields(c.Scope), c.Scp...)
+}
+
+// Authenticates requests with a JWT in the Authorization header as a bearer token.
+// Tokens need a subject and an expiry, and the issuer and audience if configured.
+// Each subject has its own quota.
+type JWTAuthenticator struct {
+	keys     map[string]jwtKey
+	issuer   string
+	audience string
+	quotas   *quotaSet
+}
+
+// Creates JWT authenticator accepting tokens signed with the keys.
+// Empty issuer or audience is not checked, nil quota leaves subjects unlimited.
+func NewJWTAuthenticator(keys map[string]jwtKey, issuer string, audience string, quota *Quota) *JWTAuthenticator {
+	return &JWTAuthenticator{keys: keys, issuer: issuer, audience: audience, quotas: newQuotaSet(quota)}
+}
+
+func (a *JWTAuthenticator) Challenge() string {
+	return "Bearer"
+}
+
+func (a *JWTAuthenticator) Authenticate(r *http.Request) (Principal, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return Principal{}, ErrNoCredentials
+	}
+
+	claims, err := a.verify(token, time.Now())
+	if err != nil {
+		return Principal{}, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+	}
+	return Principal{ID: "jwt:" + claims.Subject, Scopes: claims.scopes(), Quota: a.quotas.get(claims.Subject)}, nil
+}
+
+// Checks signature and claims of the token, returning its claims
+func (a *JWTAuthenticator) verify(token string, now time.Time) (jwtClaims, error) {
+	var claims jwtClaims
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims, errors.New("JWT is not in header.payload.signature format")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return claims, fmt.Errorf("Invalid JWT header: %w", err)
+	}
+	key, ok := a.keys[header.Kid]
+	if !ok {
+		return claims, fmt.Errorf("Unknown JWT key %q", header.Kid)
+	}
+	// The algorithm must match the key, so a token can't pick a weaker check
+	if header.Alg != key.alg {
+		return claims, fmt.Errorf("JWT algorithm %q doesn't match key %q", header.Alg, header.Kid)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return claims, errors.New("Invalid JWT signature encoding")
+	}
+	if !verifyJWTSignature(key, []byte(parts[0]+"."+parts[1]), signature) {
+		return claims, errors.New("Invalid JWT signature")
+	}
+
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return claims, fmt.Errorf("Invalid JWT claims: %w", err)
+	}
+	switch {
+	case claims.Subject == "":
+		return claims, errors.New("JWT has no sub claim")
+	case claims.ExpiresAt == nil:
+		return claims, errors.New("JWT has no exp claim")
+	case now.After(jwtTime(*claims.ExpiresAt).Add(jwtLeeway)):
+		return claims, errors.New("JWT has expired")
+	case claims.NotBefore != nil && now.Before(jwtTime(*claims.NotBefore).Add(-jwtLeeway)):
+		return claims, errors.New("JWT is not valid yet")
+	case a.issuer != "" && claims.Issuer != a.issuer:
+		return claims, fmt.Errorf("JWT issuer %q is not trusted", claims.Issuer)
+	case a.audience != "" && !slices.Contains(claims.Audience, a.audience):
+		return claims, fmt.Errorf("JWT is not issued for %q", a.audience)
+	}
+	return claims, nil
+}
+
+// Decodes base64url JSON part of a JWT
+func decodeJWTPart(part string, v any) error {
+	content, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(content, v)
+}
+
+// Returns time of a NumericDate claim
+func jwtTime(seconds float64) time.Time {
+	return time.Unix(0, int64(seconds*float64(time.Second)))
+}
+
+// Checks JWT signature of the signed header and payload
+func verifyJWTSignature(key jwtKey, signed []byte, signature []byte) bool {
+	hash := sha256.Sum256(signed)
+	switch pub := key.key.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA256, hash[:], signature) == nil
+	case *ecdsa.PublicKey:
+		// ES256 signatures are r and s as 32 byte big-endian integers
+		if len(signature) != 64 {
+			return false
+		}
+		return ecdsa.Verify(pub, hash[:], new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:]))
+	case ed25519.PublicKey:
+		return ed25519.Verify(pub, signed, signature)
+	}
+	return false
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Signing keys of the test JWKS
+type testJWTKeys struct {
+	ed  ed25519.PrivateKey
+	ec  *ecdsa.PrivateKey
+	rsa *rsa.PrivateKey
+}
+
+// Generates Ed25519, P-256 and RSA keys and writes their public keys to a JWKS file, returning its path
+func writeTestJWKS(t *testing.T) (testJWTKeys, string) {
+	edPub, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Generating RSA key returned an error: %v", err)
+	}
+
+	b64 := base64.RawURLEncoding.EncodeToString
+	set := map[string][]jwk{"keys": {
+		{Kty: "OKP", Kid: "ed", Crv: "Ed25519", X: b64(edPub)},
+		{Kty: "EC", Kid: "ec", Crv: "P-256", X: b64(ecKey.X.FillBytes(make([]byte, 32))), Y: b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+		{Kty: "RSA", Kid: "rsa", Alg: jwtRS256, N: b64(rsaKey.N.Bytes()), E: b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{Kty: "RSA", Kid: "enc", Use: "enc"},
+	}}
+	content, _ := json.Marshal(set)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		t.Fatalf("Writing JWKS returned an error: %v", err)
+	}
+	return testJWTKeys{ed: edKey, ec: ecKey, rsa: rsaKey}, path
+}
+
+// Returns JWT with the claims signed with the key as the algorithm
+func signTestJWT(t *testing.T, alg string, kid string, key crypto.Signer, claims map[string]any) string {
+	b64 := base64.RawURLEncoding.EncodeToString
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := b64(header) + "." + b64(payload)
+
+	var signature []byte
+	var err error
+	hash := sha256.Sum256([]byte(signed))
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		signature = ed25519.Sign(k, []byte(signed))
+	case *ecdsa.PrivateKey:
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, k, hash[:])
+		if err == nil {
+			signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+		}
+	case *rsa.PrivateKey:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, hash[:])
+	}
+	if err != nil {
+		t.Fatalf("Signing JWT returned an error: %v", err)
+	}
+	return signed + "." + b64(signature)
+}
+
+// Verifies tokens signed with each key type, checking the subject and scopes of the caller
+func TestJWTAuthenticate(t *testing.T) {
+	keys, path := writeTestJWKS(t)
+	jwks, err := LoadJWKS(path)
+	if err != nil {
+		t.Fatalf("LoadJWKS() returned an error: %v", err)
+	}
+	authenticator := NewJWTAuthenticator(jwks, "https://issuer.test", "gochain", nil)
+	claims := map[string]any{"sub": "team-a", "iss": "https://issuer.test", "aud": []string{"gochain"}, "exp": time.Now().Add(time.Hour).Unix(), "scope": "read submit"}
+
+	for _, token := range []string{
+		signTestJWT(t, jwtEdDSA, "ed", keys.ed, claims),
+		signTestJWT(t, jwtES256, "ec", keys.ec, claims),
+		signTestJWT(t, jwtRS256, "rsa", keys.rsa, claims),
+	} {
+		req := httptest.NewRequest("GET", "/tip", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		principal, err := authenticator.Authenticate(req)
+		if err != nil || principal.ID != "jwt:team-a" || !principal.Has(scopeRead) || !principal.Has(scopeSubmit) {
+			t.Errorf("Authenticate() = %+v, %v, want team-a with read and submit", principal, err)
+		}
+	}
+}
+
+// Verifies tokens with bad signatures, algorithms and claims, checking that each is rejected
+func TestJWTInvalid(t *testing.T) {
+	keys, path := writeTestJWKS(t)
+	jwks, _ := LoadJWKS(path)
+	authenticator := NewJWTAuthenticator(jwks, "https://issuer.test", "gochain", nil)
+	now := time.Now()
+
+	valid := func() map[string]any {
+		return map[string]any{"sub": "team-a", "iss": "https://issuer.test", "aud": "gochain", "exp": now.Add(time.Hour).Unix()}
+	}
+	with := func(name string, value any) map[string]any {
+		claims := valid()
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+		return claims
+	}
+
+	tests := map[string]string{
+		"expired":          signTestJWT(t, jwtEdDSA, "ed", keys.ed, with("exp", now.Add(-time.Hour).Unix())),
+		"not yet valid":    signTestJWT(t, jwtEdDSA, "ed", keys.ed, with("nbf", now.Add(time.Hour).Unix())),
+		"without exp":      signTestJWT(t, jwtEdDSA, "ed", keys.ed, with("exp", nil)),
+		"without sub":      signTestJWT(t, jwtEdDSA, "ed", keys.ed, with("sub", nil)),
+		"other issuer":     signTestJWT(t, jwtEdDSA, "ed", keys.ed, with("iss", "https://other.test")),
+		"other audience":   signTestJWT(t, jwtEdDSA, "ed", keys.ed, with("aud", "other")),
+		"unknown key":      signTestJWT(t, jwtEdDSA, "other", keys.ed, valid()),
+		"encryption key":   signTestJWT(t, jwtRS256, "enc", keys.rsa, valid()),
+		"wrong algorithm":  signTestJWT(t, jwtES256, "rsa", keys.ec, valid()),
+		"wrong signer":     signTestJWT(t, jwtES256, "ec", keys.ed, valid()),
+		"not three parts":  "header.payload",
+		"invalid encoding": "!.!.!",
+	}
+
+	for name, token := range tests {
+		if _, err := authenticator.verify(token, now); err == nil {
+			t.Errorf("verify() of a token %v returned no error", name)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/tip", nil)
+	req.Header.Set("Authorization", "Bearer "+tests["expired"])
+	if _, err := authenticator.Authenticate(req); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Authenticate() of an expired token returned %v, want ErrInvalidCredentials", err)
+	}
+}
+
+// Loads JWKS files with unsupported keys, checking that each is rejected
+func TestLoadJWKSInvalid(t *testing.T) {
+	for _, keys := range []string{
+		``,
+		`{"kty": "oct", "kid": "a", "k": "c2VjcmV0"}`,
+		`{"kty": "RSA", "kid": "a", "n": "AQAB", "e": "AQAB"}`,
+		`{"kty": "EC", "kid": "a", "crv": "P-384", "x": "", "y": ""}`,
+		`{"kty": "EC", "kid": "a", "crv": "P-256", "x": "` + base64.RawURLEncoding.EncodeToString(make([]byte, 32)) + `", "y": "` + base64.RawURLEncoding.EncodeToString(make([]byte, 32)) + `"}`,
+		`{"kty": "OKP", "kid": "a", "crv": "Ed25519", "x": "AQAB", "alg": "EdDSA"}`,
+	} {
+		path := filepath.Join(t.TempDir(), "jwks.json")
+		os.WriteFile(path, []byte(`{"keys": [`+keys+`]}`), 0o600)
+
+		if _, err := LoadJWKS(path); err == nil {
+			t.Errorf("LoadJWKS() with %v returned no error", keys)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Components of the node with their own log level
+const (
+	componentHTTP   = "http"
+	componentGossip = "gossip"
+	componentMining = "mining"
+	componentSync   = "sync"
+	componentPeers  = "peers"
+	// Records of the root logger, which aren't tagged with a component
+	componentNode = "node"
+)
+
+// All components, used to list and validate levels
+var logComponents = []string{componentHTTP, componentGossip, componentMining, componentSync, componentPeers, componentNode}
+
+// Log levels per component, adjustable while the node runs
+type LogLevels struct {
+	mu     sync.RWMutex
+	levels map[string]*slog.LevelVar
+}
+
+// Log levels of the node
+var logLevels = NewLogLevels(slog.LevelInfo)
+
+// Creates levels with every component at the default level
+func NewLogLevels(def slog.Level) *LogLevels {
+	l := &LogLevels{levels: make(map[string]*slog.LevelVar)}
+	for _, component := range logComponents {
+		l.levels[component] = new(slog.LevelVar)
+		l.levels[component].Set(def)
+	}
+	return l
+}
+
+// Returns level variable of the component
+func (l *LogLevels) level(component string) *slog.LevelVar {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.levels[component]
+}
+
+// Sets level of the component
+func (l *LogLevels) Set(component string, level slog.Level) error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	v, ok := l.levels[component]
+	if !ok {
+		return fmt.Errorf("Unknown log component %q", component)
+	}
+	v.Set(level)
+	return nil
+}
+
+// Returns level names by component
+func (l *LogLevels) List() map[string]string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	levels := make(map[string]string)
+	for component, v := range l.levels {
+		levels[component] = v.Level().String()
+	}
+	return levels
+}
+
+// Parses levels given as "gossip=debug,http=warn"
+func (l *LogLevels) Parse(value string) error {
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		component, name, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("Invalid log level %q, want component=level", pair)
+		}
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(strings.TrimSpace(name))); err != nil {
+			return fmt.Errorf("Invalid log level %q: %w", pair, err)
+		}
+		if err := l.Set(strings.TrimSpace(component), level); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handler dropping records below the level of its component
+type componentHandler struct {
+	// Handler without the component attribute, used to derive other components
+	root      slog.Handler
+	next      slog.Handler
+	component string
+	level     *slog.LevelVar
+}
+
+func (h *componentHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level.Level() && h.next.Enabled(ctx, level)
+}
+
+func (h *componentHandler) Handle(ctx context.Context, record slog.Record) error {
+	return h.next.Handle(ctx, record)
+}
+
+func (h *componentHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &componentHandler{root: h.root, next: h.next.WithAttrs(attrs), component: h.component, level: h.level}
+}
+
+func (h *componentHandler) WithGroup(name string) slog.Handler {
+	return &componentHandler{root: h.root, next: h.next.WithGroup(name), component: h.component, level: h.level}
+}
+
+// Creates logger writing JSON or text records to w.
+// Records are filtered by the levels of their component, the records of the returned logger by the node level.
+func NewLogger(w io.Writer, format string) *slog.Logger {
+	// Filtering happens per component, so the output handler accepts every level
+	options := &slog.HandlerOptions{Level: slog.LevelDebug}
+
+	var handler slog.Handler
+	if format == "json" {
+		handler = slog.NewJSONHandler(w, options)
+	} else {
+		handler = slog.NewTextHandler(w, options)
+	}
+	return slog.New(&componentHandler{root: handler, next: handler, component: componentNode, level: logLevels.level(componentNode)})
+}
+
+// Returns logger of the component, tagging records with it and applying its level.
+// Loggers not created by NewLogger only get the attribute.
+func withComponent(logger *slog.Logger, component string) *slog.Logger {
+	h, ok := logger.Handler().(*componentHandler)
+	if !ok {
+		return logger.With("component", component)
+	}
+	return slog.New(&componentHandler{
+		root:      h.root,
+		next:      h.root.WithAttrs([]slog.Attr{slog.String("component", component)}),
+		component: component,
+		level:     logLevels.level(component),
+	})
+}
+
+// Defines the JSON body for GET and POST /admin/log-levels
+type LogLevelsData struct {
+	Levels map[string]string `json:"levels"`
+}
+
+// Returns log level of each component.
+// Route: GET /admin/log-levels
+func handleGetLogLevels(logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Info("Request", "route", "GET /admin/log-levels")
+			_ = encode(w, r, http.StatusOK, LogLevelsData{Levels: logLevels.List()})
+		},
+	)
+}
+
+// Changes log levels of the given components, others keep their level.
+// Route: POST /admin/log-levels
+func handleSetLogLevels(logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Info("Request", "route", "POST /admin/log-levels")
+
+			data, err := decode[LogLevelsData](r)
+			if err != nil || len(data.Levels) == 0 {
+				_ = encode(w, r, http.StatusBadRequest, ErrorData{Error: "Invalid request body"})
+				return
+			}
+
+			pairs := []string{}
+			for _, component := range slices.Sorted(maps.Keys(data.Levels)) {
+				pairs = append(pairs, component+"="+data.Levels[component])
+			}
+			// Levels are validated before any is changed
+			if err := NewLogLevels(slog.LevelInfo).Parse(strings.Join(pairs, ",")); err != nil {
+				_ = encode(w, r, http.StatusBadRequest, ErrorData{Error: err.Error()})
+				return
+			}
+			_ = logLevels.Parse(strings.Join(pairs, ","))
+
+			logger.Info("Log levels changed", "levels", data.Levels)
+			_ = encode(w, r, http.StatusOK, LogLevelsData{Levels: logLevels.List()})
+		},
+	)
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Replaces the node log levels for the test
+func useLogLevels(t *testing.T, levels *LogLevels) {
+	previous := logLevels
+	logLevels = levels
+	t.Cleanup(func() { logLevels = previous })
+}
+
+// Logs through two components with different levels,
+// checking that records are filtered per component and tagged with it
+func TestComponentLevels(t *testing.T) {
+	useLogLevels(t, NewLogLevels(slog.LevelInfo))
+	if err := logLevels.Parse("gossip=debug, http=warn"); err != nil {
+		t.Fatalf("Parse() returned an error: %v", err)
+	}
+
+	var out strings.Builder
+	logger := NewLogger(&out, "json")
+	withComponent(logger, componentGossip).Debug("Gossip debug")
+	withComponent(logger, componentHTTP).Info("HTTP info")
+	withComponent(logger, componentHTTP).Warn("HTTP warn")
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Logged %v records, want 2:\n%v", len(lines), out.String())
+	}
+	for i, want := range []struct{ msg, component string }{{"Gossip debug", componentGossip}, {"HTTP warn", componentHTTP}} {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(lines[i]), &record); err != nil {
+			t.Fatalf("Record %v is not JSON: %v", lines[i], err)
+		}
+		if record["msg"] != want.msg || record["component"] != want.component {
+			t.Errorf("Record = %v, want msg %q with component %q", lines[i], want.msg, want.component)
+		}
+	}
+
+	// Changes apply to loggers created before
+	gossip := withComponent(logger, componentGossip)
+	_ = logLevels.Set(componentGossip, slog.LevelError)
+	if gossip.Enabled(t.Context(), slog.LevelWarn) {
+		t.Errorf("Gossip logger enabled for warn after raising the level to error")
+	}
+}
+
+// Logs through the root logger before and after raising the node level, checking that the level applies to it
+func TestRootLoggerLevel(t *testing.T) {
+	useLogLevels(t, NewLogLevels(slog.LevelInfo))
+	var out strings.Builder
+	logger := NewLogger(&out, "text")
+
+	logger.Info("Before")
+	_ = logLevels.Set(componentNode, slog.LevelWarn)
+	logger.Info("After")
+
+	if !strings.Contains(out.String(), "Before") || strings.Contains(out.String(), "After") {
+		t.Errorf("Root logger wrote %q, want only the record logged before raising the node level", out.String())
+	}
+}
+
+// Parses invalid level lists, checking that each returns an error
+func TestLogLevelsParseErrors(t *testing.T) {
+	for _, value := range []string{"gossip", "gossip=loud", "unknown=debug"} {
+		if err := NewLogLevels(slog.LevelInfo).Parse(value); err == nil {
+			t.Errorf("Parse(%q) returned no error", value)
+		}
+	}
+}
+
+// Sends POST /admin/log-levels with a valid and a partly invalid body,
+// checking that only the valid request changes levels
+func TestHandleSetLogLevels(t *testing.T) {
+	useLogLevels(t, NewLogLevels(slog.LevelInfo))
+	handler := handleSetLogLevels(slog.New(slog.DiscardHandler))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/admin/log-levels", strings.NewReader(`{"levels": {"mining": "debug"}}`)))
+	if rec.Code != http.StatusOK || logLevels.List()[componentMining] != "DEBUG" {
+		t.Errorf("Valid request returned %v with mining at %v, want 200 with DEBUG", rec.Code, logLevels.List()[componentMining])
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/admin/log-levels", strings.NewReader(`{"levels": {"http": "error", "unknown": "debug"}}`)))
+	if rec.Code != http.StatusBadRequest || logLevels.List()[componentHTTP] != "INFO" {
+		t.Errorf("Invalid request returned %v with http at %v, want 400 with INFO", rec.Code, logLevels.List()[componentHTTP])
+	}
+}
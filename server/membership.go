@@ -0,0 +1,469 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"math"
+	"math/rand"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Default SWIM settings, overridable with SWIM_INTERVAL, SWIM_PROBE_TIMEOUT,
+// SWIM_SUSPECT_TIMEOUT and SWIM_INDIRECT_PROBES
+const (
+	defaultSwimInterval       = 5 * time.Second
+	defaultSwimProbeTimeout   = time.Second
+	defaultSwimSuspectTimeout = 30 * time.Second
+	defaultSwimIndirectProbes = 3
+)
+
+// Maximum number of membership updates piggybacked on one message
+const maxPiggybackUpdates = 8
+
+// Multiplier for the number of times each update is retransmitted, lambda in SWIM
+const updateRetransmitMultiplier = 3
+
+// Membership change disseminated on probe messages
+type MemberUpdate struct {
+	Address     string `json:"address"`
+	NodeID      string `json:"nodeId"`
+	State       string `json:"state"`
+	Incarnation uint64 `json:"incarnation"`
+}
+
+// Defines the JSON body for POST /swim/ping request
+type SwimPingData struct {
+	Updates []MemberUpdate `json:"updates"`
+}
+
+// Defines the JSON body for POST /swim/ping response.
+// Height is the index of the chain tip, see chainHeight.
+type SwimAckData struct {
+	Incarnation     uint64         `json:"incarnation"`
+	Height          int            `json:"height"`
+	ProtocolVersion int            `json:"protocolVersion"`
+	Updates         []MemberUpdate `json:"updates"`
+}
+
+// Defines the JSON body for POST /swim/ping-req request
+type SwimPingReqData struct {
+	Target  string         `json:"target"`
+	Updates []MemberUpdate `json:"updates"`
+}
+
+// Defines the JSON body for POST /swim/ping-req response
+type SwimPingReqAckData struct {
+	Ack     bool           `json:"ack"`
+	Updates []MemberUpdate `json:"updates"`
+}
+
+// Update waiting to be piggybacked
+type queuedUpdate struct {
+	update    MemberUpdate
+	transmits int
+}
+
+// Membership updates waiting for dissemination, newest update per address
+type updateQueue struct {
+	mu      sync.Mutex
+	entries map[string]*queuedUpdate
+}
+
+func newUpdateQueue() *updateQueue {
+	return &updateQueue{entries: make(map[string]*queuedUpdate)}
+}
+
+// Queues update, replacing older update about the same address
+func (q *updateQueue) Push(update MemberUpdate) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.entries[update.Address] = &queuedUpdate{update: update}
+}
+
+// Returns up to max least transmitted updates.
+// Updates transmitted limit times are dropped.
+func (q *updateQueue) Take(max int, limit int) []MemberUpdate {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	queued := make([]*queuedUpdate, 0, len(q.entries))
+	for _, entry := range q.entries {
+		queued = append(queued, entry)
+	}
+	slices.SortFunc(queued, func(a, b *queuedUpdate) int { return a.transmits - b.transmits })
+	if len(queued) > max {
+		queued = queued[:max]
+	}
+
+	updates := make([]MemberUpdate, 0, len(queued))
+	for _, entry := range queued {
+		updates = append(updates, entry.update)
+		entry.transmits++
+		if entry.transmits >= limit {
+			delete(q.entries, entry.update.Address)
+		}
+	}
+	return updates
+}
+
+// SWIM-style membership and failure detection.
+// Each protocol period one member is probed directly, and through helper members if that fails.
+// Members that don't answer become suspect and are removed if they don't refute in time.
+type Membership struct {
+	logger         *slog.Logger
+	interval       time.Duration
+	probeTimeout   time.Duration
+	suspectTimeout time.Duration
+	indirectProbes int
+
+	// Incarnation of this node, increased to refute suspicion
+	incarnation atomic.Uint64
+	updates     *updateQueue
+
+	mu         sync.Mutex
+	probeOrder []string
+}
+
+// Membership protocol used by the node, replaced in NewServer
+var membership = NewMembership(slog.New(slog.DiscardHandler), defaultSwimInterval, defaultSwimProbeTimeout, defaultSwimSuspectTimeout, defaultSwimIndirectProbes)
+
+// Creates membership protocol with the given timing
+func NewMembership(logger *slog.Logger, interval time.Duration, probeTimeout time.Duration, suspectTimeout time.Duration, indirectProbes int) *Membership {
+	return &Membership{
+		logger:         logger,
+		interval:       interval,
+		probeTimeout:   probeTimeout,
+		suspectTimeout: suspectTimeout,
+		indirectProbes: indirectProbes,
+		updates:        newUpdateQueue(),
+	}
+}
+
+// Returns updates to piggyback on an outgoing message
+func (m *Membership) piggyback() []MemberUpdate {
+	limit := updateRetransmitMultiplier * int(math.Ceil(math.Log2(float64(peers.Len()+2))))
+	return m.updates.Take(maxPiggybackUpdates, limit)
+}
+
+// Announces that this node is alive with an incarnation newer than the received one.
+// After a restart the counter starts over, so it jumps past the incarnation other members know.
+func (m *Membership) refute(received uint64) {
+	for {
+		current := m.incarnation.Load()
+		incarnation := max(received, current)
+		if incarnation < math.MaxUint64 {
+			incarnation++
+		}
+		if m.incarnation.CompareAndSwap(current, incarnation) {
+			m.updates.Push(MemberUpdate{Address: localAddress(), NodeID: identity.ID, State: peerAlive, Incarnation: incarnation})
+			return
+		}
+	}
+}
+
+// Queues alive update about newly admitted peer
+func (m *Membership) Joined(address string, nodeID string) {
+	m.updates.Push(MemberUpdate{Address: address, NodeID: nodeID, State: peerAlive})
+}
+
+// Applies membership updates received from another node.
+// Death is only accepted from members proven by TLS, from other senders it only raises suspicion,
+// so a single node can't remove members that are still able to refute.
+// Senders that aren't proven can't move a member past the incarnation it refutes with next,
+// so a forged update with a huge incarnation can't outrank every refutation.
+func (m *Membership) Apply(updates []MemberUpdate, proven bool) {
+	for _, update := range updates {
+		if update.Address == localAddress() || update.NodeID == identity.ID {
+			// Refute suspicion or death of this node
+			if update.State != peerAlive && update.Incarnation >= m.incarnation.Load() {
+				m.logger.Info("Refuting membership state", "state", update.State, "incarnation", update.Incarnation)
+				m.refute(update.Incarnation)
+			}
+			continue
+		}
+
+		if peer, ok := peers.Get(update.Address); ok && !proven {
+			if update.State == peerAlive {
+				update.Incarnation = min(update.Incarnation, peer.Incarnation+1)
+			} else {
+				update.Incarnation = min(update.Incarnation, peer.Incarnation)
+			}
+		}
+
+		switch update.State {
+		case peerAlive:
+			if !peers.Contains(update.Address) {
+				addressBook.Add(update.Address, update.NodeID)
+				continue
+			}
+			if peers.MarkAlive(update.Address, update.Incarnation) {
+				m.updates.Push(update)
+			}
+		case peerSuspect:
+			if peers.Suspect(update.Address, update.Incarnation) {
+				m.logger.Info("Member is suspect", "peer", update.Address)
+				m.updates.Push(update)
+			}
+		case peerDead:
+			if !proven {
+				if peers.Suspect(update.Address, update.Incarnation) {
+					m.logger.Info("Member is suspect", "peer", update.Address)
+					m.updates.Push(MemberUpdate{Address: update.Address, NodeID: update.NodeID, State: peerSuspect, Incarnation: update.Incarnation})
+				}
+				continue
+			}
+			if peer, ok := peers.Get(update.Address); ok && update.Incarnation >= peer.Incarnation {
+				m.logger.Warn("Member is dead", "peer", update.Address)
+				peers.Remove(update.Address)
+				addressBook.Add(update.Address, update.NodeID)
+				m.updates.Push(update)
+			}
+		}
+	}
+}
+
+// Returns next member to probe, going round-robin over a shuffled member list
+func (m *Membership) nextTarget() (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for {
+		if len(m.probeOrder) == 0 {
+			m.probeOrder = peers.Addresses()
+			if len(m.probeOrder) == 0 {
+				return "", false
+			}
+			rand.Shuffle(len(m.probeOrder), func(i, j int) {
+				m.probeOrder[i], m.probeOrder[j] = m.probeOrder[j], m.probeOrder[i]
+			})
+		}
+		target := m.probeOrder[0]
+		m.probeOrder = m.probeOrder[1:]
+		if peers.Contains(target) {
+			return target, true
+		}
+	}
+}
+
+// Sends POST /swim/ping to the address and returns the ack
+func (m *Membership) ping(address string) (SwimAckData, error) {
+	body, err := encodeRequest(SwimPingData{Updates: m.piggyback()})
+	if err != nil {
+		return SwimAckData{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.probeTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", peerURL(address, "/swim/ping"), body)
+	if err != nil {
+		return SwimAckData{}, fmt.Errorf("Failed to create request for node %v: %v", address, err)
+	}
+	setPeerHeaders(req)
+
+	start := time.Now()
+	resp, err := peerClient.Do(req)
+	if err != nil {
+		return SwimAckData{}, fmt.Errorf("Error connecting to host: %v, %v", address, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return SwimAckData{}, fmt.Errorf("Unexpected response: %v, from %v", resp.StatusCode, address)
+	}
+
+	ack, err := decodeResponse[SwimAckData](resp.Body)
+	if err != nil {
+		return SwimAckData{}, fmt.Errorf("Error decoding POST /swim/ping: %v", err)
+	}
+
+	peers.RecordSuccess(address, time.Since(start), ack.Height, negotiateVersion(ack.ProtocolVersion))
+	peers.MarkAlive(address, ack.Incarnation)
+	m.Apply(ack.Updates, isProvenMember(address, resp.TLS))
+	return ack, nil
+}
+
+// Asks helper to probe the target with POST /swim/ping-req
+func (m *Membership) pingReq(helper string, target string) (bool, error) {
+	body, err := encodeRequest(SwimPingReqData{Target: target, Updates: m.piggyback()})
+	if err != nil {
+		return false, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*m.probeTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", peerURL(helper, "/swim/ping-req"), body)
+	if err != nil {
+		return false, fmt.Errorf("Failed to create request for node %v: %v", helper, err)
+	}
+	setPeerHeaders(req)
+
+	resp, err := peerClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("Error connecting to host: %v, %v", helper, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("Unexpected response: %v, from %v", resp.StatusCode, helper)
+	}
+
+	data, err := decodeResponse[SwimPingReqAckData](resp.Body)
+	if err != nil {
+		return false, fmt.Errorf("Error decoding POST /swim/ping-req: %v", err)
+	}
+
+	m.Apply(data.Updates, isProvenMember(helper, resp.TLS))
+	return data.Ack, nil
+}
+
+// Probes one member directly and, if that fails, through helper members.
+// Member is marked suspect if no probe succeeds.
+func (m *Membership) probe(target string) {
+	_, err := m.ping(target)
+	if err == nil {
+		return
+	}
+	m.logger.Debug("Direct probe failed", "peer", target, "err", err)
+
+	helpers := slices.DeleteFunc(peers.Addresses(), func(address string) bool { return address == target })
+	rand.Shuffle(len(helpers), func(i, j int) { helpers[i], helpers[j] = helpers[j], helpers[i] })
+	if len(helpers) > m.indirectProbes {
+		helpers = helpers[:m.indirectProbes]
+	}
+
+	acks := make(chan bool, len(helpers))
+	for _, helper := range helpers {
+		go func() {
+			ack, err := m.pingReq(helper, target)
+			if err != nil {
+				m.logger.Debug("Indirect probe failed", "peer", target, "helper", helper, "err", err)
+			}
+			acks <- ack
+		}()
+	}
+	for range helpers {
+		if <-acks {
+			return
+		}
+	}
+
+	m.Suspect(target)
+}
+
+// Marks member suspect at its current incarnation and disseminates the suspicion.
+// Used for failed probes and repeated failed sends, the member is removed only if it doesn't refute in time.
+func (m *Membership) Suspect(address string) {
+	peer, ok := peers.Get(address)
+	if ok && peers.Suspect(address, peer.Incarnation) {
+		m.logger.Info("Member is suspect", "peer", address)
+		m.updates.Push(MemberUpdate{Address: address, NodeID: peer.NodeID, State: peerSuspect, Incarnation: peer.Incarnation})
+	}
+}
+
+// Reports whether the TLS connection proved the node ID of the member at the address
+func isProvenMember(address string, state *tls.ConnectionState) bool {
+	nodeID := tlsNodeID(state)
+	knownID, ok := peers.NodeID(address)
+	return nodeID != "" && ok && knownID == nodeID
+}
+
+// Removes members that stayed suspect longer than the suspicion timeout.
+// Their addresses go back to the address book so they can be redialed.
+func (m *Membership) expireSuspects() {
+	for _, address := range peers.ExpiredSuspects(m.suspectTimeout) {
+		peer, ok := peers.Get(address)
+		if !ok {
+			continue
+		}
+		m.logger.Warn("Member is dead", "peer", address)
+		peers.Remove(address)
+		addressBook.Add(address, peer.NodeID)
+		m.updates.Push(MemberUpdate{Address: address, NodeID: peer.NodeID, State: peerDead, Incarnation: peer.Incarnation})
+	}
+}
+
+// Runs protocol periods until the context is cancelled
+func (m *Membership) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			m.logger.Info("Membership protocol stopped")
+			return
+		case <-ticker.C:
+			if target, ok := m.nextTarget(); ok {
+				m.probe(target)
+			}
+			m.expireSuspects()
+		}
+	}
+}
+
+// Answers membership probe and applies piggybacked updates.
+// Route: POST /swim/ping
+func handleSwimPing(logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Info("Request", "route", "POST /swim/ping")
+
+			data, err := decode[SwimPingData](r)
+
+			if err != nil {
+				penalizePeer(logger, requestSender(r), offenceDecodeFailure)
+				_ = encode(w, r, http.StatusBadRequest, ErrorData{Error: "Invalid request body"})
+				return
+			}
+
+			_, proven := tlsPeerID(r)
+			membership.Apply(data.Updates, proven)
+
+			_ = encode(w, r, http.StatusOK, SwimAckData{
+				Incarnation:     membership.incarnation.Load(),
+				Height:          chainHeight(),
+				ProtocolVersion: protocolVersion,
+				Updates:         membership.piggyback(),
+			})
+		},
+	)
+}
+
+// Probes target member on behalf of the requesting node.
+// Route: POST /swim/ping-req
+func handleSwimPingReq(logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Info("Request", "route", "POST /swim/ping-req")
+
+			data, err := decode[SwimPingReqData](r)
+
+			if err != nil || validateNodeAddr(data.Target) != nil {
+				penalizePeer(logger, requestSender(r), offenceDecodeFailure)
+				_ = encode(w, r, http.StatusBadRequest, ErrorData{Error: "Invalid request body"})
+				return
+			}
+
+			_, proven := tlsPeerID(r)
+			membership.Apply(data.Updates, proven)
+
+			// Only known members are probed, so the node can't be used to reach arbitrary addresses
+			ack := false
+			if peers.Contains(data.Target) {
+				_, err := membership.ping(data.Target)
+				ack = err == nil
+			}
+
+			_ = encode(w, r, http.StatusOK, SwimPingReqAckData{Ack: ack, Updates: membership.piggyback()})
+		},
+	)
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Creates membership protocol with short timeouts for tests
+func newTestMembership() *Membership {
+	return NewMembership(slog.New(slog.DiscardHandler), time.Second, 200*time.Millisecond, time.Second, 3)
+}
+
+// Calls updateQueue.Take repeatedly, checking that updates are dropped after the retransmit limit
+func TestUpdateQueueTakeLimit(t *testing.T) {
+	q := newUpdateQueue()
+	q.Push(MemberUpdate{Address: "node1:8001", State: peerAlive})
+
+	for i := 0; i < 2; i++ {
+		if updates := q.Take(10, 2); len(updates) != 1 {
+			t.Fatalf("Take() returned %v updates on round %v, want 1", len(updates), i)
+		}
+	}
+	if updates := q.Take(10, 2); len(updates) != 0 {
+		t.Errorf("Take() returned %v after the retransmit limit", updates)
+	}
+}
+
+// Calls PeerSet.Suspect and PeerSet.MarkAlive, checking the incarnation rules
+func TestPeerSetSuspectAndRefute(t *testing.T) {
+	set := NewPeerSet()
+	set.Add("node1:8001", "")
+
+	if !set.Suspect("node1:8001", 0) {
+		t.Fatal("Suspect() didn't mark alive peer suspect")
+	}
+	if set.MarkAlive("node1:8001", 0) {
+		t.Error("MarkAlive() with the same incarnation overrode suspicion")
+	}
+	if !set.MarkAlive("node1:8001", 1) {
+		t.Error("MarkAlive() with newer incarnation didn't override suspicion")
+	}
+	if set.Suspect("node1:8001", 0) {
+		t.Error("Suspect() with older incarnation overrode alive state")
+	}
+}
+
+// Calls Membership.Apply with a suspicion about this node, checking that it is refuted
+func TestMembershipApplyRefutesSelf(t *testing.T) {
+	m := newTestMembership()
+
+	m.Apply([]MemberUpdate{{Address: localAddress(), NodeID: identity.ID, State: peerSuspect, Incarnation: 0}}, false)
+
+	if m.incarnation.Load() != 1 {
+		t.Errorf("Incarnation = %v, want 1", m.incarnation.Load())
+	}
+	updates := m.updates.Take(10, 10)
+	if len(updates) != 1 || updates[0].State != peerAlive || updates[0].Incarnation != 1 {
+		t.Errorf("Queued updates = %+v, want alive at incarnation 1", updates)
+	}
+}
+
+// Calls Membership.Apply with a suspicion about this node at an incarnation from before a restart,
+// checking that the refutation is newer than the received incarnation
+func TestMembershipApplyRefutesAfterRestart(t *testing.T) {
+	m := newTestMembership()
+
+	m.Apply([]MemberUpdate{{Address: localAddress(), NodeID: identity.ID, State: peerSuspect, Incarnation: 5}}, false)
+
+	updates := m.updates.Take(10, 10)
+	if len(updates) != 1 || updates[0].State != peerAlive || updates[0].Incarnation != 6 {
+		t.Errorf("Queued updates = %+v, want alive at incarnation 6", updates)
+	}
+}
+
+// Calls Membership.Apply with a suspicion at the largest incarnation from an unproven sender,
+// checking that the member can still refute it
+func TestMembershipApplyCapsUnprovenIncarnation(t *testing.T) {
+	m := newTestMembership()
+	peers = NewPeerSet()
+	peers.Add("node1:8001", "id1")
+
+	m.Apply([]MemberUpdate{{Address: "node1:8001", NodeID: "id1", State: peerSuspect, Incarnation: math.MaxUint64}}, false)
+
+	peer, _ := peers.Get("node1:8001")
+	if peer.State != peerSuspect || peer.Incarnation != 0 {
+		t.Fatalf("Member = %+v, want suspect at incarnation 0", peer)
+	}
+
+	m.Apply([]MemberUpdate{{Address: "node1:8001", NodeID: "id1", State: peerAlive, Incarnation: 1}}, false)
+
+	if peer, _ := peers.Get("node1:8001"); peer.State != peerAlive {
+		t.Errorf("Member after refutation = %+v, want alive", peer)
+	}
+}
+
+// Calls Membership.Apply with a death update from unproven and proven senders,
+// checking that the first only raises suspicion and the second removes the member
+func TestMembershipApplyDead(t *testing.T) {
+	m := newTestMembership()
+	peers = NewPeerSet()
+	peers.Add("node1:8001", "id1")
+	dead := []MemberUpdate{{Address: "node1:8001", NodeID: "id1", State: peerDead, Incarnation: 0}}
+
+	m.Apply(dead, false)
+
+	peer, ok := peers.Get("node1:8001")
+	if !ok || peer.State != peerSuspect {
+		t.Fatalf("Member after unproven death update = %+v, %v, want suspect", peer, ok)
+	}
+
+	m.Apply(dead, true)
+
+	if peers.Contains("node1:8001") {
+		t.Error("Proven death update didn't remove the member")
+	}
+}
+
+// Fails sends to a member until the threshold, checking that it becomes suspect instead of being removed,
+// and that sends refused by an open circuit breaker don't count
+func TestGossiperSendFailedSuspects(t *testing.T) {
+	membership = newTestMembership()
+	g, _ := newTestGossiper(5, 5, "node1:8001")
+	msg := GossipMessage{ID: "test:1", Kind: "test", TTL: 1}
+
+	for range 2 * maxPeerFailures {
+		g.sendFailed("node1:8001", msg, fmt.Errorf("%w for node1:8001", ErrCircuitOpen))
+	}
+	if peer, _ := peers.Get("node1:8001"); peer.State != peerAlive || peer.Failures != 0 {
+		t.Fatalf("Member after refused sends = %+v, want alive without failures", peer)
+	}
+
+	for range maxPeerFailures {
+		g.sendFailed("node1:8001", msg, errors.New("connection refused"))
+	}
+	peer, ok := peers.Get("node1:8001")
+	if !ok || peer.State != peerSuspect {
+		t.Errorf("Member after failed sends = %+v, %v, want suspect", peer, ok)
+	}
+}
+
+// Probes a member answering POST /swim/ping, checking that it stays alive
+func TestMembershipProbeAlive(t *testing.T) {
+	membership = newTestMembership()
+	srv := httptest.NewServer(handleSwimPing(slog.New(slog.DiscardHandler)))
+	defer srv.Close()
+
+	address := strings.TrimPrefix(srv.URL, "http://")
+	peers = NewPeerSet()
+	peers.Add(address, "")
+
+	membership.probe(address)
+
+	peer, _ := peers.Get(address)
+	if peer.State != peerAlive || peer.LastSuccess.IsZero() {
+		t.Errorf("Probed member = %+v, want alive with recorded success", peer)
+	}
+}
+
+// Probes an unreachable member, checking that it becomes suspect and is removed after the timeout
+func TestMembershipProbeSuspect(t *testing.T) {
+	m := newTestMembership()
+	m.suspectTimeout = 0
+	peers = NewPeerSet()
+	peers.Add("127.0.0.1:1", "")
+
+	m.probe("127.0.0.1:1")
+
+	peer, _ := peers.Get("127.0.0.1:1")
+	if peer.State != peerSuspect {
+		t.Fatalf("Unreachable member state = %v, want %v", peer.State, peerSuspect)
+	}
+
+	time.Sleep(time.Millisecond)
+	m.expireSuspects()
+
+	if peers.Contains("127.0.0.1:1") {
+		t.Error("Suspect member wasn't removed after the suspicion timeout")
+	}
+}
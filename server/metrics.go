@@ -0,0 +1,468 @@
+package server
+
+import (
+	"GoChain/block"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Content type of the Prometheus text exposition format
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Buckets in seconds for request, send and mining durations
+var (
+	latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+	miningBuckets  = []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60}
+	depthBuckets   = []float64{1, 2, 3, 5, 10, 20, 50}
+)
+
+// Metric written in the text exposition format
+type metric interface {
+	write(w io.Writer) error
+}
+
+// Set of metrics exposed together
+type MetricsRegistry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+// Creates empty registry
+func NewMetricsRegistry() *MetricsRegistry {
+	return &MetricsRegistry{}
+}
+
+func (r *MetricsRegistry) register(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.metrics = append(r.metrics, m)
+}
+
+// Writes all metrics in the order they were registered
+func (r *MetricsRegistry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	metrics := slices.Clone(r.metrics)
+	r.mu.Unlock()
+
+	for _, m := range metrics {
+		if err := m.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Name, help and label names shared by all metric types
+type metricDesc struct {
+	name   string
+	help   string
+	labels []string
+}
+
+// Writes HELP and TYPE lines
+func (d metricDesc) writeHeader(w io.Writer, kind string) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, d.help, d.name, kind)
+	return err
+}
+
+// Returns key of the series with the label values
+func (d metricDesc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("Metric %v takes %v label values, got %v", d.name, len(d.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// Returns label set like {route="/chain",code="200"}, with extra label appended
+func (d metricDesc) labelSet(key string, extra ...string) string {
+	pairs := []string{}
+	if len(d.labels) > 0 {
+		for i, value := range strings.Split(key, "\xff") {
+			pairs = append(pairs, d.labels[i]+`="`+labelEscaper.Replace(value)+`"`)
+		}
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+`="`+labelEscaper.Replace(extra[i+1])+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Escapes label value for the text format
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Formats sample value
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+// Value of a counter or gauge per label values
+type valueMetric struct {
+	metricDesc
+	kind string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func (m *valueMetric) write(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.writeHeader(w, m.kind); err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(m.values))
+	for key := range m.values {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		if _, err := fmt.Fprintf(w, "%s%s %s\n", m.name, m.labelSet(key), formatValue(m.values[key])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Monotonically increasing count
+type Counter struct {
+	valueMetric
+}
+
+// Registers counter with the label names
+func (r *MetricsRegistry) NewCounter(name string, help string, labels ...string) *Counter {
+	c := &Counter{valueMetric{metricDesc: metricDesc{name, help, labels}, kind: "counter", values: make(map[string]float64)}}
+	if len(labels) == 0 {
+		c.values[""] = 0
+	}
+	r.register(c)
+	return c
+}
+
+// Adds one to the series with the label values
+func (c *Counter) Inc(labels ...string) {
+	c.Add(1, labels...)
+}
+
+// Adds v to the series with the label values
+func (c *Counter) Add(v float64, labels ...string) {
+	key := c.key(labels)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.values[key] += v
+}
+
+// Value that can go up and down
+type Gauge struct {
+	valueMetric
+}
+
+// Registers gauge with the label names
+func (r *MetricsRegistry) NewGauge(name string, help string, labels ...string) *Gauge {
+	g := &Gauge{valueMetric{metricDesc: metricDesc{name, help, labels}, kind: "gauge", values: make(map[string]float64)}}
+	if len(labels) == 0 {
+		g.values[""] = 0
+	}
+	r.register(g)
+	return g
+}
+
+// Sets the series with the label values
+func (g *Gauge) Set(v float64, labels ...string) {
+	key := g.key(labels)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.values[key] = v
+}
+
+// Gauge computed on every scrape
+type gaugeFunc struct {
+	metricDesc
+	value func() float64
+}
+
+// Registers gauge reading its value from f on every scrape
+func (r *MetricsRegistry) NewGaugeFunc(name string, help string, f func() float64) {
+	r.register(&gaugeFunc{metricDesc: metricDesc{name: name, help: help}, value: f})
+}
+
+func (g *gaugeFunc) write(w io.Writer) error {
+	if err := g.writeHeader(w, "gauge"); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%s %s\n", g.name, formatValue(g.value()))
+	return err
+}
+
+// Observations of one histogram series
+type histogramSeries struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// Distribution of observed values in cumulative buckets
+type Histogram struct {
+	metricDesc
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*histogramSeries
+}
+
+// Registers histogram with the bucket upper bounds and label names
+func (r *MetricsRegistry) NewHistogram(name string, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{metricDesc: metricDesc{name, help, labels}, buckets: buckets, series: make(map[string]*histogramSeries)}
+	r.register(h)
+	return h
+}
+
+// Records value in the series with the label values
+func (h *Histogram) Observe(v float64, labels ...string) {
+	key := h.key(labels)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	for i, bound := range h.buckets {
+		if v <= bound {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += v
+}
+
+func (h *Histogram) write(w io.Writer) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := h.writeHeader(w, "histogram"); err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		s := h.series[key]
+		for i, bound := range h.buckets {
+			if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelSet(key, "le", formatValue(bound)), s.counts[i]); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n%s_sum%s %s\n%s_count%s %d\n",
+			h.name, h.labelSet(key, "le", "+Inf"), s.count,
+			h.name, h.labelSet(key), formatValue(s.sum),
+			h.name, h.labelSet(key), s.count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Metrics of the node
+type nodeMetrics struct {
+	registry *MetricsRegistry
+
+	blocksMined    *Counter
+	hashRate       *Gauge
+	miningDuration *Histogram
+
+	blocksReceived *Counter
+	blocksAccepted *Counter
+	blocksRejected *Counter
+
+	reorgs     *Counter
+	reorgDepth *Histogram
+
+	gossipLatency *Histogram
+
+	httpRequests *Counter
+	httpDuration *Histogram
+}
+
+// Metrics exposed by GET /metrics
+var metrics = newNodeMetrics()
+
+// Registers metrics of the node
+func newNodeMetrics() *nodeMetrics {
+	r := NewMetricsRegistry()
+
+	r.NewGaugeFunc("gochain_chain_height", "Number of blocks in the chain.", func() float64 {
+		return float64(len(block.GetBlockchain()))
+	})
+	r.NewGaugeFunc("gochain_tip_age_seconds", "Seconds since the last block of the chain was mined.", tipAge)
+	r.NewGaugeFunc("gochain_peers", "Number of known peers.", func() float64 {
+		return float64(peers.Len())
+	})
+
+	return &nodeMetrics{
+		registry: r,
+
+		blocksMined:    r.NewCounter("gochain_blocks_mined_total", "Blocks mined by this node."),
+		hashRate:       r.NewGauge("gochain_mining_hash_rate", "Hashes per second while mining the last block."),
+		miningDuration: r.NewHistogram("gochain_mining_duration_seconds", "Time spent mining a block.", miningBuckets),
+
+		blocksReceived: r.NewCounter("gochain_blocks_received_total", "Blocks received from peers."),
+		blocksAccepted: r.NewCounter("gochain_blocks_accepted_total", "Received blocks added to the chain."),
+		blocksRejected: r.NewCounter("gochain_blocks_rejected_total", "Received blocks not added to the chain.", "reason"),
+
+		reorgs:     r.NewCounter("gochain_reorgs_total", "Chain replacements dropping blocks of the old chain."),
+		reorgDepth: r.NewHistogram("gochain_reorg_depth_blocks", "Blocks of the old chain dropped by a reorg.", depthBuckets),
+
+		gossipLatency: r.NewHistogram("gochain_gossip_send_duration_seconds", "Time to deliver a gossip message to a peer.", latencyBuckets, "kind", "result"),
+
+		httpRequests: r.NewCounter("gochain_http_requests_total", "HTTP requests by route and status code.", "route", "method", "code"),
+		httpDuration: r.NewHistogram("gochain_http_request_duration_seconds", "Duration of HTTP requests by route.", latencyBuckets, "route", "method"),
+	}
+}
+
+// Returns seconds since the tip was mined, zero for an empty chain
+func tipAge() float64 {
+	tip, err := getTip()
+	if err != nil {
+		return 0
+	}
+	mined, err := time.Parse(time.RFC3339, tip.Time)
+	if err != nil {
+		return 0
+	}
+	return time.Since(mined).Seconds()
+}
+
+// Records block mined in the given time
+func (m *nodeMetrics) observeMined(b block.Block, elapsed time.Duration) {
+	m.blocksMined.Inc()
+	m.miningDuration.Observe(elapsed.Seconds())
+	if elapsed > 0 {
+		// The nonce counts the hashes tried before the valid one
+		m.hashRate.Set(float64(b.Nonce+1) / elapsed.Seconds())
+	}
+}
+
+// Records outcome of a block received from a peer, reason is empty for accepted blocks
+func (m *nodeMetrics) observeReceived(reason string) {
+	m.blocksReceived.Inc()
+	if reason == "" {
+		m.blocksAccepted.Inc()
+		return
+	}
+	m.blocksRejected.Inc(reason)
+}
+
+// Returns reason of rejecting a received block
+func rejectReason(err error) string {
+	switch {
+	case errors.Is(err, block.ErrKnownBlock):
+		return "known"
+	case errors.Is(err, block.ErrPrevHashMismatch):
+		return "bad-linkage"
+	}
+	return blockOffence(err)
+}
+
+// Records status code of the response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Keeps streaming responses working through the recorder
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Keeps WebSocket upgrades working through the recorder
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("Connection can't be hijacked")
+	}
+	r.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+// Counts requests of the route and measures their duration.
+// Routes are labelled by their pattern, so paths with parameters share one series.
+func observeRoute(route Route) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: w}
+
+			next.ServeHTTP(rec, r)
+
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+			metrics.httpRequests.Inc(route.Path, route.Method, strconv.Itoa(rec.status))
+			metrics.httpDuration.Observe(time.Since(start).Seconds(), route.Path, route.Method)
+		})
+	}
+}
+
+// Returns node metrics in the Prometheus text format.
+// Route: GET /metrics
+func handleMetrics(logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Info("Request", "route", "GET /metrics")
+
+			w.Header().Set("Content-Type", metricsContentType)
+			w.WriteHeader(http.StatusOK)
+			if err := metrics.registry.WriteText(w); err != nil {
+				logger.Error("Failed to write metrics", "err", err)
+			}
+		},
+	)
+}
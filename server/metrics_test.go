@@ -0,0 +1,91 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Writes a counter and a histogram, checking the text exposition output
+func TestMetricsRegistryWriteText(t *testing.T) {
+	r := NewMetricsRegistry()
+	counter := r.NewCounter("test_total", "Test counter.", "reason")
+	histogram := r.NewHistogram("test_seconds", "Test histogram.", []float64{0.1, 1})
+
+	counter.Inc("bad \"hash\"")
+	counter.Add(2, "known")
+	histogram.Observe(0.5)
+	histogram.Observe(2)
+
+	var out strings.Builder
+	if err := r.WriteText(&out); err != nil {
+		t.Fatalf("WriteText() returned an error: %v", err)
+	}
+
+	want := `# HELP test_total Test counter.
+# TYPE test_total counter
+test_total{reason="bad \"hash\""} 1
+test_total{reason="known"} 2
+# HELP test_seconds Test histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{le="0.1"} 0
+test_seconds_bucket{le="1"} 1
+test_seconds_bucket{le="+Inf"} 2
+test_seconds_sum 2.5
+test_seconds_count 2
+`
+	if out.String() != want {
+		t.Errorf("WriteText() =\n%v\nwant\n%v", out.String(), want)
+	}
+}
+
+// Sends requests through the node routes, checking that GET /metrics reports them with node metrics
+func TestHandleMetrics(t *testing.T) {
+	mux := http.NewServeMux()
+	addRoutes(mux, slog.New(slog.DiscardHandler))
+
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/blocks/unknown", nil))
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if rec.Header().Get("Content-Type") != metricsContentType {
+		t.Errorf("Content-Type = %q, want %q", rec.Header().Get("Content-Type"), metricsContentType)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		"gochain_chain_height ",
+		"gochain_peers ",
+		`gochain_http_requests_total{route="/blocks/{hash}",method="GET",code="404"}`,
+		`gochain_http_request_duration_seconds_count{route="/blocks/{hash}",method="GET"}`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("GET /metrics is missing %v", want)
+		}
+	}
+}
+
+// Returns value of the counter series with the label values
+func counterValue(c *Counter, labels ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.values[c.key(labels)]
+}
+
+// Records an accepted and an invalid received block, checking the accepted and rejected counters
+func TestReceivedBlockMetrics(t *testing.T) {
+	accepted := counterValue(metrics.blocksAccepted)
+	rejected := counterValue(metrics.blocksRejected, offenceInvalidBlock)
+
+	metrics.observeReceived(rejectReason(nil))
+	metrics.observeReceived(offenceInvalidBlock)
+
+	if got := counterValue(metrics.blocksAccepted); got != accepted+1 {
+		t.Errorf("Accepted blocks = %v, want %v", got, accepted+1)
+	}
+	if got := counterValue(metrics.blocksRejected, offenceInvalidBlock); got != rejected+1 {
+		t.Errorf("Rejected invalid blocks = %v, want %v", got, rejected+1)
+	}
+}
@@ -0,0 +1,258 @@
+package server
+
+import (
+	"GoChain/client"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Version of the OpenAPI specification the document follows
+const openAPIVersion = "3.1.0"
+
+// Matches parameters in route paths like /blocks/{hash}
+var pathParamPattern = regexp.MustCompile(`\{([^}]+)\}`)
+
+// Builds JSON schemas of Go types, collecting named structs as reusable components
+type schemaBuilder struct {
+	components map[string]any
+}
+
+// Returns schema of the value, a oneOf of the listed types or the type of the value
+func (s *schemaBuilder) valueSchema(v any) map[string]any {
+	if alternatives, ok := v.(oneOf); ok {
+		schemas := []any{}
+		for _, alternative := range alternatives {
+			schemas = append(schemas, s.valueSchema(alternative))
+		}
+		return map[string]any{"oneOf": schemas}
+	}
+	return s.schema(reflect.TypeOf(v))
+}
+
+// Returns schema of the type as encoding/json serialises it
+func (s *schemaBuilder) schema(t reflect.Type) map[string]any {
+	switch t {
+	case reflect.TypeFor[time.Time]():
+		return map[string]any{"type": "string", "format": "date-time"}
+	case reflect.TypeFor[json.RawMessage]():
+		return map[string]any{}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return s.schema(t.Elem())
+	case reflect.Interface:
+		return map[string]any{}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		// Nil slices are serialised as null
+		return map[string]any{"type": []string{"array", "null"}, "items": s.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": s.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.structSchema(t)
+		}
+		if _, ok := s.components[t.Name()]; !ok {
+			// Reserve the name first so recursive types refer to themselves
+			s.components[t.Name()] = nil
+			s.components[t.Name()] = s.structSchema(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+	default:
+		return map[string]any{}
+	}
+}
+
+// Returns object schema with a property per serialised field.
+// Fields without omitempty or omitzero are always present and required.
+func (s *schemaBuilder) structSchema(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	required := []string{}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = field.Name
+		}
+
+		properties[name] = s.schema(field.Type)
+		if !strings.Contains(options, "omitempty") && !strings.Contains(options, "omitzero") {
+			required = append(required, name)
+		}
+	}
+
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// Returns response object with the body of the route
+func (s *schemaBuilder) response(status int, body any, contentType string) map[string]any {
+	response := map[string]any{"description": http.StatusText(status)}
+	if body != nil {
+		response["content"] = map[string]any{contentType: map[string]any{"schema": s.valueSchema(body)}}
+	}
+	return response
+}
+
+// Returns parameters of the route, path parameters default to strings
+func routeParams(route Route) []any {
+	params := []any{}
+	for _, match := range pathParamPattern.FindAllStringSubmatch(route.Path, -1) {
+		param := Param{Name: match[1], In: "path", Type: "string"}
+		for _, p := range route.Params {
+			if p.In == "path" && p.Name == param.Name {
+				param = p
+			}
+		}
+		params = append(params, map[string]any{
+			"name": param.Name, "in": "path", "required": true,
+			"description": param.Description, "schema": map[string]any{"type": param.Type},
+		})
+	}
+	for _, p := range route.Params {
+		if p.In == "query" {
+			params = append(params, map[string]any{
+				"name": p.Name, "in": "query",
+				"description": p.Description, "schema": map[string]any{"type": p.Type},
+			})
+		}
+	}
+	return params
+}
+
+// Security schemes of API clients, see requireScope
+var clientSecuritySchemes = map[string]any{
+	"apiKey": map[string]any{"type": "apiKey", "in": "header", "name": client.APIKeyHeader},
+	"hmac": map[string]any{
+		"type": "apiKey", "in": "header", "name": "Authorization",
+		"description": client.HMACScheme + " KeyId=<id>, Timestamp=<unix>, Nonce=<nonce>, Signature=<hex>",
+	},
+	"jwt": map[string]any{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+}
+
+// Returns security requirements of a client route needing the scope.
+// Reading needs no credentials unless anonymous scopes are restricted.
+func clientSecurity(scope string) []any {
+	roles := []any{}
+	if scope != "" {
+		roles = append(roles, scope)
+	}
+	security := []any{}
+	for _, name := range []string{"apiKey", "hmac", "jwt"} {
+		security = append(security, map[string]any{name: roles})
+	}
+	if scope != scopeSubmit {
+		security = append(security, map[string]any{})
+	}
+	return security
+}
+
+// Builds OpenAPI document describing the routes.
+// Errors returned by the middleware of each route class are added to its responses.
+func openAPIDocument(routes []Route) map[string]any {
+	s := &schemaBuilder{components: map[string]any{}}
+	paths := map[string]any{}
+	components := map[string]any{"schemas": s.components}
+
+	for _, route := range routes {
+		responses := map[string]any{}
+		for status, body := range route.Responses {
+			// Errors are returned as JSON on every route
+			contentType := "application/json"
+			if route.ContentType != "" && status < http.StatusBadRequest {
+				contentType = route.ContentType
+			}
+			responses[strconv.Itoa(status)] = s.response(status, body, contentType)
+		}
+		middlewareErrors := []int{http.StatusBadRequest, http.StatusForbidden, http.StatusTooManyRequests}
+		switch route.Class {
+		case routeAdmin:
+			middlewareErrors = []int{http.StatusUnauthorized, http.StatusForbidden}
+		case routeRead, routeMining:
+			middlewareErrors = append(middlewareErrors, http.StatusUnauthorized)
+		}
+		for _, status := range middlewareErrors {
+			if _, ok := route.Responses[status]; !ok {
+				responses[strconv.Itoa(status)] = s.response(status, ErrorData{}, "application/json")
+			}
+		}
+
+		operation := map[string]any{
+			"operationId": strings.ToLower(route.Method) + strings.ReplaceAll(pathParamPattern.ReplaceAllString(route.Path, "$1"), "/", "_"),
+			"summary":     route.Summary,
+			"tags":        []string{route.Class},
+			"parameters":  routeParams(route),
+			"responses":   responses,
+		}
+		switch route.Class {
+		case routeAdmin:
+			components["securitySchemes"] = map[string]any{"adminToken": map[string]any{"type": "http", "scheme": "bearer"}}
+			operation["security"] = []any{map[string]any{"adminToken": []any{}}}
+		case routeRead, routeMining:
+			components["securitySchemes"] = clientSecuritySchemes
+			operation["security"] = clientSecurity(route.Scope)
+		}
+		if route.Request != nil {
+			operation["requestBody"] = map[string]any{
+				"required": true,
+				"content":  map[string]any{"application/json": map[string]any{"schema": s.valueSchema(route.Request)}},
+			}
+		}
+
+		item, ok := paths[route.Path].(map[string]any)
+		if !ok {
+			item = map[string]any{}
+			paths[route.Path] = item
+		}
+		item[strings.ToLower(route.Method)] = operation
+	}
+
+	return map[string]any{
+		"openapi": openAPIVersion,
+		"info": map[string]any{
+			"title":   "GoChain node API",
+			"version": strconv.Itoa(protocolVersion),
+		},
+		"paths":      paths,
+		"components": components,
+	}
+}
+
+// Returns OpenAPI document of the routes, built once at startup.
+// Route: GET /openapi.json and GET /admin/openapi.json
+func handleOpenAPI(logger *slog.Logger, routes []Route) http.Handler {
+	doc := openAPIDocument(routes)
+
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Info("Request", "route", "GET "+r.URL.Path)
+			_ = encode(w, r, http.StatusOK, doc)
+		},
+	)
+}
@@ -0,0 +1,276 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Request sent to a route in the conformance test
+type conformanceCase struct {
+	target string
+	body   string
+}
+
+// Returns the OpenAPI document served by GET /openapi.json or GET /admin/openapi.json
+func servedOpenAPI(t *testing.T, routes []Route) map[string]any {
+	for _, route := range routes {
+		if route.Path != "/openapi.json" && route.Path != "/admin/openapi.json" {
+			continue
+		}
+		rec := httptest.NewRecorder()
+		route.Handler.ServeHTTP(rec, httptest.NewRequest("GET", route.Path, nil))
+
+		var doc map[string]any
+		if err := json.NewDecoder(rec.Body).Decode(&doc); err != nil {
+			t.Fatalf("Decoding GET %v returned an error: %v", route.Path, err)
+		}
+		return doc
+	}
+	t.Fatal("No OpenAPI document route is registered")
+	return nil
+}
+
+// Checks that value decoded from JSON matches the schema of the document
+func validateSchema(doc map[string]any, schema map[string]any, value any, path string) error {
+	if ref, ok := schema["$ref"].(string); ok {
+		name := strings.TrimPrefix(ref, "#/components/schemas/")
+		target, ok := doc["components"].(map[string]any)["schemas"].(map[string]any)[name].(map[string]any)
+		if !ok {
+			return fmt.Errorf("%v: unknown schema %v", path, ref)
+		}
+		return validateSchema(doc, target, value, path)
+	}
+
+	if alternatives, ok := schema["oneOf"].([]any); ok {
+		matches := 0
+		for _, alternative := range alternatives {
+			if validateSchema(doc, alternative.(map[string]any), value, path) == nil {
+				matches++
+			}
+		}
+		if matches != 1 {
+			return fmt.Errorf("%v: matches %v of the oneOf schemas, want 1", path, matches)
+		}
+		return nil
+	}
+
+	types := []string{}
+	switch t := schema["type"].(type) {
+	case string:
+		types = append(types, t)
+	case []any:
+		for _, name := range t {
+			types = append(types, name.(string))
+		}
+	}
+	if len(types) == 0 {
+		return nil
+	}
+
+	var actual string
+	switch value.(type) {
+	case nil:
+		actual = "null"
+	case bool:
+		actual = "boolean"
+	case float64:
+		actual = "number"
+		if slices.Contains(types, "integer") && value.(float64) == float64(int64(value.(float64))) {
+			actual = "integer"
+		}
+	case string:
+		actual = "string"
+	case []any:
+		actual = "array"
+	case map[string]any:
+		actual = "object"
+	}
+	if !slices.Contains(types, actual) {
+		return fmt.Errorf("%v: got %v, want %v", path, actual, types)
+	}
+
+	switch v := value.(type) {
+	case []any:
+		items, _ := schema["items"].(map[string]any)
+		for i, item := range v {
+			if err := validateSchema(doc, items, item, fmt.Sprintf("%v[%v]", path, i)); err != nil {
+				return err
+			}
+		}
+	case map[string]any:
+		required, _ := schema["required"].([]any)
+		for _, name := range required {
+			if _, ok := v[name.(string)]; !ok {
+				return fmt.Errorf("%v: missing required property %v", path, name)
+			}
+		}
+		properties, _ := schema["properties"].(map[string]any)
+		for name, property := range v {
+			propertySchema, ok := properties[name].(map[string]any)
+			if !ok {
+				propertySchema, ok = schema["additionalProperties"].(map[string]any)
+			}
+			if !ok {
+				return fmt.Errorf("%v: unexpected property %v", path, name)
+			}
+			if err := validateSchema(doc, propertySchema, property, path+"."+name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Sends requests to every registered route,
+// checking that each status code and response body is described by the OpenAPI document
+func TestRoutesConformToOpenAPI(t *testing.T) {
+	genesis := ensureGenesis(t)
+	routes := apiRoutes(slog.New(slog.DiscardHandler), NewRateLimiter(1, 1))
+	doc := servedOpenAPI(t, routes)
+
+	cases := map[string][]conformanceCase{
+		"GET /ping":                    {{target: "/ping"}},
+		"GET /healthz":                 {{target: "/healthz"}},
+		"GET /readyz":                  {{target: "/readyz"}},
+		"GET /chain":                   {{target: "/chain"}},
+		"GET /nodes":                   {{target: "/nodes"}},
+		"GET /blocks/{hash}":           {{target: "/blocks/" + genesis.Hash}, {target: "/blocks/unknown"}},
+		"GET /blocks/by-index/{index}": {{target: "/blocks/by-index/0"}, {target: "/blocks/by-index/first"}},
+		"GET /tip":                     {{target: "/tip"}},
+		"GET /status":                  {{target: "/status"}},
+		"GET /events":                  {{target: "/events?since=0"}, {target: "/events?types=unknown"}},
+		"GET /ws":                      {{target: "/ws"}},
+		"GET /openapi.json":            {{target: "/openapi.json"}},
+		"GET /metrics":                 {{target: "/metrics"}},
+		"POST /add":                    {{target: "/add", body: `{"data": "conformance"}`}},
+		"POST /rpc":                    {{target: "/rpc", body: `{"jsonrpc": "2.0", "method": "chain_getTip", "id": 1}`}, {target: "/rpc", body: `[{"jsonrpc": "2.0", "method": "node_status", "id": 1}]`}, {target: "/rpc", body: `{"jsonrpc": "2.0", "method": "net_peers"}`}},
+		"POST /receive-block":          {{target: "/receive-block", body: `{`}},
+		"POST /hello":                  {{target: "/hello", body: `{"nonce": "abc"}`}, {target: "/hello", body: `{}`}},
+		"POST /handshake":              {{target: "/handshake", body: `{`}},
+		"POST /gossip":                 {{target: "/gossip", body: `{`}},
+		"POST /inv":                    {{target: "/inv", body: `{"hashes": ["` + genesis.Hash + `"]}`}},
+		"POST /getdata":                {{target: "/getdata", body: `{"hashes": ["` + genesis.Hash + `"]}`}},
+		"POST /swim/ping":              {{target: "/swim/ping", body: `{"updates": []}`}},
+		"POST /swim/ping-req":          {{target: "/swim/ping-req", body: `{"target": "localhost:1"}`}, {target: "/swim/ping-req", body: `{`}},
+		"GET /pex":                     {{target: "/pex"}},
+	}
+	checkConformance(t, routes, doc, cases)
+}
+
+// Sends requests to every admin route,
+// checking that each status code and response body is described by the admin OpenAPI document
+func TestAdminRoutesConformToOpenAPI(t *testing.T) {
+	ensureGenesis(t)
+	peerDB = NewPeerDB(filepath.Join(t.TempDir(), "peers.json"), time.Hour)
+	t.Cleanup(func() { miningPaused.Store(false) })
+	routes := adminRoutes(slog.New(slog.DiscardHandler))
+	doc := servedOpenAPI(t, routes)
+
+	cases := map[string][]conformanceCase{
+		"GET /admin/peers":              {{target: "/admin/peers"}},
+		"POST /admin/peers":             {{target: "/admin/peers", body: `{`}, {target: "/admin/peers", body: `{"address": "localhost:1"}`}},
+		"DELETE /admin/peers/{address}": {{target: "/admin/peers/conformance:1"}},
+		"POST /admin/ban":               {{target: "/admin/ban", body: `{`}},
+		"POST /admin/unban":             {{target: "/admin/unban", body: `{"address": "conformance:1"}`}},
+		"POST /admin/mining/pause":      {{target: "/admin/mining/pause"}},
+		"POST /admin/mining/resume":     {{target: "/admin/mining/resume"}},
+		"POST /admin/resync":            {{target: "/admin/resync", body: `{`}, {target: "/admin/resync", body: `{"address": "localhost:1"}`}},
+		"POST /admin/compact":           {{target: "/admin/compact"}},
+		"GET /admin/log-levels":         {{target: "/admin/log-levels"}},
+		"POST /admin/log-levels":        {{target: "/admin/log-levels", body: `{"levels": {"mining": "info"}}`}, {target: "/admin/log-levels", body: `{"levels": {"unknown": "debug"}}`}},
+		"GET /admin/state":              {{target: "/admin/state"}},
+		"GET /admin/openapi.json":       {{target: "/admin/openapi.json"}},
+	}
+	checkConformance(t, routes, doc, cases)
+}
+
+// Sends the cases to each route, checking responses against the document
+func checkConformance(t *testing.T, routes []Route, doc map[string]any, cases map[string][]conformanceCase) {
+	for _, route := range routes {
+		pattern := route.Method + " " + route.Path
+		tests, ok := cases[pattern]
+		if !ok {
+			t.Errorf("No conformance case for %v", pattern)
+			continue
+		}
+
+		mux := http.NewServeMux()
+		mux.Handle(pattern, route.Handler)
+		operation := doc["paths"].(map[string]any)[route.Path].(map[string]any)[strings.ToLower(route.Method)].(map[string]any)
+
+		for _, test := range tests {
+			req := httptest.NewRequest(route.Method, test.target, strings.NewReader(test.body))
+			// Streams end right after the headers
+			if route.ContentType == "text/event-stream" {
+				ctx, cancel := context.WithCancel(req.Context())
+				cancel()
+				req = req.WithContext(ctx)
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			response, ok := operation["responses"].(map[string]any)[strconv.Itoa(rec.Code)].(map[string]any)
+			if !ok {
+				t.Errorf("%v %v returned %v, which is not in the document", route.Method, test.target, rec.Code)
+				continue
+			}
+			content, ok := response["content"].(map[string]any)
+			if !ok {
+				if rec.Body.Len() != 0 {
+					t.Errorf("%v %v returned a body for %v without content", route.Method, test.target, rec.Code)
+				}
+				continue
+			}
+
+			contentType := rec.Header().Get("Content-Type")
+			media, ok := content[contentType].(map[string]any)
+			if !ok {
+				t.Errorf("%v %v returned content type %q, which is not in the document", route.Method, test.target, contentType)
+				continue
+			}
+			if contentType != "application/json" {
+				continue
+			}
+
+			var body any
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				t.Errorf("%v %v returned invalid JSON: %v", route.Method, test.target, err)
+				continue
+			}
+			if err := validateSchema(doc, media["schema"].(map[string]any), body, "body"); err != nil {
+				t.Errorf("%v %v response doesn't conform: %v", route.Method, test.target, err)
+			}
+		}
+	}
+}
+
+// Builds the document, checking that every route is listed with its path parameters
+func TestOpenAPIDocumentPaths(t *testing.T) {
+	routes := apiRoutes(slog.New(slog.DiscardHandler), NewRateLimiter(1, 1))
+	doc := servedOpenAPI(t, routes)
+
+	if doc["openapi"] != openAPIVersion {
+		t.Errorf("openapi = %v, want %v", doc["openapi"], openAPIVersion)
+	}
+	paths := doc["paths"].(map[string]any)
+	for _, route := range routes {
+		if _, ok := paths[route.Path].(map[string]any)[strings.ToLower(route.Method)]; !ok {
+			t.Errorf("%v %v is missing from the document", route.Method, route.Path)
+		}
+	}
+
+	params := paths["/blocks/by-index/{index}"].(map[string]any)["get"].(map[string]any)["parameters"].([]any)
+	if len(params) != 1 || params[0].(map[string]any)["schema"].(map[string]any)["type"] != "integer" {
+		t.Errorf("Parameters of GET /blocks/by-index/{index} = %v, want integer index", params)
+	}
+}
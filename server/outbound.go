@@ -0,0 +1,196 @@
+package server
+
+import (
+	"log/slog"
+	"sync"
+)
+
+// Policies applied when the queue of a peer is full
+const (
+	// Drops the oldest queued message to make room for the new one
+	dropOldest = "drop-oldest"
+	// Drops the new message
+	dropNewest = "drop-newest"
+	// Blocks the sender until there is room in the queue
+	blockWhenFull = "block"
+)
+
+// Default outbound settings, overridable with OUTBOUND_WORKERS, OUTBOUND_QUEUE_SIZE and OUTBOUND_DROP_POLICY
+const (
+	defaultOutboundWorkers    = 8
+	defaultOutboundQueueSize  = 64
+	defaultOutboundDropPolicy = dropOldest
+)
+
+// Settings of the outbound queues
+type OutboxConfig struct {
+	Workers    int
+	QueueSize  int
+	DropPolicy string
+}
+
+// Returns outbound settings from environment variables
+func outboxConfigFromEnv() OutboxConfig {
+	config := OutboxConfig{
+		Workers:    envInt("OUTBOUND_WORKERS", defaultOutboundWorkers),
+		QueueSize:  envInt("OUTBOUND_QUEUE_SIZE", defaultOutboundQueueSize),
+		DropPolicy: envString("OUTBOUND_DROP_POLICY", defaultOutboundDropPolicy),
+	}
+	switch config.DropPolicy {
+	case dropOldest, dropNewest, blockWhenFull:
+	default:
+		slog.Warn("Invalid environment value, using default", "name", "OUTBOUND_DROP_POLICY", "value", config.DropPolicy, "default", defaultOutboundDropPolicy)
+		config.DropPolicy = defaultOutboundDropPolicy
+	}
+	return config
+}
+
+// Returns default outbound settings
+func defaultOutboxConfig() OutboxConfig {
+	return OutboxConfig{Workers: defaultOutboundWorkers, QueueSize: defaultOutboundQueueSize, DropPolicy: defaultOutboundDropPolicy}
+}
+
+// Outbound message queue per peer drained by a bounded pool of workers.
+// Messages to one peer are sent in order by one worker at a time,
+// so a slow peer only holds up its own queue.
+// Workers are started on demand and exit when there is nothing to send.
+type Outbox struct {
+	logger *slog.Logger
+	config OutboxConfig
+
+	// Sends message to a single peer
+	send func(address string, msg GossipMessage) error
+	// Called when sending to a peer fails
+	onFailure func(address string, msg GossipMessage, err error)
+
+	mu      sync.Mutex
+	space   *sync.Cond
+	queues  map[string][]GossipMessage
+	active  map[string]bool
+	ready   []string
+	workers int
+	dropped uint64
+}
+
+// Creates outbox sending messages with send and reporting failures to onFailure
+func NewOutbox(logger *slog.Logger, config OutboxConfig, send func(string, GossipMessage) error, onFailure func(string, GossipMessage, error)) *Outbox {
+	if config.Workers < 1 {
+		config.Workers = 1
+	}
+	if config.QueueSize < 1 {
+		config.QueueSize = 1
+	}
+	o := &Outbox{
+		logger:    logger,
+		config:    config,
+		send:      send,
+		onFailure: onFailure,
+		queues:    make(map[string][]GossipMessage),
+		active:    make(map[string]bool),
+	}
+	o.space = sync.NewCond(&o.mu)
+	return o
+}
+
+// Queues message for the peer, applying the drop policy if its queue is full.
+// Returns false if the message was dropped.
+func (o *Outbox) Enqueue(address string, msg GossipMessage) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for len(o.queues[address]) >= o.config.QueueSize {
+		switch o.config.DropPolicy {
+		case dropNewest:
+			o.dropped++
+			o.logger.Warn("Outbound queue is full, dropped message", "peer", address, "message", msg.ID)
+			return false
+		case blockWhenFull:
+			o.space.Wait()
+		default:
+			o.dropped++
+			o.logger.Warn("Outbound queue is full, dropped message", "peer", address, "message", o.queues[address][0].ID)
+			o.queues[address] = o.queues[address][1:]
+		}
+	}
+
+	o.queues[address] = append(o.queues[address], msg)
+	if !o.active[address] {
+		o.active[address] = true
+		o.ready = append(o.ready, address)
+		if o.workers < o.config.Workers {
+			o.workers++
+			go o.work()
+		}
+	}
+	return true
+}
+
+// Removes queued messages of the peer
+func (o *Outbox) Drop(address string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.dropped += uint64(len(o.queues[address]))
+	delete(o.queues, address)
+	o.space.Broadcast()
+}
+
+// Returns the number of queued messages
+func (o *Outbox) Pending() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	pending := 0
+	for _, queue := range o.queues {
+		pending += len(queue)
+	}
+	return pending
+}
+
+// Returns the number of messages dropped because of full queues or removed peers
+func (o *Outbox) Dropped() uint64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.dropped
+}
+
+// Sends one message at a time from peers with queued messages until there are none left
+func (o *Outbox) work() {
+	for {
+		o.mu.Lock()
+		if len(o.ready) == 0 {
+			o.workers--
+			o.mu.Unlock()
+			return
+		}
+		address := o.ready[0]
+		o.ready = o.ready[1:]
+
+		queue := o.queues[address]
+		if len(queue) == 0 {
+			delete(o.queues, address)
+			delete(o.active, address)
+			o.mu.Unlock()
+			continue
+		}
+		msg := queue[0]
+		o.queues[address] = queue[1:]
+		o.space.Broadcast()
+		o.mu.Unlock()
+
+		if err := o.send(address, msg); err != nil && o.onFailure != nil {
+			o.onFailure(address, msg, err)
+		}
+
+		// Put the peer back at the end so other peers get their turn
+		o.mu.Lock()
+		if len(o.queues[address]) > 0 {
+			o.ready = append(o.ready, address)
+		} else {
+			delete(o.queues, address)
+			delete(o.active, address)
+		}
+		o.mu.Unlock()
+	}
+}
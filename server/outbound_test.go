@@ -0,0 +1,140 @@
+package server
+
+import (
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Records messages delivered by an outbox, blocking sends to the slow peer until released
+type outboxRecorder struct {
+	mu        sync.Mutex
+	delivered map[string][]string
+	slow      string
+	release   chan struct{}
+}
+
+func newOutboxRecorder(slow string) *outboxRecorder {
+	return &outboxRecorder{delivered: make(map[string][]string), slow: slow, release: make(chan struct{})}
+}
+
+func (r *outboxRecorder) send(address string, msg GossipMessage) error {
+	if address == r.slow {
+		<-r.release
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.delivered[address] = append(r.delivered[address], msg.ID)
+	return nil
+}
+
+func (r *outboxRecorder) get(address string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string{}, r.delivered[address]...)
+}
+
+// Waits until n messages are delivered to the address or a second passes
+func (r *outboxRecorder) wait(address string, n int) []string {
+	deadline := time.Now().Add(time.Second)
+	for len(r.get(address)) < n && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	return r.get(address)
+}
+
+func newTestOutbox(config OutboxConfig, recorder *outboxRecorder) *Outbox {
+	return NewOutbox(slog.New(slog.DiscardHandler), config, recorder.send, nil)
+}
+
+// Queues messages for one peer, checking that they are delivered in order
+func TestOutboxOrder(t *testing.T) {
+	recorder := newOutboxRecorder("")
+	o := newTestOutbox(OutboxConfig{Workers: 4, QueueSize: 10, DropPolicy: dropOldest}, recorder)
+
+	for _, id := range []string{"a", "b", "c"} {
+		o.Enqueue("node1:8001", GossipMessage{ID: id})
+	}
+
+	got := recorder.wait("node1:8001", 3)
+	if len(got) != 3 || got[0] != "a" || got[1] != "b" || got[2] != "c" {
+		t.Errorf("Delivered %v, want [a b c]", got)
+	}
+}
+
+// Queues messages for a slow and a fast peer, checking that the slow peer doesn't delay the fast one
+func TestOutboxSlowPeer(t *testing.T) {
+	recorder := newOutboxRecorder("node1:8001")
+	defer close(recorder.release)
+	o := newTestOutbox(OutboxConfig{Workers: 2, QueueSize: 10, DropPolicy: dropOldest}, recorder)
+
+	o.Enqueue("node1:8001", GossipMessage{ID: "a"})
+	o.Enqueue("node2:8002", GossipMessage{ID: "a"})
+
+	if got := recorder.wait("node2:8002", 1); len(got) != 1 {
+		t.Errorf("Fast peer got %v while slow peer was blocked, want [a]", got)
+	}
+}
+
+// Fills the queue of a blocked peer with each drop policy, checking which messages are kept
+func TestOutboxDropPolicies(t *testing.T) {
+	tests := []struct {
+		policy string
+		want   []string
+	}{
+		{dropOldest, []string{"first", "c"}},
+		{dropNewest, []string{"first", "b"}},
+	}
+
+	for _, test := range tests {
+		recorder := newOutboxRecorder("node1:8001")
+		o := newTestOutbox(OutboxConfig{Workers: 1, QueueSize: 1, DropPolicy: test.policy}, recorder)
+
+		// First message is taken by the worker which blocks on the slow peer
+		o.Enqueue("node1:8001", GossipMessage{ID: "first"})
+		for o.Pending() != 0 {
+			time.Sleep(time.Millisecond)
+		}
+		o.Enqueue("node1:8001", GossipMessage{ID: "b"})
+		o.Enqueue("node1:8001", GossipMessage{ID: "c"})
+		close(recorder.release)
+
+		got := recorder.wait("node1:8001", 2)
+		if len(got) != 2 || got[0] != test.want[0] || got[1] != test.want[1] || o.Dropped() != 1 {
+			t.Errorf("%v delivered %v with %v dropped, want %v with 1 dropped", test.policy, got, o.Dropped(), test.want)
+		}
+	}
+}
+
+// Fills the queue of a blocked peer with block policy, checking that the sender waits for room
+func TestOutboxBlockWhenFull(t *testing.T) {
+	recorder := newOutboxRecorder("node1:8001")
+	o := newTestOutbox(OutboxConfig{Workers: 1, QueueSize: 1, DropPolicy: blockWhenFull}, recorder)
+
+	o.Enqueue("node1:8001", GossipMessage{ID: "first"})
+	for o.Pending() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	o.Enqueue("node1:8001", GossipMessage{ID: "b"})
+
+	done := make(chan struct{})
+	go func() {
+		o.Enqueue("node1:8001", GossipMessage{ID: "c"})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("Enqueue() returned while the queue was full")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(recorder.release)
+	<-done
+	if got := recorder.wait("node1:8001", 3); len(got) != 3 {
+		t.Errorf("Delivered %v, want all three messages", got)
+	}
+}
@@ -0,0 +1,243 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Default peer client settings, overridable with PEER_TIMEOUT, PEER_RETRIES, PEER_RETRY_BACKOFF,
+// PEER_MAX_CONNS, PEER_BREAKER_THRESHOLD and PEER_BREAKER_COOLDOWN
+const (
+	defaultPeerTimeout          = 5 * time.Second
+	defaultPeerRetries          = 2
+	defaultPeerRetryBackoff     = 200 * time.Millisecond
+	defaultPeerMaxConns         = 8
+	defaultPeerBreakerThreshold = 5
+	defaultPeerBreakerCooldown  = 30 * time.Second
+)
+
+// Returned when requests to a peer are suspended by its circuit breaker
+var ErrCircuitOpen = errors.New("Circuit breaker is open")
+
+// Settings of the peer client
+type PeerClientConfig struct {
+	Timeout          time.Duration
+	Retries          int
+	RetryBackoff     time.Duration
+	MaxConnsPerHost  int
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+}
+
+// Returns peer client settings from environment variables
+func peerClientConfigFromEnv() PeerClientConfig {
+	return PeerClientConfig{
+		Timeout:          envDuration("PEER_TIMEOUT", defaultPeerTimeout),
+		Retries:          envInt("PEER_RETRIES", defaultPeerRetries),
+		RetryBackoff:     envDuration("PEER_RETRY_BACKOFF", defaultPeerRetryBackoff),
+		MaxConnsPerHost:  envInt("PEER_MAX_CONNS", defaultPeerMaxConns),
+		BreakerThreshold: envInt("PEER_BREAKER_THRESHOLD", defaultPeerBreakerThreshold),
+		BreakerCooldown:  envDuration("PEER_BREAKER_COOLDOWN", defaultPeerBreakerCooldown),
+	}
+}
+
+// Circuit breaker state of one peer
+type breaker struct {
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// HTTP client shared by all requests to peers.
+// Connections are pooled per peer, every request gets a deadline,
+// idempotent requests are retried with jittered backoff,
+// and requests to a peer that keeps failing are suspended by its circuit breaker.
+type PeerClient struct {
+	client *http.Client
+	config PeerClientConfig
+
+	mu       sync.Mutex
+	breakers map[string]*breaker
+}
+
+// HTTP client used for requests to peers, replaced in Run with configured settings
+var peerClient = NewPeerClient(PeerClientConfig{
+	Timeout:          defaultPeerTimeout,
+	Retries:          defaultPeerRetries,
+	RetryBackoff:     defaultPeerRetryBackoff,
+	MaxConnsPerHost:  defaultPeerMaxConns,
+	BreakerThreshold: defaultPeerBreakerThreshold,
+	BreakerCooldown:  defaultPeerBreakerCooldown,
+}, nil)
+
+// Creates peer client, using TLS for requests if tlsConfig is set.
+// Each TLS connection checks that the peer certificate is bound to the node ID expected at the address.
+func NewPeerClient(config PeerClientConfig, tlsConfig *TLSConfig) *PeerClient {
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   config.MaxConnsPerHost,
+		MaxConnsPerHost:       config.MaxConnsPerHost,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   config.Timeout,
+		ResponseHeaderTimeout: config.Timeout,
+	}
+	if tlsConfig != nil {
+		transport.DialTLSContext = func(ctx context.Context, network string, address string) (net.Conn, error) {
+			dialer := &tls.Dialer{NetDialer: &net.Dialer{Timeout: config.Timeout}, Config: tlsConfig.ClientConfig(expectedNodeID(address))}
+			return dialer.DialContext(ctx, network, address)
+		}
+	}
+	return &PeerClient{
+		client:   &http.Client{Transport: transport},
+		config:   config,
+		breakers: make(map[string]*breaker),
+	}
+}
+
+// Sends request to a peer without retries
+func (c *PeerClient) Do(req *http.Request) (*http.Response, error) {
+	return c.do(req, 0)
+}
+
+// Sends request that is safe to repeat, retrying on connection errors and server errors.
+// GET requests passed to Do are retried the same way.
+func (c *PeerClient) DoIdempotent(req *http.Request) (*http.Response, error) {
+	return c.do(req, c.config.Retries)
+}
+
+func (c *PeerClient) do(req *http.Request, retries int) (*http.Response, error) {
+	if req.Method == http.MethodGet || req.Method == http.MethodHead {
+		retries = c.config.Retries
+	}
+	address := req.URL.Host
+
+	var lastErr error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			if err := c.wait(req.Context(), attempt); err != nil {
+				return nil, lastErr
+			}
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				req.Body = body
+			}
+		}
+
+		if !c.allow(address) {
+			return nil, fmt.Errorf("%w for %v", ErrCircuitOpen, address)
+		}
+
+		resp, err := c.send(req)
+		if err == nil && resp.StatusCode < http.StatusInternalServerError {
+			c.recordResult(address, true)
+			return resp, nil
+		}
+		c.recordResult(address, false)
+
+		if err != nil {
+			lastErr = err
+		} else {
+			lastErr = fmt.Errorf("Unexpected response: %v, from %v", resp.StatusCode, address)
+			if attempt == retries {
+				return resp, nil
+			}
+			resp.Body.Close()
+		}
+		if req.Body != nil && req.GetBody == nil {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+// Sends request once with the client timeout, keeping the deadline until the body is closed
+func (c *PeerClient) send(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), c.config.Timeout)
+
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// Sleeps jittered exponential backoff before the retry attempt
+func (c *PeerClient) wait(ctx context.Context, attempt int) error {
+	backoff := c.config.RetryBackoff << (attempt - 1)
+	backoff = backoff/2 + time.Duration(rand.Int63n(int64(backoff)+1))
+
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Checks if circuit breaker of the peer lets a request through.
+// After the cooldown one trial request is let through to probe the peer.
+func (c *PeerClient) allow(address string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b, ok := c.breakers[address]
+	if !ok || b.failures < c.config.BreakerThreshold {
+		return true
+	}
+	if time.Now().Before(b.openUntil) || b.probing {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// Updates circuit breaker of the peer with the request result
+func (c *PeerClient) recordResult(address string, success bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if success {
+		delete(c.breakers, address)
+		return
+	}
+
+	b, ok := c.breakers[address]
+	if !ok {
+		b = &breaker{}
+		c.breakers[address] = b
+	}
+	b.failures++
+	b.probing = false
+	if b.failures >= c.config.BreakerThreshold {
+		b.openUntil = time.Now().Add(c.config.BreakerCooldown)
+	}
+}
+
+// Response body that releases the request context when closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
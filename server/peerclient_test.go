@@ -0,0 +1,126 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testPeerClient(threshold int) *PeerClient {
+	return NewPeerClient(PeerClientConfig{
+		Timeout:          200 * time.Millisecond,
+		Retries:          2,
+		RetryBackoff:     time.Millisecond,
+		MaxConnsPerHost:  2,
+		BreakerThreshold: threshold,
+		BreakerCooldown:  50 * time.Millisecond,
+	}, nil)
+}
+
+// Sends GET to a node failing once, checking that the request is retried
+func TestPeerClientRetriesGet(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	req, _ := http.NewRequest("GET", srv.URL+"/chain", nil)
+	resp, err := testPeerClient(10).Do(req)
+	if err != nil {
+		t.Fatalf("Do() returned an error: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || calls.Load() != 2 {
+		t.Errorf("Do() = %v after %v calls, want 200 after 2 calls", resp.StatusCode, calls.Load())
+	}
+}
+
+// Sends POST to a failing node with Do and DoIdempotent, checking that only DoIdempotent retries
+func TestPeerClientRetriesIdempotentPost(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+	client := testPeerClient(10)
+
+	req, _ := http.NewRequest("POST", srv.URL+"/gossip", strings.NewReader("{}"))
+	resp, _ := client.Do(req)
+	resp.Body.Close()
+	if calls.Load() != 1 {
+		t.Errorf("Do() made %v calls, want 1", calls.Load())
+	}
+
+	calls.Store(0)
+	req, _ = http.NewRequest("POST", srv.URL+"/inv", strings.NewReader("{}"))
+	resp, _ = client.DoIdempotent(req)
+	resp.Body.Close()
+	if calls.Load() != 3 {
+		t.Errorf("DoIdempotent() made %v calls, want 3", calls.Load())
+	}
+}
+
+// Sends request to a hung node, checking that it times out
+func TestPeerClientTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	start := time.Now()
+	req, _ := http.NewRequest("POST", srv.URL+"/gossip", strings.NewReader("{}"))
+	if _, err := testPeerClient(10).Do(req); err == nil {
+		t.Fatalf("Do() returned no error for hung node")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Do() took %v, want about the timeout", elapsed)
+	}
+}
+
+// Fails requests until the breaker opens, checking that requests are suspended until the cooldown passes
+func TestPeerClientCircuitBreaker(t *testing.T) {
+	var healthy atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	client := testPeerClient(2)
+
+	post := func() (*http.Response, error) {
+		req, _ := http.NewRequest("POST", srv.URL+"/gossip", strings.NewReader("{}"))
+		return client.Do(req)
+	}
+	for i := 0; i < 2; i++ {
+		resp, _ := post()
+		resp.Body.Close()
+	}
+
+	healthy.Store(true)
+	if _, err := post(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Do() = %v, want ErrCircuitOpen", err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	resp, err := post()
+	if err != nil {
+		t.Fatalf("Do() after cooldown returned an error: %v", err)
+	}
+	resp.Body.Close()
+}
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default peer database settings, overridable with PEER_DB, PEER_DB_MAX_AGE and PEER_DB_SAVE_INTERVAL
+const (
+	defaultPeerDBPath         = "peers.json"
+	defaultPeerDBMaxAge       = 7 * 24 * time.Hour
+	defaultPeerDBSaveInterval = time.Minute
+)
+
+// Defines the JSON file of the peer database
+type peerDBFile struct {
+	SavedAt time.Time `json:"savedAt"`
+	Peers   []Peer    `json:"peers"`
+	Bans    []Ban     `json:"bans"`
+}
+
+// Peers and bans saved to disk so a restarted node can reconnect to its previous neighbours.
+// Entries not seen within max age and expired bans are pruned.
+type PeerDB struct {
+	path   string
+	maxAge time.Duration
+
+	mu      sync.Mutex
+	records map[string]Peer
+}
+
+// Creates peer database stored in the file at path
+func NewPeerDB(path string, maxAge time.Duration) *PeerDB {
+	return &PeerDB{path: path, maxAge: maxAge, records: make(map[string]Peer)}
+}
+
+// Reads saved peers and active bans, dropping stale entries.
+// Missing file is treated as an empty database.
+func (db *PeerDB) Load() ([]Peer, []Ban, error) {
+	content, err := os.ReadFile(db.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to read peer database: %w", err)
+	}
+
+	var file peerDBFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return nil, nil, fmt.Errorf("Failed to decode peer database %v: %w", db.path, err)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, peer := range file.Peers {
+		db.records[peer.Address] = peer
+	}
+	db.prune()
+
+	bans := []Ban{}
+	now := time.Now()
+	for _, ban := range file.Bans {
+		if ban.Until.After(now) {
+			bans = append(bans, ban)
+		}
+	}
+	return db.list(), bans, nil
+}
+
+// Merges current peers into the database and writes it to disk with current bans.
+// Previously saved peers that are not connected now are kept until they get stale,
+// and saved peers keep the time they were first seen.
+func (db *PeerDB) Save(current []Peer, bans []Ban) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, peer := range current {
+		if saved, ok := db.records[peer.Address]; ok && saved.NodeID == peer.NodeID && !saved.FirstSeen.IsZero() && saved.FirstSeen.Before(peer.FirstSeen) {
+			peer.FirstSeen = saved.FirstSeen
+		}
+		db.records[peer.Address] = peer
+	}
+	db.prune()
+
+	content, err := json.MarshalIndent(peerDBFile{SavedAt: time.Now(), Peers: db.list(), Bans: bans}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Failed to encode peer database: %w", err)
+	}
+
+	// Write to temporary file first so a crash doesn't leave a truncated database
+	tmp, err := os.CreateTemp(filepath.Dir(db.path), filepath.Base(db.path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("Failed to write peer database: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("Failed to write peer database: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("Failed to write peer database: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), db.path); err != nil {
+		return fmt.Errorf("Failed to write peer database: %w", err)
+	}
+	return nil
+}
+
+// Drops records of peers that are not connected now and rewrites the database.
+// Returns the number of dropped records.
+func (db *PeerDB) Compact(current []Peer, bans []Ban) (int, error) {
+	db.mu.Lock()
+	removed := len(db.records)
+	for _, peer := range current {
+		if _, ok := db.records[peer.Address]; ok {
+			removed--
+		}
+	}
+	db.records = make(map[string]Peer)
+	db.mu.Unlock()
+
+	if err := db.Save(current, bans); err != nil {
+		return 0, err
+	}
+	return removed, nil
+}
+
+// Removes records not seen within max age and banned peers, db.mu must be held
+func (db *PeerDB) prune() {
+	cutoff := time.Now().Add(-db.maxAge)
+	for address, peer := range db.records {
+		if peer.LastSeen.Before(cutoff) || banList.IsBanned(address, peer.NodeID) {
+			delete(db.records, address)
+		}
+	}
+}
+
+// Returns records sorted by address, db.mu must be held
+func (db *PeerDB) list() []Peer {
+	list := make([]Peer, 0, len(db.records))
+	for _, peer := range db.records {
+		list = append(list, peer)
+	}
+	slices.SortFunc(list, func(a, b Peer) int { return strings.Compare(a.Address, b.Address) })
+	return list
+}
+
+// Saves known peers and bans at the interval until the context is cancelled
+func (db *PeerDB) Run(ctx context.Context, logger *slog.Logger, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := db.Save(peers.List(), banList.List()); err != nil {
+				logger.Error("Failed to save peers", "err", err)
+			}
+		}
+	}
+}
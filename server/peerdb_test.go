@@ -0,0 +1,113 @@
+package server
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Calls PeerDB.Save and PeerDB.Load, checking that peers survive the round trip
+func TestPeerDBRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers.json")
+	now := time.Now()
+
+	err := NewPeerDB(path, time.Hour).Save([]Peer{{Address: "node1:8001", NodeID: "id1", LastSeen: now, Failures: 2}}, nil)
+	if err != nil {
+		t.Fatalf("Save() returned an error: %v", err)
+	}
+
+	loaded, _, err := NewPeerDB(path, time.Hour).Load()
+
+	if err != nil || len(loaded) != 1 || loaded[0].NodeID != "id1" || loaded[0].Failures != 2 {
+		t.Errorf("Load() = %+v, %v, want saved peer", loaded, err)
+	}
+}
+
+// Calls PeerDB.Load with a missing file, checking that an empty database is returned
+func TestPeerDBLoadMissing(t *testing.T) {
+	loaded, _, err := NewPeerDB(filepath.Join(t.TempDir(), "missing.json"), time.Hour).Load()
+
+	if err != nil || len(loaded) != 0 {
+		t.Errorf("Load() = %v, %v, want empty database", loaded, err)
+	}
+}
+
+// Saves a stale peer, checking that it is pruned by age
+func TestPeerDBPrunesStale(t *testing.T) {
+	db := NewPeerDB(filepath.Join(t.TempDir(), "peers.json"), time.Hour)
+
+	err := db.Save([]Peer{
+		{Address: "node1:8001", LastSeen: time.Now()},
+		{Address: "node2:8002", LastSeen: time.Now().Add(-2 * time.Hour)},
+	}, nil)
+	if err != nil {
+		t.Fatalf("Save() returned an error: %v", err)
+	}
+
+	loaded, _, _ := db.Load()
+	if len(loaded) != 1 || loaded[0].Address != "node1:8001" {
+		t.Errorf("Load() = %+v, want only node1:8001", loaded)
+	}
+}
+
+// Saves a peer again with a later first seen time, as after a restart, checking that the original one is kept
+func TestPeerDBKeepsFirstSeen(t *testing.T) {
+	db := NewPeerDB(filepath.Join(t.TempDir(), "peers.json"), time.Hour)
+	firstSeen := time.Now().Add(-time.Minute).Round(0)
+
+	db.Save([]Peer{{Address: "node1:8001", NodeID: "id1", FirstSeen: firstSeen, LastSeen: time.Now()}}, nil)
+	db.Save([]Peer{{Address: "node1:8001", NodeID: "id1", FirstSeen: time.Now(), LastSeen: time.Now()}}, nil)
+
+	loaded, _, _ := db.Load()
+	if len(loaded) != 1 || !loaded[0].FirstSeen.Equal(firstSeen) {
+		t.Errorf("Load() = %+v, want first seen %v", loaded, firstSeen)
+	}
+}
+
+// Saves again without a previously loaded peer, checking that the peer is kept
+func TestPeerDBKeepsPreviousPeers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers.json")
+	NewPeerDB(path, time.Hour).Save([]Peer{{Address: "node1:8001", LastSeen: time.Now()}}, nil)
+
+	db := NewPeerDB(path, time.Hour)
+	db.Load()
+	db.Save([]Peer{{Address: "node2:8002", LastSeen: time.Now()}}, nil)
+
+	loaded, _, _ := NewPeerDB(path, time.Hour).Load()
+	if len(loaded) != 2 {
+		t.Errorf("Load() = %+v, want both peers", loaded)
+	}
+}
+
+// Saves an active and an expired ban, checking that only the active one is loaded
+func TestPeerDBBans(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers.json")
+	NewPeerDB(path, time.Hour).Save(nil, []Ban{
+		{Address: "node1:8001", Until: time.Now().Add(time.Hour)},
+		{Address: "node2:8002", Until: time.Now().Add(-time.Hour)},
+	})
+
+	_, bans, err := NewPeerDB(path, time.Hour).Load()
+
+	if err != nil || len(bans) != 1 || bans[0].Address != "node1:8001" {
+		t.Errorf("Load() = %+v, %v, want only the active ban", bans, err)
+	}
+}
+
+// Compacts a database with a previous peer, checking that only current peers are kept
+func TestPeerDBCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers.json")
+	NewPeerDB(path, time.Hour).Save([]Peer{{Address: "node1:8001", LastSeen: time.Now()}}, nil)
+
+	db := NewPeerDB(path, time.Hour)
+	db.Load()
+	removed, err := db.Compact([]Peer{{Address: "node2:8002", LastSeen: time.Now()}}, nil)
+	if err != nil || removed != 1 {
+		t.Errorf("Compact() = %v, %v, want 1 removed", removed, err)
+	}
+
+	loaded, _, _ := NewPeerDB(path, time.Hour).Load()
+	if len(loaded) != 1 || loaded[0].Address != "node2:8002" {
+		t.Errorf("Load() = %+v, want only the current peer", loaded)
+	}
+}
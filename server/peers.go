@@ -0,0 +1,483 @@
+package server
+
+import (
+	"math"
+	"math/rand"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Protocol version spoken by this node
+const protocolVersion = 1
+
+// Number of consecutive failures after which a peer becomes suspect
+const maxPeerFailures = 5
+
+// Delay before retrying a failing peer, doubled on each consecutive failure
+const (
+	peerBackoffBase = 10 * time.Second
+	peerBackoffMax  = 10 * time.Minute
+)
+
+// Membership states of a peer
+const (
+	peerAlive   = "alive"
+	peerSuspect = "suspect"
+	peerDead    = "dead"
+)
+
+// Metadata known about a single peer
+type Peer struct {
+	Address         string    `json:"address"`
+	NodeID          string    `json:"nodeId"`
+	FirstSeen       time.Time `json:"firstSeen"`
+	LastSeen        time.Time `json:"lastSeen"`
+	LastSuccess     time.Time `json:"lastSuccess,omitzero"`
+	Failures        int       `json:"failures"`
+	LatencyMs       int64     `json:"latencyMs"`
+	Height          int       `json:"height"`
+	ProtocolVersion int       `json:"protocolVersion"`
+	Capabilities    []string  `json:"capabilities"`
+	WireAddress     string    `json:"wireAddress,omitempty"`
+	State           string    `json:"state"`
+	Incarnation     uint64    `json:"incarnation"`
+	Outbound        bool      `json:"outbound"`
+	Score           float64   `json:"score"`
+	ScoreUpdated    time.Time `json:"scoreUpdated,omitzero"`
+
+	// Peer is not contacted again before this time
+	nextAttempt time.Time
+
+	// Inventory hashes the peer is known to have
+	known *seenCache
+
+	// Time the peer became suspect
+	suspectSince time.Time
+}
+
+// Thread-safe set of known peers keyed by address
+type PeerSet struct {
+	mu    sync.RWMutex
+	peers map[string]*Peer
+
+	// Peers saved before restart, restored when they are added again
+	saved map[string]Peer
+}
+
+// Creates an empty peer set
+func NewPeerSet() *PeerSet {
+	return &PeerSet{peers: make(map[string]*Peer), saved: make(map[string]Peer)}
+}
+
+// Restores misbehaviour score, first and last seen time of peers saved before restart.
+// Peers already in the set are restored now, others when they are added again with the same node ID.
+func (s *PeerSet) Restore(saved []Peer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, record := range saved {
+		if p, ok := s.peers[record.Address]; ok {
+			if p.NodeID == record.NodeID {
+				restorePeer(p, record)
+			}
+			continue
+		}
+		s.saved[record.Address] = record
+	}
+}
+
+// Copies score and timestamps of the saved record into the peer, unless the peer has newer ones
+func restorePeer(p *Peer, saved Peer) {
+	if !saved.FirstSeen.IsZero() && saved.FirstSeen.Before(p.FirstSeen) {
+		p.FirstSeen = saved.FirstSeen
+	}
+	if saved.LastSeen.After(p.LastSeen) {
+		p.LastSeen = saved.LastSeen
+	}
+	if p.ScoreUpdated.IsZero() {
+		p.Score = saved.Score
+		p.ScoreUpdated = saved.ScoreUpdated
+	}
+}
+
+// Adds peer if not present and marks it as seen.
+// A known peer keeps its node ID, which only AddVerified replaces.
+// Returns true if the peer was not known before.
+func (s *PeerSet) Add(address string, nodeID string) bool {
+	return s.add(address, nodeID, false)
+}
+
+// Adds peer like Add, replacing the node ID of a known peer with the one it proved,
+// as a node at the address may have restarted with a new identity
+func (s *PeerSet) AddVerified(address string, nodeID string) bool {
+	return s.add(address, nodeID, true)
+}
+
+func (s *PeerSet) add(address string, nodeID string, verified bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	p, ok := s.peers[address]
+	if !ok {
+		p = &Peer{Address: address, FirstSeen: now, State: peerAlive}
+		s.peers[address] = p
+	}
+	if !ok || verified || p.NodeID == "" {
+		p.NodeID = nodeID
+	}
+	p.LastSeen = now
+	if saved, found := s.saved[address]; found && !ok {
+		delete(s.saved, address)
+		if saved.NodeID == nodeID {
+			restorePeer(p, saved)
+		}
+	}
+	if !ok {
+		events.Publish(Event{Type: eventPeerJoin, Data: PeerAnnouncement{Address: address, NodeID: nodeID}})
+	}
+	return !ok
+}
+
+// Removes peer from the set
+func (s *PeerSet) Remove(address string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if p, ok := s.peers[address]; ok {
+		delete(s.peers, address)
+		events.Publish(Event{Type: eventPeerLeave, Data: PeerAnnouncement{Address: address, NodeID: p.NodeID}})
+	}
+}
+
+// Checks if peer is in the set
+func (s *PeerSet) Contains(address string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.peers[address]
+	return ok
+}
+
+// Returns node ID of the peer at address
+func (s *PeerSet) NodeID(address string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	p, ok := s.peers[address]
+	if !ok {
+		return "", false
+	}
+	return p.NodeID, true
+}
+
+// Records successful contact with the peer and resets its failure count
+func (s *PeerSet) RecordSuccess(address string, latency time.Duration, height int, version int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.peers[address]
+	if !ok {
+		return
+	}
+	now := time.Now()
+	p.LastSeen = now
+	p.LastSuccess = now
+	p.Failures = 0
+	p.LatencyMs = latency.Milliseconds()
+	p.Height = height
+	p.ProtocolVersion = version
+	p.nextAttempt = time.Time{}
+	p.State = peerAlive
+	p.suspectSince = time.Time{}
+}
+
+// Returns copy of the peer at address
+func (s *PeerSet) Get(address string) (Peer, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	p, ok := s.peers[address]
+	if !ok {
+		return Peer{}, false
+	}
+	peer := *p
+	peer.Capabilities = slices.Clone(p.Capabilities)
+	return peer, true
+}
+
+// Marks peer alive if the incarnation is newer than the known one.
+// Returns true if the state changed.
+func (s *PeerSet) MarkAlive(address string, incarnation uint64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.peers[address]
+	if !ok || incarnation <= p.Incarnation {
+		return false
+	}
+	p.Incarnation = incarnation
+	p.State = peerAlive
+	p.suspectSince = time.Time{}
+	return true
+}
+
+// Marks peer suspect if the incarnation is not older than the known one.
+// Returns true if the state changed.
+func (s *PeerSet) Suspect(address string, incarnation uint64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.peers[address]
+	if !ok || incarnation < p.Incarnation || (p.State == peerSuspect && incarnation == p.Incarnation) {
+		return false
+	}
+	p.Incarnation = incarnation
+	p.State = peerSuspect
+	p.suspectSince = time.Now()
+	return true
+}
+
+// Returns peers that have been suspect for longer than timeout
+func (s *PeerSet) ExpiredSuspects(timeout time.Duration) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	expired := []string{}
+	for address, p := range s.peers {
+		if p.State == peerSuspect && time.Since(p.suspectSince) > timeout {
+			expired = append(expired, address)
+		}
+	}
+	return expired
+}
+
+// Records protocol version, height and negotiated capabilities from a handshake
+func (s *PeerSet) RecordHandshake(address string, version int, height int, capabilities []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.peers[address]
+	if !ok {
+		return
+	}
+	p.ProtocolVersion = version
+	p.Height = height
+	p.Capabilities = capabilities
+}
+
+// Records TCP address the peer accepts binary protocol connections on
+func (s *PeerSet) SetWireAddress(address string, wireAddress string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if p, ok := s.peers[address]; ok {
+		p.WireAddress = wireAddress
+	}
+}
+
+// Returns misbehaviour score decayed by half for every half life since the last update
+func decayedScore(score float64, updated time.Time, now time.Time, halfLife time.Duration) float64 {
+	if score == 0 || halfLife <= 0 {
+		return score
+	}
+	return score * math.Pow(0.5, float64(now.Sub(updated))/float64(halfLife))
+}
+
+// Adds weight to the decayed misbehaviour score of the peer.
+// Returns the new score, false if the peer is unknown.
+func (s *PeerSet) Penalize(address string, weight int, halfLife time.Duration) (float64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.peers[address]
+	if !ok {
+		return 0, false
+	}
+	now := time.Now()
+	p.Score = decayedScore(p.Score, p.ScoreUpdated, now, halfLife) + float64(weight)
+	p.ScoreUpdated = now
+	return p.Score, true
+}
+
+// Marks peer as connected by this node
+func (s *PeerSet) MarkOutbound(address string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if p, ok := s.peers[address]; ok {
+		p.Outbound = true
+	}
+}
+
+// Returns the number of peers connected by this node
+func (s *PeerSet) OutboundLen() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	n := 0
+	for _, p := range s.peers {
+		if p.Outbound {
+			n++
+		}
+	}
+	return n
+}
+
+// Checks if capability was negotiated with the peer
+func (s *PeerSet) HasCapability(address string, capability string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	p, ok := s.peers[address]
+	return ok && slices.Contains(p.Capabilities, capability)
+}
+
+// Marks inventory hash as known to the peer.
+// Returns true if the peer wasn't known to have it before.
+func (s *PeerSet) MarkKnown(address string, hash string) bool {
+	s.mu.Lock()
+	p, ok := s.peers[address]
+	if !ok {
+		s.mu.Unlock()
+		return false
+	}
+	if p.known == nil {
+		p.known = newSeenCache(peerInventorySize, peerInventoryTTL)
+	}
+	known := p.known
+	s.mu.Unlock()
+
+	return !known.Seen(hash)
+}
+
+// Removes inventory hash known to the peer, after it failed to learn it
+func (s *PeerSet) ForgetKnown(address string, hash string) {
+	s.mu.Lock()
+	p, ok := s.peers[address]
+	if !ok || p.known == nil {
+		s.mu.Unlock()
+		return
+	}
+	known := p.known
+	s.mu.Unlock()
+
+	known.Forget(hash)
+}
+
+// Records failed contact with the peer and delays the next attempt.
+// Returns true if the peer reached the failure threshold.
+func (s *PeerSet) RecordFailure(address string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.peers[address]
+	if !ok {
+		return false
+	}
+	p.Failures++
+	p.nextAttempt = time.Now().Add(peerBackoff(p.Failures))
+	return p.Failures >= maxPeerFailures
+}
+
+// Returns the backoff delay after the given number of consecutive failures
+func peerBackoff(failures int) time.Duration {
+	delay := peerBackoffBase
+	for i := 1; i < failures; i++ {
+		delay *= 2
+		if delay >= peerBackoffMax {
+			return peerBackoffMax
+		}
+	}
+	return delay
+}
+
+// Returns addresses of all known peers
+func (s *PeerSet) Addresses() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	addresses := make([]string, 0, len(s.peers))
+	for address := range s.peers {
+		addresses = append(addresses, address)
+	}
+	slices.Sort(addresses)
+	return addresses
+}
+
+// Returns up to n random peers whose backoff has expired
+func (s *PeerSet) Due(n int) []string {
+	s.mu.RLock()
+	now := time.Now()
+	due := []string{}
+	for address, p := range s.peers {
+		if !now.Before(p.nextAttempt) {
+			due = append(due, address)
+		}
+	}
+	s.mu.RUnlock()
+
+	rand.Shuffle(len(due), func(i, j int) { due[i], due[j] = due[j], due[i] })
+	if len(due) > n {
+		due = due[:n]
+	}
+	return due
+}
+
+// Returns a copy of all peers sorted by address
+func (s *PeerSet) List() []Peer {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]Peer, 0, len(s.peers))
+	for _, p := range s.peers {
+		peer := *p
+		peer.Capabilities = slices.Clone(p.Capabilities)
+		list = append(list, peer)
+	}
+	slices.SortFunc(list, func(a, b Peer) int { return strings.Compare(a.Address, b.Address) })
+	return list
+}
+
+// Returns the number of known peers
+func (s *PeerSet) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.peers)
+}
+
+// Returns the height of the best peer, taken as the median of the heights reported by peers that aren't dead,
+// the lower of the middle two for an even number, so peers reporting false heights can't inflate it alone
+func (s *PeerSet) BestHeight() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	heights := []int{}
+	for _, p := range s.peers {
+		if p.State != peerDead {
+			heights = append(heights, p.Height)
+		}
+	}
+	if len(heights) == 0 {
+		return 0
+	}
+	slices.Sort(heights)
+	return heights[(len(heights)-1)/2]
+}
+
+// Returns addresses of peers that aren't dead and report at least the height
+func (s *PeerSet) AtHeight(height int) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	addresses := []string{}
+	for address, p := range s.peers {
+		if p.State != peerDead && p.Height >= height {
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses
+}
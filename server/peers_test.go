@@ -0,0 +1,120 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+// Calls PeerSet.Add twice with the same address, checking that the peer is stored once
+func TestPeerSetAdd(t *testing.T) {
+	set := NewPeerSet()
+
+	if !set.Add("node1:8001", "") {
+		t.Error("Add() didn't report a new peer")
+	}
+	if set.Add("node1:8001", "") {
+		t.Error("Add() reported a known peer as new")
+	}
+	if set.Len() != 1 {
+		t.Errorf("Len() = %v, want 1", set.Len())
+	}
+}
+
+// Adds a known peer again with another node ID, checking that only AddVerified replaces the node ID
+func TestPeerSetAddKeepsNodeID(t *testing.T) {
+	set := NewPeerSet()
+	set.Add("node1:8001", "id1")
+
+	set.Add("node1:8001", "id2")
+	if nodeID, _ := set.NodeID("node1:8001"); nodeID != "id1" {
+		t.Errorf("Add() changed node ID to %v, want id1", nodeID)
+	}
+	set.AddVerified("node1:8001", "id2")
+	if nodeID, _ := set.NodeID("node1:8001"); nodeID != "id2" {
+		t.Errorf("AddVerified() left node ID %v, want id2", nodeID)
+	}
+}
+
+// Restores saved peers and adds them again, checking that the score and first seen time
+// come back only for the peer with the same node ID
+func TestPeerSetRestore(t *testing.T) {
+	set := NewPeerSet()
+	firstSeen := time.Now().Add(-time.Hour)
+	set.Restore([]Peer{
+		{Address: "node1:8001", NodeID: "id1", FirstSeen: firstSeen, Score: 40, ScoreUpdated: firstSeen},
+		{Address: "node2:8002", NodeID: "id2", FirstSeen: firstSeen, Score: 40, ScoreUpdated: firstSeen},
+	})
+
+	set.Add("node1:8001", "id1")
+	set.Add("node2:8002", "other")
+
+	restored, _ := set.Get("node1:8001")
+	if restored.Score != 40 || !restored.ScoreUpdated.Equal(firstSeen) || !restored.FirstSeen.Equal(firstSeen) {
+		t.Errorf("Re-added peer = %+v, want saved score and first seen time", restored)
+	}
+	if replaced, _ := set.Get("node2:8002"); replaced.Score != 0 || replaced.FirstSeen.Equal(firstSeen) {
+		t.Errorf("Peer with another node ID = %+v, want no saved score", replaced)
+	}
+}
+
+// Calls PeerSet.RecordSuccess, checking that the metadata is stored
+func TestPeerSetRecordSuccess(t *testing.T) {
+	set := NewPeerSet()
+	set.Add("node1:8001", "")
+	set.RecordFailure("node1:8001")
+
+	set.RecordSuccess("node1:8001", 25*time.Millisecond, 7, protocolVersion)
+
+	peer := set.List()[0]
+	if peer.Failures != 0 || peer.LatencyMs != 25 || peer.Height != 7 || peer.ProtocolVersion != protocolVersion {
+		t.Errorf("RecordSuccess() stored wrong metadata: %+v", peer)
+	}
+	if peer.LastSuccess.IsZero() {
+		t.Error("RecordSuccess() didn't set last success time")
+	}
+}
+
+// Calls PeerSet.RecordFailure until the threshold, checking that it is reported only then and the peer is kept
+func TestPeerSetRecordFailureThreshold(t *testing.T) {
+	set := NewPeerSet()
+	set.Add("node1:8001", "")
+
+	for i := 1; i < maxPeerFailures; i++ {
+		if set.RecordFailure("node1:8001") {
+			t.Fatalf("RecordFailure() reported the threshold after %v failures", i)
+		}
+	}
+	if !set.RecordFailure("node1:8001") {
+		t.Error("RecordFailure() didn't report the threshold")
+	}
+	if !set.Contains("node1:8001") {
+		t.Error("RecordFailure() removed the peer, want removal left to the membership protocol")
+	}
+}
+
+// Calls PeerSet.Due after a failure, checking that the peer is skipped during backoff
+func TestPeerSetDueSkipsBackoff(t *testing.T) {
+	set := NewPeerSet()
+	set.Add("node1:8001", "")
+	set.Add("node2:8002", "")
+	set.RecordFailure("node1:8001")
+
+	due := set.Due(10)
+
+	if len(due) != 1 || due[0] != "node2:8002" {
+		t.Errorf("Due() = %v, want [node2:8002]", due)
+	}
+}
+
+// Calls peerBackoff with growing failure counts, checking that the delay is capped
+func TestPeerBackoff(t *testing.T) {
+	if peerBackoff(1) != peerBackoffBase {
+		t.Errorf("peerBackoff(1) = %v, want %v", peerBackoff(1), peerBackoffBase)
+	}
+	if peerBackoff(2) != 2*peerBackoffBase {
+		t.Errorf("peerBackoff(2) = %v, want %v", peerBackoff(2), 2*peerBackoffBase)
+	}
+	if peerBackoff(100) != peerBackoffMax {
+		t.Errorf("peerBackoff(100) = %v, want %v", peerBackoff(100), peerBackoffMax)
+	}
+}
@@ -0,0 +1,246 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Default peer exchange settings, overridable with PEX_INTERVAL, PEX_SAMPLE_SIZE and PEX_TARGET_OUTBOUND
+const (
+	defaultPexInterval       = 30 * time.Second
+	defaultPexSampleSize     = 16
+	defaultPexTargetOutbound = 8
+)
+
+// Dial attempts after which an address is dropped from the address book
+const maxDialAttempts = 5
+
+// Address learned from other nodes but not connected yet
+type candidate struct {
+	nodeID      string
+	attempts    int
+	nextAttempt time.Time
+}
+
+// Thread-safe set of addresses to dial
+type AddressBook struct {
+	mu         sync.Mutex
+	candidates map[string]*candidate
+}
+
+// Addresses learned through peer exchange, gossip and membership updates
+var addressBook = NewAddressBook()
+
+// Creates an empty address book
+func NewAddressBook() *AddressBook {
+	return &AddressBook{candidates: make(map[string]*candidate)}
+}
+
+// Adds address unless it is invalid, this node, banned or already a peer
+func (b *AddressBook) Add(address string, nodeID string) {
+	if validateNodeAddr(address) != nil || address == localAddress() || nodeID == identity.ID || peers.Contains(address) || banList.IsBanned(address, nodeID) {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.candidates[address]; !ok {
+		b.candidates[address] = &candidate{nodeID: nodeID}
+	}
+}
+
+// Removes address from the book
+func (b *AddressBook) Remove(address string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.candidates, address)
+}
+
+// Returns node ID learned for the address, empty if unknown
+func (b *AddressBook) NodeID(address string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if c, ok := b.candidates[address]; ok {
+		return c.nodeID
+	}
+	return ""
+}
+
+// Returns the number of addresses in the book
+func (b *AddressBook) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.candidates)
+}
+
+// Returns up to n random addresses that are due for a dial attempt
+func (b *AddressBook) Due(n int) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	due := []string{}
+	for address, c := range b.candidates {
+		if peers.Contains(address) {
+			delete(b.candidates, address)
+			continue
+		}
+		if !now.Before(c.nextAttempt) {
+			due = append(due, address)
+		}
+	}
+
+	rand.Shuffle(len(due), func(i, j int) { due[i], due[j] = due[j], due[i] })
+	if len(due) > n {
+		due = due[:n]
+	}
+	return due
+}
+
+// Records failed dial attempt, dropping the address after too many failures
+func (b *AddressBook) RecordFailure(address string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.candidates[address]
+	if !ok {
+		return
+	}
+	c.attempts++
+	if c.attempts >= maxDialAttempts {
+		delete(b.candidates, address)
+		return
+	}
+	c.nextAttempt = time.Now().Add(peerBackoff(c.attempts))
+}
+
+// Defines the JSON body for GET /pex response
+type PexData struct {
+	Data []PeerAnnouncement `json:"data"`
+}
+
+// Returns a random sample of healthy peers
+func healthyPeerSample(n int) []PeerAnnouncement {
+	sample := []PeerAnnouncement{}
+	for _, peer := range peers.List() {
+		if peer.State == peerAlive && peer.Failures == 0 {
+			sample = append(sample, PeerAnnouncement{Address: peer.Address, NodeID: peer.NodeID})
+		}
+	}
+
+	rand.Shuffle(len(sample), func(i, j int) { sample[i], sample[j] = sample[j], sample[i] })
+	if len(sample) > n {
+		sample = sample[:n]
+	}
+	return sample
+}
+
+// Returns a random sample of healthy peers for peer exchange.
+// Route: GET /pex
+func handlePex(logger *slog.Logger, sampleSize int) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Info("Request", "route", "GET /pex")
+			_ = encode(w, r, http.StatusOK, PexData{Data: healthyPeerSample(sampleSize)})
+		},
+	)
+}
+
+// Requests peer sample from the node with GET /pex
+func requestPeerSample(address string) ([]PeerAnnouncement, error) {
+	req, err := http.NewRequest("GET", peerURL(address, "/pex"), nil)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create request for node %v: %v", address, err)
+	}
+	setPeerHeaders(req)
+
+	resp, err := peerClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Error connecting to host: %v, %v", address, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Unexpected response: %v, from %v", resp.StatusCode, address)
+	}
+
+	data, err := decodeResponse[PexData](resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding GET /pex: %v", err)
+	}
+	return data.Data, nil
+}
+
+// Periodic peer exchange.
+// Each round one random peer is asked for a sample of its healthy peers,
+// and candidates are dialed while this node has fewer outbound peers than the target.
+type PeerExchange struct {
+	logger         *slog.Logger
+	interval       time.Duration
+	targetOutbound int
+}
+
+// Creates peer exchange with the given round interval and outbound target
+func NewPeerExchange(logger *slog.Logger, interval time.Duration, targetOutbound int) *PeerExchange {
+	return &PeerExchange{logger: logger, interval: interval, targetOutbound: targetOutbound}
+}
+
+// Asks one random healthy peer for its peers and adds them to the address book
+func (p *PeerExchange) exchange() {
+	sample := healthyPeerSample(1)
+	if len(sample) == 0 {
+		return
+	}
+
+	learned, err := requestPeerSample(sample[0].Address)
+	if err != nil {
+		p.logger.Info("Peer exchange failed", "peer", sample[0].Address, "err", err)
+		return
+	}
+	for _, peer := range learned {
+		addressBook.Add(peer.Address, peer.NodeID)
+	}
+}
+
+// Dials address book candidates until the outbound target is reached
+func (p *PeerExchange) fillOutbound() {
+	missing := p.targetOutbound - peers.OutboundLen()
+	if missing <= 0 {
+		return
+	}
+
+	for _, address := range addressBook.Due(missing) {
+		if err := connectPeer(address); err != nil {
+			p.logger.Info("Dialing peer failed", "peer", address, "err", err)
+			addressBook.RecordFailure(address)
+			continue
+		}
+		addressBook.Remove(address)
+	}
+}
+
+// Runs peer exchange rounds until the context is cancelled
+func (p *PeerExchange) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			p.logger.Info("Peer exchange stopped")
+			return
+		case <-ticker.C:
+			p.exchange()
+			p.fillOutbound()
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"testing"
+)
+
+// Calls AddressBook.Add with invalid, own and known addresses, checking that only new peers are stored
+func TestAddressBookAdd(t *testing.T) {
+	t.Setenv("LOCAL_ADDR", "node0:8000")
+	peers = NewPeerSet()
+	peers.Add("node1:8001", "")
+	book := NewAddressBook()
+
+	book.Add("not an address", "")
+	book.Add("node0:8000", "")
+	book.Add("node1:8001", "")
+	book.Add("node2:8002", "")
+
+	if due := book.Due(10); len(due) != 1 || due[0] != "node2:8002" {
+		t.Errorf("Due() = %v, want [node2:8002]", due)
+	}
+}
+
+// Calls AddressBook.RecordFailure repeatedly, checking that the address is dropped after the attempt limit
+func TestAddressBookRecordFailure(t *testing.T) {
+	peers = NewPeerSet()
+	book := NewAddressBook()
+	book.Add("node2:8002", "")
+
+	book.RecordFailure("node2:8002")
+	if len(book.Due(10)) != 0 {
+		t.Error("Due() returned an address during backoff")
+	}
+
+	for i := 1; i < maxDialAttempts; i++ {
+		book.RecordFailure("node2:8002")
+	}
+	if book.Len() != 0 {
+		t.Error("Address wasn't dropped after the attempt limit")
+	}
+}
+
+// Sends GET /pex, checking that only healthy peers are shared
+func TestHandlePex(t *testing.T) {
+	peers = NewPeerSet()
+	peers.Add("node1:8001", "id1")
+	peers.Add("node2:8002", "id2")
+	peers.Suspect("node2:8002", 0)
+	rec := httptest.NewRecorder()
+
+	handlePex(slog.New(slog.DiscardHandler), 10).ServeHTTP(rec, httptest.NewRequest("GET", "/pex", nil))
+
+	data, err := decodeResponse[PexData](io.NopCloser(rec.Body))
+	if err != nil || len(data.Data) != 1 || data.Data[0].Address != "node1:8001" || data.Data[0].NodeID != "id1" {
+		t.Errorf("GET /pex = %+v, %v, want only node1:8001", data, err)
+	}
+}
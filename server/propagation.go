@@ -0,0 +1,432 @@
+package server
+
+import (
+	"GoChain/block"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Kinds of messages carried by gossip
+const (
+	gossipBlock = "block"
+	gossipPeer  = "peer"
+)
+
+// Capability of peers accepting POST /gossip
+const capabilityGossip = "gossip"
+
+// Default propagation settings, overridable with GOSSIP_FANOUT, GOSSIP_TTL and GOSSIP_SEEN_TTL
+const (
+	defaultGossipFanout  = 3
+	defaultGossipTTL     = 6
+	defaultGossipSeenTTL = 10 * time.Minute
+	gossipSeenCacheSize  = 10000
+)
+
+func init() {
+	localCapabilities = append(localCapabilities, capabilityGossip)
+}
+
+// Defines the JSON body for POST /gossip request
+type GossipMessage struct {
+	ID      string          `json:"id"`
+	Kind    string          `json:"kind"`
+	TTL     int             `json:"ttl"`
+	Origin  string          `json:"origin"`
+	Payload json.RawMessage `json:"payload"`
+	// W3C trace context of the span that sent the message, empty if untraced
+	TraceParent string `json:"traceparent,omitempty"`
+}
+
+// Processes a received gossip message.
+// Returning an error stops the message from being forwarded.
+type gossipHandler func(msg GossipMessage, from string) error
+
+// Bounded set of recently seen message IDs
+type seenCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	size    int
+	expires map[string]time.Time
+	order   []string
+}
+
+func newSeenCache(size int, ttl time.Duration) *seenCache {
+	return &seenCache{ttl: ttl, size: size, expires: make(map[string]time.Time)}
+}
+
+// Reports whether ID was seen, without marking it
+func (c *seenCache) Contains(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires, ok := c.expires[id]
+	return ok && time.Now().Before(expires)
+}
+
+// Removes ID, so it's no longer seen
+func (c *seenCache) Forget(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.expires, id)
+	c.order = slices.DeleteFunc(c.order, func(o string) bool { return o == id })
+}
+
+// Marks ID as seen, returning true if it was already seen
+func (c *seenCache) Seen(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if expires, ok := c.expires[id]; ok && now.Before(expires) {
+		return true
+	}
+
+	// Drop expired entries and the oldest ones over the size limit
+	for len(c.order) > 0 {
+		oldest := c.order[0]
+		if len(c.order) < c.size && now.Before(c.expires[oldest]) {
+			break
+		}
+		delete(c.expires, oldest)
+		c.order = c.order[1:]
+	}
+
+	if _, ok := c.expires[id]; !ok {
+		c.order = append(c.order, id)
+	}
+	c.expires[id] = now.Add(c.ttl)
+	return false
+}
+
+// Epidemic message propagation.
+// Each message is forwarded to a random subset of peers until its TTL runs out,
+// duplicates are dropped using the seen cache.
+type Gossiper struct {
+	logger   *slog.Logger
+	fanout   int
+	ttl      int
+	seen     *seenCache
+	mu       sync.RWMutex
+	handlers map[string]gossipHandler
+	outbox   *Outbox
+	tracer   *Tracer
+
+	// Sends message to a single peer
+	send func(address string, msg GossipMessage) error
+}
+
+// Gossip propagation used by the node, replaced in NewServer
+var gossiper = NewGossiper(slog.New(slog.DiscardHandler), defaultGossipFanout, defaultGossipTTL, defaultGossipSeenTTL, defaultOutboxConfig())
+
+// Creates gossiper sending messages to peers over HTTP through outbound queues
+func NewGossiper(logger *slog.Logger, fanout int, ttl int, seenTTL time.Duration, outbox OutboxConfig) *Gossiper {
+	g := &Gossiper{
+		logger:   logger,
+		fanout:   fanout,
+		ttl:      ttl,
+		seen:     newSeenCache(gossipSeenCacheSize, seenTTL),
+		handlers: make(map[string]gossipHandler),
+		send:     sendGossipMessage,
+		tracer:   tracer,
+	}
+	g.outbox = NewOutbox(logger, outbox, func(address string, msg GossipMessage) error {
+		ctx, span := g.tracer.StartMessage(msg, spanBroadcast, spanProducer, "message", msg.ID, "kind", msg.Kind, "peer", address)
+		if span != nil {
+			msg.TraceParent = traceParent(ctx)
+		}
+
+		start := time.Now()
+		err := g.send(address, msg)
+		span.SetError(err)
+		span.End()
+
+		result := "ok"
+		if err != nil {
+			result = "error"
+		}
+		metrics.gossipLatency.Observe(time.Since(start).Seconds(), msg.Kind, result)
+		return err
+	}, g.sendFailed)
+	return g
+}
+
+// Registers handler for messages of the kind
+func (g *Gossiper) Handle(kind string, handler gossipHandler) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.handlers[kind] = handler
+}
+
+// Creates message originating from this node
+func newGossipMessage(kind string, id string, ttl int, payload any) (GossipMessage, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return GossipMessage{}, fmt.Errorf("encode json: %w", err)
+	}
+	return GossipMessage{ID: kind + ":" + id, Kind: kind, TTL: ttl, Origin: localAddress(), Payload: data}, nil
+}
+
+// Starts propagation of a message created by this node.
+// The message continues the trace carried by ctx, if any.
+// Returns once the message is queued for the selected peers.
+func (g *Gossiper) Publish(ctx context.Context, kind string, id string, payload any) error {
+	msg, err := newGossipMessage(kind, id, g.ttl, payload)
+	if err != nil {
+		return err
+	}
+	msg.TraceParent = traceParent(ctx)
+	g.seen.Seen(msg.ID)
+	g.forward(msg, "")
+	return nil
+}
+
+// Processes message received from a peer and forwards it if it was new and valid.
+// Returns false if the message was already seen.
+// Messages are marked seen only once the handler accepts them,
+// so an invalid copy sent first doesn't hide the valid one.
+func (g *Gossiper) Receive(msg GossipMessage, from string) (bool, error) {
+	return g.ReceiveFrom(msg, from, from)
+}
+
+// Processes message like Receive, where from is the sender accountable for the message
+// and relay the admitted peer it came from, which the message isn't forwarded back to.
+// They differ for requests without TLS, where the accountable sender is the client IP.
+func (g *Gossiper) ReceiveFrom(msg GossipMessage, from string, relay string) (bool, error) {
+	if g.seen.Contains(msg.ID) {
+		return false, nil
+	}
+
+	g.mu.RLock()
+	handler, ok := g.handlers[msg.Kind]
+	g.mu.RUnlock()
+
+	if !ok {
+		return true, fmt.Errorf("Unknown gossip message kind %q", msg.Kind)
+	}
+
+	ctx, span := g.tracer.StartMessage(msg, spanValidate, spanConsumer, "message", msg.ID, "kind", msg.Kind, "peer", from)
+	err := handler(msg, from)
+	span.SetError(err)
+	span.End()
+	if err != nil {
+		return true, err
+	}
+	// A copy accepted concurrently is forwarded only once
+	if g.seen.Seen(msg.ID) {
+		return false, nil
+	}
+
+	if msg.TTL > 1 {
+		msg.TTL--
+		if span != nil {
+			msg.TraceParent = traceParent(ctx)
+		}
+		g.forward(msg, relay)
+	}
+	return true, nil
+}
+
+// Sends message to up to fanout random peers, skipping the sender, the origin and peers in backoff
+func (g *Gossiper) forward(msg GossipMessage, from string) {
+	targets := slices.DeleteFunc(peers.Due(peers.Len()), func(address string) bool {
+		return address == from || address == msg.Origin
+	})
+	if len(targets) > g.fanout {
+		targets = targets[:g.fanout]
+	}
+
+	for _, address := range targets {
+		g.outbox.Enqueue(address, msg)
+	}
+}
+
+// Records failed send, raising suspicion after consecutive failures.
+// Members are only removed by the membership protocol, queued messages are dropped once they are gone.
+// Sends refused by an open circuit breaker don't count, the breaker already counted the failures that opened it.
+func (g *Gossiper) sendFailed(address string, msg GossipMessage, err error) {
+	g.logger.Info("Gossip failed", "message", msg.ID, "peer", address, "err", err)
+	if !peers.Contains(address) {
+		g.outbox.Drop(address)
+		return
+	}
+	if errors.Is(err, ErrCircuitOpen) {
+		return
+	}
+	if peers.RecordFailure(address) {
+		g.logger.Warn("Peer suspect after consecutive failures", "peer", address, "failures", maxPeerFailures)
+		membership.Suspect(address)
+	}
+}
+
+// Sends message to peer with POST /gossip.
+// Blocks are only announced to peers with inv capability, which pull them if needed.
+// Peers without gossip capability only receive blocks through POST /receive-block.
+// The trace context of the message is sent in the traceparent header or the binary protocol message.
+func sendGossipMessage(address string, msg GossipMessage) error {
+	ctx := contextWithTraceParent(context.Background(), msg.TraceParent)
+
+	// Prefer binary protocol connection, falling back to HTTP if the peer can't be reached over it
+	if peer, ok := peers.Get(address); ok && wireTransport != nil && peer.WireAddress != "" {
+		if err := wireTransport.SendGossip(address, msg); err == nil {
+			return nil
+		}
+	}
+
+	path := "/gossip"
+	var payload any = msg
+
+	if msg.Kind == gossipBlock && peers.HasCapability(address, capabilityInv) {
+		var b block.Block
+		if err := json.Unmarshal(msg.Payload, &b); err != nil {
+			return fmt.Errorf("decode json: %w", err)
+		}
+		return announceBlock(ctx, address, b.Hash, msg.TTL)
+	}
+
+	if !peers.HasCapability(address, capabilityGossip) {
+		if msg.Kind != gossipBlock {
+			return nil
+		}
+		var b block.Block
+		if err := json.Unmarshal(msg.Payload, &b); err != nil {
+			return fmt.Errorf("decode json: %w", err)
+		}
+		path = "/receive-block"
+		payload = ReceiveBlockData{Data: b, TTL: msg.TTL}
+	}
+
+	body, err := encodeRequest(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", peerURL(address, path), body)
+	if err != nil {
+		return fmt.Errorf("Failed to create request for node %v: %v", address, err)
+	}
+	setPeerHeaders(req)
+
+	resp, err := peerClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("Error connecting to host: %v, %w", address, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Unexpected response: %v, from %v", resp.StatusCode, address)
+	}
+	return nil
+}
+
+// Defines the payload of peer announcement gossip
+type PeerAnnouncement struct {
+	Address string `json:"address"`
+	NodeID  string `json:"nodeId"`
+}
+
+// Registers handlers for blocks and peer announcements.
+// Message IDs must match the payload, so a forged ID can't mark another message as seen.
+// Announced peers are added to the address book and dialed by peer exchange.
+// Senders of invalid messages are penalised.
+func registerGossipHandlers(logger *slog.Logger) {
+	gossiper.Handle(gossipBlock, func(msg GossipMessage, from string) error {
+		var b block.Block
+		if err := json.Unmarshal(msg.Payload, &b); err != nil {
+			penalizePeer(logger, from, offenceInvalidMessage)
+			metrics.observeReceived(offenceInvalidMessage)
+			return fmt.Errorf("decode json: %w", err)
+		}
+		if msg.ID != gossipBlock+":"+b.Hash {
+			penalizePeer(logger, from, offenceInvalidMessage)
+			metrics.observeReceived(offenceInvalidMessage)
+			return fmt.Errorf("Message ID %q doesn't match block %v", msg.ID, b.Hash)
+		}
+		peers.MarkKnown(from, b.Hash)
+
+		err := block.AddMinedBlock(b)
+		metrics.observeReceived(rejectReason(err))
+		if errors.Is(err, block.ErrKnownBlock) {
+			return nil
+		}
+		if err == nil {
+			publishNewTip(b)
+		}
+		if offence := blockOffence(err); offence != "" {
+			penalizePeer(logger, from, offence)
+		}
+		return err
+	})
+
+	gossiper.Handle(gossipPeer, func(msg GossipMessage, from string) error {
+		var announcement PeerAnnouncement
+		if err := json.Unmarshal(msg.Payload, &announcement); err != nil {
+			penalizePeer(logger, from, offenceInvalidMessage)
+			return fmt.Errorf("decode json: %w", err)
+		}
+		if msg.ID != gossipPeer+":"+announcement.Address+"/"+announcement.NodeID {
+			penalizePeer(logger, from, offenceInvalidMessage)
+			return fmt.Errorf("Message ID %q doesn't match announced peer %v", msg.ID, announcement.Address)
+		}
+		if err := validateNodeAddr(announcement.Address); err != nil {
+			penalizePeer(logger, from, offenceInvalidMessage)
+			return err
+		}
+		addressBook.Add(announcement.Address, announcement.NodeID)
+		return nil
+	})
+}
+
+// Defines the JSON body for POST /gossip response
+type GossipResponseData struct {
+	Data string `json:"data"`
+}
+
+// Returns the admitted peer named by the Node-Addr header of the request, empty for other clients.
+// The header isn't proven without TLS, so the peer is only skipped when forwarding, never penalised.
+func requestPeer(r *http.Request) string {
+	if address := r.Header.Get("Node-Addr"); peers.Contains(address) {
+		return address
+	}
+	return ""
+}
+
+// Receives gossip message and forwards it to other peers.
+// Route: POST /gossip
+func handleGossip(logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Info("Request", "route", "POST /gossip")
+
+			msg, err := decode[GossipMessage](r)
+
+			if err != nil || msg.ID == "" {
+				penalizePeer(logger, requestSender(r), offenceDecodeFailure)
+				_ = encode(w, r, http.StatusBadRequest, ErrorData{Error: "Invalid request body"})
+				return
+			}
+
+			isNew, err := gossiper.ReceiveFrom(msg, requestSender(r), requestPeer(r))
+
+			if err != nil {
+				logger.Info("Gossip rejected", "message", msg.ID, "peer", r.Header.Get("Node-Addr"), "err", err)
+				_ = encode(w, r, http.StatusBadRequest, ErrorData{Error: err.Error()})
+				return
+			}
+			if !isNew {
+				_ = encode(w, r, http.StatusOK, GossipResponseData{Data: "duplicate"})
+				return
+			}
+			_ = encode(w, r, http.StatusOK, GossipResponseData{Data: "accepted"})
+		},
+	)
+}
@@ -0,0 +1,218 @@
+package server
+
+import (
+	"GoChain/block"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Records messages sent by a gossiper
+type sentMessages struct {
+	mu   sync.Mutex
+	sent map[string]GossipMessage
+}
+
+func (s *sentMessages) send(address string, msg GossipMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sent[address] = msg
+	return nil
+}
+
+func (s *sentMessages) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.sent)
+}
+
+// Waits until messages are sent to n peers or a second passes
+func (s *sentMessages) wait(n int) {
+	deadline := time.Now().Add(time.Second)
+	for s.count() < n && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// Creates gossiper with fake transport and a set of peers
+func newTestGossiper(fanout int, ttl int, addresses ...string) (*Gossiper, *sentMessages) {
+	peers = NewPeerSet()
+	for _, address := range addresses {
+		peers.Add(address, "")
+	}
+	sent := &sentMessages{sent: make(map[string]GossipMessage)}
+	g := NewGossiper(slog.New(slog.DiscardHandler), fanout, ttl, time.Minute, defaultOutboxConfig())
+	g.send = sent.send
+	g.Handle("test", func(msg GossipMessage, from string) error { return nil })
+	return g, sent
+}
+
+// Calls seenCache.Seen twice with the same ID, checking that the duplicate is detected
+func TestSeenCache(t *testing.T) {
+	cache := newSeenCache(10, time.Minute)
+
+	if cache.Seen("a") {
+		t.Error("Seen() reported a new ID as seen")
+	}
+	if !cache.Seen("a") {
+		t.Error("Seen() didn't report a duplicate")
+	}
+}
+
+// Fills seenCache over its size, checking that the oldest ID is dropped
+func TestSeenCacheSizeLimit(t *testing.T) {
+	cache := newSeenCache(2, time.Minute)
+	cache.Seen("a")
+	cache.Seen("b")
+	cache.Seen("c")
+
+	if cache.Seen("a") {
+		t.Error("Seen() kept the oldest ID over the size limit")
+	}
+}
+
+// Calls Gossiper.Publish, checking that the message is sent to fanout peers only
+func TestGossiperPublishFanout(t *testing.T) {
+	g, sent := newTestGossiper(2, 5, "node1:8001", "node2:8002", "node3:8003", "node4:8004")
+
+	if err := g.Publish(context.Background(), "test", "1", "payload"); err != nil {
+		t.Fatalf("Publish() returned an error: %v", err)
+	}
+	sent.wait(2)
+	time.Sleep(10 * time.Millisecond)
+
+	if sent.count() != 2 {
+		t.Errorf("Publish() sent to %v peers, want 2", sent.count())
+	}
+}
+
+// Calls Gossiper.Receive with the same message twice, checking that the duplicate is not forwarded
+func TestGossiperReceiveDuplicate(t *testing.T) {
+	g, _ := newTestGossiper(2, 5, "node1:8001")
+	msg := GossipMessage{ID: "test:1", Kind: "test", TTL: 1}
+
+	isNew, err := g.Receive(msg, "node1:8001")
+	if !isNew || err != nil {
+		t.Errorf("Receive() = %v, %v, want new message", isNew, err)
+	}
+
+	isNew, _ = g.Receive(msg, "node1:8001")
+	if isNew {
+		t.Error("Receive() didn't detect a duplicate")
+	}
+}
+
+// Calls Gossiper.Receive, checking that the message is forwarded with decreased TTL except to the sender
+func TestGossiperReceiveForwards(t *testing.T) {
+	g, sent := newTestGossiper(5, 5, "node1:8001", "node2:8002")
+
+	g.Receive(GossipMessage{ID: "test:1", Kind: "test", TTL: 3}, "node1:8001")
+
+	sent.wait(1)
+
+	sent.mu.Lock()
+	defer sent.mu.Unlock()
+	if _, ok := sent.sent["node1:8001"]; ok {
+		t.Error("Receive() forwarded the message back to the sender")
+	}
+	if msg, ok := sent.sent["node2:8002"]; !ok || msg.TTL != 2 {
+		t.Errorf("Receive() forwarded %+v, want TTL 2 to node2:8002", msg)
+	}
+}
+
+// Receives a message over POST /gossip from an admitted peer without TLS,
+// checking that it isn't forwarded back to the peer although the client IP is the accountable sender
+func TestHandleGossipSkipsRelayingPeer(t *testing.T) {
+	g, sent := newTestGossiper(5, 5, "node1:8001", "node2:8002")
+	previous := gossiper
+	gossiper = g
+	t.Cleanup(func() { gossiper = previous })
+
+	req := httptest.NewRequest("POST", "/gossip", strings.NewReader(`{"id": "test:1", "kind": "test", "ttl": 3}`))
+	req.Header.Set("Node-Addr", "node1:8001")
+	handleGossip(slog.New(slog.DiscardHandler)).ServeHTTP(httptest.NewRecorder(), req)
+	sent.wait(1)
+	time.Sleep(10 * time.Millisecond)
+
+	sent.mu.Lock()
+	defer sent.mu.Unlock()
+	if _, ok := sent.sent["node1:8001"]; ok {
+		t.Error("POST /gossip forwarded the message back to the peer it came from")
+	}
+	if _, ok := sent.sent["node2:8002"]; !ok {
+		t.Error("POST /gossip didn't forward the message to the other peer")
+	}
+}
+
+// Calls Gossiper.Receive with TTL of one, checking that the message is not forwarded
+func TestGossiperReceiveTTLExpired(t *testing.T) {
+	g, sent := newTestGossiper(5, 5, "node1:8001", "node2:8002")
+
+	g.Receive(GossipMessage{ID: "test:1", Kind: "test", TTL: 1}, "node1:8001")
+	time.Sleep(10 * time.Millisecond)
+
+	if sent.count() != 0 {
+		t.Errorf("Receive() forwarded a message with expired TTL to %v peers", sent.count())
+	}
+}
+
+// Calls Gossiper.Receive with an unknown kind, checking if there is error message
+func TestGossiperReceiveUnknownKind(t *testing.T) {
+	g, _ := newTestGossiper(5, 5)
+
+	_, err := g.Receive(GossipMessage{ID: "other:1", Kind: "other", TTL: 1}, "")
+
+	if err == nil {
+		t.Error("Receive() didn't return an error for unknown kind")
+	}
+}
+
+// Receives a message rejected by the handler and then a valid copy,
+// checking that the rejected copy didn't mark the message as seen
+func TestGossiperReceiveRejectedNotSeen(t *testing.T) {
+	g, _ := newTestGossiper(5, 5, "node1:8001")
+	valid := false
+	g.Handle("test", func(msg GossipMessage, from string) error {
+		if !valid {
+			return errors.New("invalid payload")
+		}
+		return nil
+	})
+	msg := GossipMessage{ID: "test:1", Kind: "test", TTL: 1}
+
+	if _, err := g.Receive(msg, "node1:8001"); err == nil {
+		t.Fatal("Receive() of a rejected message returned no error")
+	}
+	valid = true
+	if isNew, err := g.Receive(msg, "node1:8001"); !isNew || err != nil {
+		t.Errorf("Receive() of the valid copy = %v, %v, want new message", isNew, err)
+	}
+}
+
+// Receives a block under the ID of another block, checking that it is rejected and the ID is not marked seen
+func TestGossiperReceiveForgedBlockID(t *testing.T) {
+	genesis := ensureGenesis(t)
+	g, _ := newTestGossiper(5, 5, "node1:8001")
+	previous := gossiper
+	gossiper = g
+	t.Cleanup(func() { gossiper = previous })
+	registerGossipHandlers(slog.New(slog.DiscardHandler))
+
+	payload, _ := json.Marshal(block.Block{Index: 99, Hash: "junk"})
+	msg := GossipMessage{ID: gossipBlock + ":" + genesis.Hash, Kind: gossipBlock, TTL: 1, Payload: payload}
+
+	if _, err := g.Receive(msg, "node1:8001"); err == nil {
+		t.Error("Receive() of a block with a forged ID returned no error")
+	}
+	if g.seen.Contains(msg.ID) {
+		t.Errorf("Forged message marked %v as seen", msg.ID)
+	}
+}
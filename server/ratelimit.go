@@ -0,0 +1,143 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default rate limits per route class in requests per second and burst size,
+// overridable with RATE_LIMIT_MINING, RATE_LIMIT_GOSSIP and RATE_LIMIT_READ as "rate,burst"
+const (
+	defaultMiningRate  = 0.1
+	defaultMiningBurst = 3
+	defaultGossipRate  = 50
+	defaultGossipBurst = 200
+	defaultReadRate    = 5
+	defaultReadBurst   = 20
+)
+
+// Number of buckets after which idle ones are dropped
+const rateLimiterCleanupSize = 10000
+
+// Token bucket of a single client
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Token bucket rate limiter keyed by client
+type RateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// Creates rate limiter refilling rate tokens per second up to burst
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	return &RateLimiter{rate: rate, burst: float64(burst), buckets: make(map[string]*tokenBucket)}
+}
+
+// Takes a token from the bucket of the key.
+// If the bucket is empty, returns false and the time until the next token.
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if len(l.buckets) >= rateLimiterCleanupSize {
+		l.cleanup(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	if l.rate <= 0 {
+		return false, time.Hour
+	}
+	return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// Drops buckets that have refilled completely, l.mu must be held
+func (l *RateLimiter) cleanup(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Parses rate limit in "rate,burst" format
+func parseRateLimit(value string) (float64, int, error) {
+	rateValue, burstValue, ok := strings.Cut(value, ",")
+	if !ok {
+		return 0, 0, fmt.Errorf("Rate limit %q is not in rate,burst format", value)
+	}
+	rate, err := strconv.ParseFloat(strings.TrimSpace(rateValue), 64)
+	if err != nil || rate < 0 {
+		return 0, 0, fmt.Errorf("Rate limit %q has invalid rate", value)
+	}
+	burst, err := strconv.Atoi(strings.TrimSpace(burstValue))
+	if err != nil || burst < 1 {
+		return 0, 0, fmt.Errorf("Rate limit %q has invalid burst", value)
+	}
+	return rate, burst, nil
+}
+
+// Creates rate limiter from environment variable, falling back to the defaults
+func envRateLimiter(name string, rate float64, burst int) *RateLimiter {
+	if value := os.Getenv(name); value != "" {
+		parsedRate, parsedBurst, err := parseRateLimit(value)
+		if err == nil {
+			return NewRateLimiter(parsedRate, parsedBurst)
+		}
+		slog.Warn("Invalid environment value, using default", "name", name, "err", err)
+	}
+	return NewRateLimiter(rate, burst)
+}
+
+// Returns rate limit key of the request.
+// Admitted peers proven by their TLS certificate are keyed by node ID, everyone else by client IP,
+// since Node-ID and Node-Addr headers alone can be copied from any peer.
+func rateLimitKey(r *http.Request) string {
+	if nodeID, ok := tlsPeerID(r); ok {
+		return "peer:" + nodeID
+	}
+	return "ip:" + remoteIP(r)
+}
+
+// Rejects requests over the limit with 429 Too Many Requests and Retry-After header
+func rateLimit(logger *slog.Logger, limiter *RateLimiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := rateLimitKey(r)
+
+			allowed, retryAfter := limiter.Allow(key)
+			if !allowed {
+				logger.Info("Rate limited", "method", r.Method, "path", r.URL.Path, "key", key)
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+				_ = encode(w, r, http.StatusTooManyRequests, ErrorData{Error: "Rate limit exceeded"})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Calls RateLimiter.Allow past the burst, checking that requests are rejected with a retry delay
+func TestRateLimiterBurst(t *testing.T) {
+	limiter := NewRateLimiter(1, 2)
+
+	for i := 0; i < 2; i++ {
+		if allowed, _ := limiter.Allow("ip:10.0.0.1"); !allowed {
+			t.Fatalf("Allow() request %v rejected within burst", i)
+		}
+	}
+
+	allowed, retryAfter := limiter.Allow("ip:10.0.0.1")
+	if allowed || retryAfter <= 0 {
+		t.Errorf("Allow() = %v, %v, want rejection with retry delay", allowed, retryAfter)
+	}
+	if allowed, _ := limiter.Allow("ip:10.0.0.2"); !allowed {
+		t.Errorf("Allow() rejected a different client")
+	}
+}
+
+// Calls parseRateLimit with valid and invalid values, checking the parsed limits
+func TestParseRateLimit(t *testing.T) {
+	rate, burst, err := parseRateLimit("0.5, 10")
+	if err != nil || rate != 0.5 || burst != 10 {
+		t.Errorf("parseRateLimit() = %v, %v, %v, want 0.5, 10", rate, burst, err)
+	}
+
+	for _, value := range []string{"5", "x,1", "1,0", "-1,5"} {
+		if _, _, err := parseRateLimit(value); err == nil {
+			t.Errorf("parseRateLimit(%q) returned no error", value)
+		}
+	}
+}
+
+// Sends requests through the rate limit middleware, checking 429 and Retry-After once over the limit
+func TestRateLimitMiddleware(t *testing.T) {
+	handler := rateLimit(slog.New(slog.DiscardHandler), NewRateLimiter(0.5, 1))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	codes := []int{}
+	var retryAfter string
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("GET", "/chain", nil)
+		req.RemoteAddr = "10.0.0.1:5000"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		codes = append(codes, rec.Code)
+		retryAfter = rec.Header().Get("Retry-After")
+	}
+
+	if codes[0] != http.StatusOK || codes[1] != http.StatusTooManyRequests || retryAfter != "2" {
+		t.Errorf("Status codes = %v, Retry-After = %q, want [200 429] and 2", codes, retryAfter)
+	}
+}
+
+// Calls rateLimitKey with and without a client certificate of a known peer, checking that only a proven peer is keyed by node ID
+func TestRateLimitKey(t *testing.T) {
+	id := mustGenerateIdentity()
+	config, _ := LoadTLSConfig(id, "", "", nil)
+	cert, _ := x509.ParseCertificate(config.certificate.Certificate[0])
+	peers = NewPeerSet()
+	peers.Add("node1:8001", id.ID)
+
+	req := httptest.NewRequest("POST", "/gossip", nil)
+	req.RemoteAddr = "10.0.0.1:5000"
+	req.Header.Set("Node-Addr", "node1:8001")
+	req.Header.Set("Node-ID", id.ID)
+	if key := rateLimitKey(req); key != "ip:10.0.0.1" {
+		t.Errorf("rateLimitKey() without certificate = %v, want ip:10.0.0.1", key)
+	}
+
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	if key := rateLimitKey(req); key != "peer:"+id.ID {
+		t.Errorf("rateLimitKey() = %v, want peer:%v", key, id.ID)
+	}
+
+	req.Header.Set("Node-Addr", "node2:8002")
+	if key := rateLimitKey(req); key != "ip:10.0.0.1" {
+		t.Errorf("rateLimitKey() for another address = %v, want ip:10.0.0.1", key)
+	}
+}
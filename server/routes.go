@@ -1,15 +1,231 @@
 package server
 
 import (
-	"log"
+	"log/slog"
 	"net/http"
+	"strings"
 )
 
-// All routes of the server
-func addRoutes(mux *http.ServeMux, logger *log.Logger) {
-	mux.Handle("GET /ping", checkIfNodeRecognised(logger)(handlePing(logger)))
-	mux.Handle("GET /chain", checkIfNodeRecognised(logger)(handleGetChain(logger)))
-	mux.Handle("GET /nodes", checkIfNodeRecognised(logger)(handleGetNodes(logger)))
-	mux.Handle("POST /add", checkIfNodeRecognised(logger)(handleAddBlock(logger)))
-	mux.Handle("POST /receive-block", checkIfNodeRecognised(logger)(handleBlockReceive(logger)))
+// Route classes, each with its own rate limit
+const (
+	routeMining = "mining"
+	routeGossip = "gossip"
+	routeRead   = "read"
+	// Served by the admin listener to localhost with a bearer token, not rate limited
+	routeAdmin = "admin"
+)
+
+// Route of the HTTP API.
+// The request and response types also describe the route in the OpenAPI document.
+type Route struct {
+	Method string
+	Path   string
+	Class  string
+	// Scope API clients need when authentication is enabled, empty for routes checking scopes themselves.
+	// Routes between nodes are not authenticated.
+	Scope   string
+	Summary string
+	Handler http.Handler
+
+	// Parameters given in the path or query
+	Params []Param
+	// Request body, nil if the route takes no body
+	Request any
+	// Response bodies by status code, nil for responses without body
+	Responses map[int]any
+	// Content type of successful responses, empty for JSON
+	ContentType string
+}
+
+// Parameter of a route
+type Param struct {
+	Name        string
+	In          string
+	Type        string
+	Description string
+}
+
+// Response body which is one of the listed types
+type oneOf []any
+
+// Returns all public routes of the API
+func apiRoutes(logger *slog.Logger, miningLimiter *RateLimiter) []Route {
+	blockResponses := map[int]any{http.StatusOK: GetBlockData{}, http.StatusNotFound: ErrorData{}}
+	eventParams := []Param{
+		{Name: "types", In: "query", Type: "string", Description: "Comma separated event types: " + strings.Join(eventTypes, ", ")},
+		{Name: "since", In: "query", Type: "integer", Description: "Replays blocks above the height, also read from the Last-Event-ID header"},
+	}
+
+	routes := []Route{
+		{
+			Method: "GET", Path: "/ping", Class: routeRead, Scope: scopeRead, Summary: "Checks that the node is alive",
+			Handler:   handlePing(logger),
+			Responses: map[int]any{http.StatusOK: GetPingData{}},
+		},
+		{
+			Method: "GET", Path: "/healthz", Class: routeRead, Summary: "Checks that the node is running",
+			Handler:   handleHealthz(logger),
+			Responses: map[int]any{http.StatusOK: HealthData{}},
+		},
+		{
+			Method: "GET", Path: "/readyz", Class: routeRead, Summary: "Checks that the node has a synced chain",
+			Handler:   handleReadyz(logger),
+			Responses: map[int]any{http.StatusOK: HealthData{}, http.StatusServiceUnavailable: HealthData{}},
+		},
+		{
+			Method: "GET", Path: "/chain", Class: routeRead, Scope: scopeRead, Summary: "Returns the entire blockchain",
+			Handler:   handleGetChain(logger),
+			Responses: map[int]any{http.StatusOK: GetChainData{}},
+		},
+		{
+			Method: "GET", Path: "/nodes", Class: routeRead, Scope: scopeRead, Summary: "Returns known peers with their metadata",
+			Handler:   handleGetNodes(logger),
+			Responses: map[int]any{http.StatusOK: GetNodesData{}},
+		},
+		{
+			Method: "GET", Path: "/blocks/{hash}", Class: routeRead, Scope: scopeRead, Summary: "Returns block with the hash",
+			Handler:   handleGetBlock(logger),
+			Responses: blockResponses,
+		},
+		{
+			Method: "GET", Path: "/blocks/by-index/{index}", Class: routeRead, Scope: scopeRead, Summary: "Returns block at the index",
+			Handler:   handleGetBlockByIndex(logger),
+			Params:    []Param{{Name: "index", In: "path", Type: "integer"}},
+			Responses: map[int]any{http.StatusOK: GetBlockData{}, http.StatusBadRequest: ErrorData{}, http.StatusNotFound: ErrorData{}},
+		},
+		{
+			Method: "GET", Path: "/tip", Class: routeRead, Scope: scopeRead, Summary: "Returns the last block of the chain",
+			Handler:   handleGetTip(logger),
+			Responses: blockResponses,
+		},
+		{
+			Method: "GET", Path: "/status", Class: routeRead, Scope: scopeRead, Summary: "Returns identity, version and chain, sync and mining state of the node",
+			Handler:   handleStatus(logger),
+			Responses: map[int]any{http.StatusOK: NodeStatusData{}},
+		},
+		{
+			Method: "GET", Path: "/events", Class: routeRead, Scope: scopeRead, Summary: "Streams node events as Server-Sent Events",
+			Handler:     handleEvents(logger),
+			Params:      eventParams,
+			Responses:   map[int]any{http.StatusOK: Event{}, http.StatusBadRequest: ErrorData{}, http.StatusInternalServerError: ErrorData{}},
+			ContentType: "text/event-stream",
+		},
+		{
+			Method: "GET", Path: "/ws", Class: routeRead, Scope: scopeRead, Summary: "Streams node events over WebSocket",
+			Handler:   handleWebSocket(logger),
+			Params:    eventParams,
+			Responses: map[int]any{http.StatusSwitchingProtocols: nil, http.StatusBadRequest: ErrorData{}},
+		},
+		{
+			Method: "GET", Path: "/openapi.json", Class: routeRead, Scope: scopeRead, Summary: "Returns this OpenAPI document",
+			Responses: map[int]any{http.StatusOK: map[string]any{}},
+		},
+		{
+			Method: "GET", Path: "/metrics", Class: routeRead, Scope: scopeRead, Summary: "Returns node metrics in the Prometheus text format",
+			Handler:     handleMetrics(logger),
+			Responses:   map[int]any{http.StatusOK: ""},
+			ContentType: metricsContentType,
+		},
+		{
+			Method: "POST", Path: "/add", Class: routeMining, Scope: scopeSubmit, Summary: "Mines block with the data and adds it to the chain",
+			Handler:   handleAddBlock(logger),
+			Request:   AddBlockData{},
+			Responses: map[int]any{http.StatusOK: GetBlockData{}, http.StatusServiceUnavailable: ErrorData{}, http.StatusInternalServerError: ErrorData{}},
+		},
+		{
+			Method: "POST", Path: "/rpc", Class: routeRead, Summary: "Calls JSON-RPC 2.0 methods, single or batched",
+			Handler:   handleRPC(logger, miningLimiter),
+			Request:   oneOf{RPCRequest{}, []RPCRequest{}},
+			Responses: map[int]any{http.StatusOK: oneOf{RPCResponse{}, []RPCResponse{}}, http.StatusNoContent: nil},
+		},
+		{
+			Method: "POST", Path: "/receive-block", Class: routeGossip, Summary: "Receives block mined by another node",
+			Handler:   handleBlockReceive(logger),
+			Request:   ReceiveBlockData{},
+			Responses: map[int]any{http.StatusOK: "", http.StatusBadRequest: ErrorData{}},
+		},
+		{
+			Method: "POST", Path: "/hello", Class: routeGossip, Summary: "Signs a challenge proving the node address",
+			Handler:   handleHello(logger),
+			Request:   HelloRequestData{},
+			Responses: map[int]any{http.StatusOK: HelloData{}, http.StatusBadRequest: ErrorData{}},
+		},
+		{
+			Method: "POST", Path: "/handshake", Class: routeGossip, Summary: "Exchanges protocol version, chain and capabilities",
+			Handler: handleHandshake(logger),
+			Request: HandshakeData{},
+			Responses: map[int]any{
+				http.StatusOK:              HandshakeData{},
+				http.StatusBadRequest:      ErrorData{},
+				http.StatusForbidden:       ErrorData{},
+				http.StatusConflict:        ErrorData{},
+				http.StatusUpgradeRequired: ErrorData{},
+			},
+		},
+		{
+			Method: "POST", Path: "/gossip", Class: routeGossip, Summary: "Receives gossip message and forwards it",
+			Handler:   handleGossip(logger),
+			Request:   GossipMessage{},
+			Responses: map[int]any{http.StatusOK: GossipResponseData{}, http.StatusBadRequest: ErrorData{}},
+		},
+		{
+			Method: "POST", Path: "/inv", Class: routeGossip, Summary: "Receives inventory of block hashes",
+			Handler:   handleInv(logger),
+			Request:   InventoryData{},
+			Responses: map[int]any{http.StatusOK: InvResponseData{}, http.StatusBadRequest: ErrorData{}},
+		},
+		{
+			Method: "POST", Path: "/getdata", Class: routeGossip, Summary: "Returns blocks with the requested hashes",
+			Handler:   handleGetData(logger),
+			Request:   InventoryData{},
+			Responses: map[int]any{http.StatusOK: GetDataResponseData{}, http.StatusBadRequest: ErrorData{}},
+		},
+		{
+			Method: "POST", Path: "/swim/ping", Class: routeGossip, Summary: "Answers membership probe",
+			Handler:   handleSwimPing(logger),
+			Request:   SwimPingData{},
+			Responses: map[int]any{http.StatusOK: SwimAckData{}, http.StatusBadRequest: ErrorData{}},
+		},
+		{
+			Method: "POST", Path: "/swim/ping-req", Class: routeGossip, Summary: "Probes target on behalf of another node",
+			Handler:   handleSwimPingReq(logger),
+			Request:   SwimPingReqData{},
+			Responses: map[int]any{http.StatusOK: SwimPingReqAckData{}, http.StatusBadRequest: ErrorData{}},
+		},
+		{
+			Method: "GET", Path: "/pex", Class: routeGossip, Summary: "Returns a sample of healthy peers",
+			Handler:   handlePex(logger, envInt("PEX_SAMPLE_SIZE", defaultPexSampleSize)),
+			Responses: map[int]any{http.StatusOK: PexData{}},
+		},
+	}
+
+	// The document describes all routes, including its own
+	for i := range routes {
+		if routes[i].Path == "/openapi.json" {
+			routes[i].Handler = handleOpenAPI(logger, routes)
+		}
+	}
+	return routes
+}
+
+// All public routes of the server, admin routes are served by the admin listener.
+// Each route is rate limited by its class: mining, gossip between nodes or reading.
+// API clients are authenticated and need the scope of the route, routes between nodes are not authenticated.
+// Trace context sent by peers is passed to the handlers in the request context.
+func addRoutes(mux *http.ServeMux, logger *slog.Logger) {
+	miningLimiter := envRateLimiter("RATE_LIMIT_MINING", defaultMiningRate, defaultMiningBurst)
+	classes := map[string]func(http.Handler) http.Handler{
+		routeMining: rateLimit(logger, miningLimiter),
+		routeGossip: rateLimit(logger, envRateLimiter("RATE_LIMIT_GOSSIP", defaultGossipRate, defaultGossipBurst)),
+		routeRead:   rateLimit(logger, envRateLimiter("RATE_LIMIT_READ", defaultReadRate, defaultReadBurst)),
+	}
+
+	for _, route := range apiRoutes(logger, miningLimiter) {
+		pattern := route.Method + " " + route.Path
+		handler := checkIfNodeRecognised(logger)(route.Handler)
+		if route.Class != routeGossip {
+			handler = requireScope(logger, route.Scope)(handler)
+		}
+		mux.Handle(pattern, observeRoute(route)(extractTraceContext(classes[route.Class](handler))))
+	}
 }
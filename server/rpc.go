@@ -0,0 +1,243 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+)
+
+// JSON-RPC 2.0 error codes
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcInternalError  = -32603
+	rpcNotFound       = -32001
+	rpcNotReady       = -32002
+	rpcUnauthorized   = -32003
+	rpcForbidden      = -32004
+	rpcRateLimited    = -32005
+)
+
+// Largest accepted POST /rpc body and batch
+const (
+	maxRPCBodySize  = 1 << 20
+	maxRPCBatchSize = 100
+)
+
+// Defines a JSON-RPC 2.0 request
+type RPCRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+// Defines a JSON-RPC 2.0 response
+type RPCResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  any             `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// Defines a JSON-RPC 2.0 error
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RPCError) Error() string {
+	return e.Message
+}
+
+// Calls a node operation with the request params
+type rpcMethod func(r *http.Request, params json.RawMessage) (any, error)
+
+// Decodes params given either by position or by name into the named fields.
+// Missing params are left at their zero values.
+func decodeRPCParams(params json.RawMessage, names []string, fields ...any) error {
+	if len(params) == 0 || bytes.Equal(params, []byte("null")) {
+		return nil
+	}
+
+	invalid := &RPCError{Code: rpcInvalidParams, Message: "Invalid params"}
+	switch params[0] {
+	case '[':
+		var list []json.RawMessage
+		if err := json.Unmarshal(params, &list); err != nil || len(list) > len(fields) {
+			return invalid
+		}
+		for i, value := range list {
+			if err := json.Unmarshal(value, fields[i]); err != nil {
+				return invalid
+			}
+		}
+	case '{':
+		var named map[string]json.RawMessage
+		if err := json.Unmarshal(params, &named); err != nil {
+			return invalid
+		}
+		for i, name := range names {
+			if value, ok := named[name]; ok {
+				if err := json.Unmarshal(value, fields[i]); err != nil {
+					return invalid
+				}
+			}
+		}
+	default:
+		return invalid
+	}
+	return nil
+}
+
+// Scopes needed by JSON-RPC methods when authentication is enabled, scopeRead if not listed
+var rpcScopes = map[string]string{
+	"data_submit": scopeSubmit,
+}
+
+// Returns JSON-RPC methods backed by the same operations as the REST routes.
+// Submitting data is rate limited with the mining limiter and counted against the quota of the caller.
+func rpcMethods(logger *slog.Logger, mining *RateLimiter) map[string]rpcMethod {
+	return map[string]rpcMethod{
+		"chain_getBlockByHash": func(r *http.Request, params json.RawMessage) (any, error) {
+			var hash string
+			if err := decodeRPCParams(params, []string{"hash"}, &hash); err != nil {
+				return nil, err
+			}
+			return getBlockByHash(hash)
+		},
+		"chain_getBlockByIndex": func(r *http.Request, params json.RawMessage) (any, error) {
+			index := -1
+			if err := decodeRPCParams(params, []string{"index"}, &index); err != nil {
+				return nil, err
+			}
+			return getBlockByIndex(index)
+		},
+		"chain_getTip": func(r *http.Request, params json.RawMessage) (any, error) {
+			return getTip()
+		},
+		"data_submit": func(r *http.Request, params json.RawMessage) (any, error) {
+			var data string
+			if err := decodeRPCParams(params, []string{"data"}, &data); err != nil {
+				return nil, err
+			}
+			if allowed, _ := mining.Allow(rateLimitKey(r)); !allowed {
+				return nil, &RPCError{Code: rpcRateLimited, Message: "Rate limit exceeded"}
+			}
+			if err := takeQuota(r); err != nil {
+				return nil, err
+			}
+			return submitData(r.Context(), logger, data)
+		},
+		"net_peers": func(r *http.Request, params json.RawMessage) (any, error) {
+			return listPeers(), nil
+		},
+		"node_status": func(r *http.Request, params json.RawMessage) (any, error) {
+			return nodeStatus(), nil
+		},
+	}
+}
+
+// Converts error of a node operation to a JSON-RPC error
+func rpcErrorFrom(err error) *RPCError {
+	var rpcErr *RPCError
+	switch {
+	case errors.As(err, &rpcErr):
+		return rpcErr
+	case errors.Is(err, ErrBlockNotFound), errors.Is(err, ErrEmptyChain):
+		return &RPCError{Code: rpcNotFound, Message: err.Error()}
+	case errors.Is(err, ErrNotReady), errors.Is(err, ErrMiningPaused):
+		return &RPCError{Code: rpcNotReady, Message: err.Error()}
+	case errors.Is(err, ErrUnauthenticated):
+		return &RPCError{Code: rpcUnauthorized, Message: err.Error()}
+	case errors.Is(err, ErrForbidden):
+		return &RPCError{Code: rpcForbidden, Message: err.Error()}
+	case errors.Is(err, ErrQuotaExceeded):
+		return &RPCError{Code: rpcRateLimited, Message: err.Error()}
+	default:
+		return &RPCError{Code: rpcInternalError, Message: err.Error()}
+	}
+}
+
+// Calls the method of a single request.
+// Returns false for notifications, which get no response.
+func callRPC(r *http.Request, methods map[string]rpcMethod, raw json.RawMessage) (RPCResponse, bool) {
+	var req RPCRequest
+	if err := json.Unmarshal(raw, &req); err != nil || req.JSONRPC != "2.0" || req.Method == "" {
+		return RPCResponse{JSONRPC: "2.0", Error: &RPCError{Code: rpcInvalidRequest, Message: "Invalid request"}, ID: json.RawMessage("null")}, true
+	}
+
+	resp := RPCResponse{JSONRPC: "2.0", ID: req.ID}
+	method, ok := methods[req.Method]
+	scope, scoped := rpcScopes[req.Method]
+	if !scoped {
+		scope = scopeRead
+	}
+	if !ok {
+		resp.Error = &RPCError{Code: rpcMethodNotFound, Message: "Method not found"}
+	} else if err := authorize(r, scope); err != nil {
+		resp.Error = rpcErrorFrom(err)
+	} else if result, err := method(r, req.Params); err != nil {
+		resp.Error = rpcErrorFrom(err)
+	} else {
+		resp.Result = result
+	}
+
+	if req.ID == nil {
+		return resp, false
+	}
+	return resp, true
+}
+
+// Handles JSON-RPC 2.0 requests, single or batched.
+// Route: POST /rpc
+func handleRPC(logger *slog.Logger, mining *RateLimiter) http.Handler {
+	methods := rpcMethods(logger, mining)
+
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Info("Request", "route", "POST /rpc")
+
+			body, err := io.ReadAll(io.LimitReader(r.Body, maxRPCBodySize))
+			body = bytes.TrimSpace(body)
+			if err != nil || !json.Valid(body) {
+				_ = encode(w, r, http.StatusOK, RPCResponse{JSONRPC: "2.0", Error: &RPCError{Code: rpcParseError, Message: "Parse error"}, ID: json.RawMessage("null")})
+				return
+			}
+
+			if body[0] != '[' {
+				resp, ok := callRPC(r, methods, body)
+				if !ok {
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+				_ = encode(w, r, http.StatusOK, resp)
+				return
+			}
+
+			var batch []json.RawMessage
+			_ = json.Unmarshal(body, &batch)
+			if len(batch) == 0 || len(batch) > maxRPCBatchSize {
+				_ = encode(w, r, http.StatusOK, RPCResponse{JSONRPC: "2.0", Error: &RPCError{Code: rpcInvalidRequest, Message: "Invalid request"}, ID: json.RawMessage("null")})
+				return
+			}
+
+			responses := []RPCResponse{}
+			for _, raw := range batch {
+				if resp, ok := callRPC(r, methods, raw); ok {
+					responses = append(responses, resp)
+				}
+			}
+			if len(responses) == 0 {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			_ = encode(w, r, http.StatusOK, responses)
+		},
+	)
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"GoChain/block"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Creates genesis block if the chain is empty
+func ensureGenesis(t *testing.T) block.Block {
+	if len(block.GetBlockchain()) < 1 {
+		if err := block.CreateGenesisBlock(); err != nil {
+			t.Fatalf("CreateGenesisBlock() returned an error: %v", err)
+		}
+	}
+	return block.GetBlockchain()[0]
+}
+
+// Sends body to POST /rpc, returning the response recorder
+func callTestRPC(mining *RateLimiter, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	handleRPC(slog.New(slog.DiscardHandler), mining).ServeHTTP(rec, httptest.NewRequest("POST", "/rpc", strings.NewReader(body)))
+	return rec
+}
+
+// Calls chain_getBlockByIndex with positional and named params, checking that both return genesis
+func TestRPCGetBlockByIndex(t *testing.T) {
+	genesis := ensureGenesis(t)
+
+	for _, params := range []string{`[0]`, `{"index": 0}`} {
+		rec := callTestRPC(NewRateLimiter(1, 1), `{"jsonrpc": "2.0", "method": "chain_getBlockByIndex", "params": `+params+`, "id": 1}`)
+
+		var resp struct {
+			Result block.Block `json:"result"`
+			ID     int         `json:"id"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || resp.Result.Hash != genesis.Hash || resp.ID != 1 {
+			t.Errorf("chain_getBlockByIndex(%v) = %+v, %v, want genesis with id 1", params, resp, err)
+		}
+	}
+}
+
+// Sends a batch with a notification, an unknown method and an unknown block,
+// checking that only the calls with an id get responses with matching error codes
+func TestRPCBatch(t *testing.T) {
+	ensureGenesis(t)
+	body := `[
+		{"jsonrpc": "2.0", "method": "node_status"},
+		{"jsonrpc": "2.0", "method": "chain_mine", "id": "a"},
+		{"jsonrpc": "2.0", "method": "chain_getBlockByHash", "params": ["unknown"], "id": "b"}
+	]`
+
+	var responses []RPCResponse
+	if err := json.NewDecoder(callTestRPC(NewRateLimiter(1, 1), body).Body).Decode(&responses); err != nil {
+		t.Fatalf("Decoding batch response returned an error: %v", err)
+	}
+	if len(responses) != 2 {
+		t.Fatalf("Batch returned %v responses, want 2", len(responses))
+	}
+	if string(responses[0].ID) != `"a"` || responses[0].Error == nil || responses[0].Error.Code != rpcMethodNotFound {
+		t.Errorf("Unknown method response = %+v, want method not found", responses[0])
+	}
+	if string(responses[1].ID) != `"b"` || responses[1].Error == nil || responses[1].Error.Code != rpcNotFound {
+		t.Errorf("Unknown block response = %+v, want not found", responses[1])
+	}
+}
+
+// Sends malformed requests, checking the returned error codes
+func TestRPCErrors(t *testing.T) {
+	tests := []struct {
+		body string
+		code int
+	}{
+		{`{"jsonrpc": "2.0", "method"`, rpcParseError},
+		{`[]`, rpcInvalidRequest},
+		{`{"method": "chain_getTip", "id": 1}`, rpcInvalidRequest},
+		{`{"jsonrpc": "2.0", "method": "chain_getBlockByIndex", "params": ["zero"], "id": 1}`, rpcInvalidParams},
+		{`{"jsonrpc": "2.0", "method": "data_submit", "params": {"data": "x"}, "id": 1}`, rpcRateLimited},
+	}
+
+	for _, test := range tests {
+		var resp RPCResponse
+		if err := json.NewDecoder(callTestRPC(NewRateLimiter(1, 0), test.body).Body).Decode(&resp); err != nil {
+			t.Errorf("Decoding response to %v returned an error: %v", test.body, err)
+			continue
+		}
+		if resp.Error == nil || resp.Error.Code != test.code {
+			t.Errorf("Response to %v = %+v, want error code %v", test.body, resp.Error, test.code)
+		}
+	}
+}
+
+// Sends a single notification, checking that there is no response body
+func TestRPCNotification(t *testing.T) {
+	rec := callTestRPC(NewRateLimiter(1, 1), `{"jsonrpc": "2.0", "method": "net_peers"}`)
+
+	if rec.Code != http.StatusNoContent || rec.Body.Len() != 0 {
+		t.Errorf("Notification returned %v with %q, want 204 without body", rec.Code, rec.Body.String())
+	}
+}
+
+// Sends GET /blocks/{hash} for known and unknown hashes, checking the block and 404
+func TestHandleGetBlock(t *testing.T) {
+	genesis := ensureGenesis(t)
+	mux := http.NewServeMux()
+	mux.Handle("GET /blocks/{hash}", handleGetBlock(slog.New(slog.DiscardHandler)))
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/blocks/"+genesis.Hash, nil))
+	data, err := decodeResponse[GetBlockData](io.NopCloser(rec.Body))
+	if err != nil || data.Data.Hash != genesis.Hash {
+		t.Errorf("GET /blocks/%v = %+v, %v, want genesis", genesis.Hash, data, err)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/blocks/unknown", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("GET /blocks/unknown returned %v, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"GoChain/block"
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Default seed settings, overridable with SEED_ATTEMPTS, SEED_BACKOFF and SEED_RETRY_INTERVAL
+const (
+	defaultSeedAttempts      = 3
+	defaultSeedBackoff       = time.Second
+	defaultSeedRetryInterval = time.Minute
+)
+
+// Resolves host name to addresses, replaced in tests
+var lookupHost = net.DefaultResolver.LookupHost
+
+// Splits comma separated list of seeds, dropping empty entries
+func parseSeedList(value string) []string {
+	seeds := []string{}
+	for _, seed := range strings.Split(value, ",") {
+		seed = strings.TrimSpace(seed)
+		if seed != "" {
+			seeds = append(seeds, seed)
+		}
+	}
+	return seeds
+}
+
+// Resolves DNS seeds in host:port format to one address per A/AAAA record
+func resolveDNSSeeds(ctx context.Context, logger *slog.Logger, dnsSeeds []string) []string {
+	addresses := []string{}
+	for _, seed := range dnsSeeds {
+		host, port, err := net.SplitHostPort(seed)
+		if err != nil {
+			logger.Warn("DNS seed is not in host:port format", "seed", seed)
+			continue
+		}
+
+		ips, err := lookupHost(ctx, host)
+		if err != nil {
+			logger.Warn("Failed to resolve DNS seed", "seed", host, "err", err)
+			continue
+		}
+		for _, ip := range ips {
+			addresses = append(addresses, net.JoinHostPort(ip, port))
+		}
+	}
+	return addresses
+}
+
+// Bootstrap seeds from BOOTSTRAP and DNS_SEEDS, with previous neighbours from the peer database as fallback
+type Seeds struct {
+	logger   *slog.Logger
+	static   []string
+	dns      []string
+	previous []string
+	attempts int
+	backoff  time.Duration
+}
+
+// Creates seeds from static addresses, DNS seed names and previously known peers
+func NewSeeds(logger *slog.Logger, static []string, dns []string, previous []string, attempts int, backoff time.Duration) *Seeds {
+	return &Seeds{logger: logger, static: static, dns: dns, previous: previous, attempts: attempts, backoff: backoff}
+}
+
+// Checks if there is nobody to sync with
+func (s *Seeds) Empty() bool {
+	return len(s.static) == 0 && len(s.dns) == 0 && len(s.previous) == 0
+}
+
+// Tries seeds in random order, then previous neighbours, until one syncs,
+// retrying the whole list with backoff.
+// Remaining seeds are added to the address book.
+func (s *Seeds) Sync(ctx context.Context) error {
+	backoff := s.backoff
+
+	for attempt := 1; attempt <= s.attempts; attempt++ {
+		seeds := slices.Concat(s.static, resolveDNSSeeds(ctx, s.logger, s.dns))
+		rand.Shuffle(len(seeds), func(i, j int) { seeds[i], seeds[j] = seeds[j], seeds[i] })
+		previous := slices.Clone(s.previous)
+		rand.Shuffle(len(previous), func(i, j int) { previous[i], previous[j] = previous[j], previous[i] })
+		candidates := slices.Concat(seeds, previous)
+
+		for i, seed := range candidates {
+			if seed == localAddress() {
+				continue
+			}
+			if err := syncNode(ctx, seed); err != nil {
+				s.logger.Info("Sync with seed failed", "peer", seed, "err", err)
+				continue
+			}
+
+			s.logger.Info("Synced with seed", "peer", seed, "height", len(block.GetBlockchain()))
+			for _, other := range candidates[i+1:] {
+				addressBook.Add(other, "")
+			}
+			return nil
+		}
+
+		if attempt == s.attempts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+
+	return fmt.Errorf("No seed reachable after %v attempts", s.attempts)
+}
+
+// Retries Sync at the interval until it succeeds or the context is cancelled
+func (s *Seeds) RetryUntilSynced(ctx context.Context, interval time.Duration) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+		err := s.Sync(ctx)
+		if err == nil {
+			return
+		}
+		s.logger.Warn("Seed sync retry failed", "err", err)
+	}
+}
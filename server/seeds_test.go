@@ -0,0 +1,42 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+)
+
+// Calls parseSeedList with spaces and empty entries, checking that only addresses are returned
+func TestParseSeedList(t *testing.T) {
+	seeds := parseSeedList(" node1:8001, ,node2:8002,")
+
+	if !slices.Equal(seeds, []string{"node1:8001", "node2:8002"}) {
+		t.Errorf("parseSeedList() = %v, want [node1:8001 node2:8002]", seeds)
+	}
+}
+
+// Calls resolveDNSSeeds with a seed resolving to several records, checking that each gets the port
+func TestResolveDNSSeeds(t *testing.T) {
+	saved := lookupHost
+	defer func() { lookupHost = saved }()
+	lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		return []string{"10.0.0.1", "fd00::1"}, nil
+	}
+
+	addresses := resolveDNSSeeds(context.Background(), slog.New(slog.DiscardHandler), []string{"seed.example:8001", "no-port"})
+
+	if !slices.Equal(addresses, []string{"10.0.0.1:8001", "[fd00::1]:8001"}) {
+		t.Errorf("resolveDNSSeeds() = %v, want [10.0.0.1:8001 [fd00::1]:8001]", addresses)
+	}
+}
+
+// Calls Seeds.Sync with unreachable seeds, checking that it gives up with an error after retrying
+func TestSeedsSyncUnreachable(t *testing.T) {
+	seeds := NewSeeds(slog.New(slog.DiscardHandler), []string{"127.0.0.1:1", "127.0.0.1:2"}, nil, nil, 2, time.Millisecond)
+
+	if err := seeds.Sync(context.Background()); err == nil {
+		t.Error("Sync() didn't return an error with unreachable seeds")
+	}
+}
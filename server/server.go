@@ -3,31 +3,58 @@ package server
 import (
 	"GoChain/block"
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
-	"maps"
-	"math/rand"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
-	"slices"
-	"strings"
+	"path/filepath"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/joho/godotenv"
 )
 
-// Holds known nodes port
-var nodes = make(map[string]struct{})
+// Holds known peers
+var peers = NewPeerSet()
 
 // NewServer initializes the HTTP multiplexer and attaches all routes.
 // It returns an http.Handler to be passed into the server.
-func NewServer(logger *log.Logger) http.Handler {
+func NewServer(logger *slog.Logger) http.Handler {
+	gossiper = NewGossiper(
+		withComponent(logger, componentGossip),
+		envInt("GOSSIP_FANOUT", defaultGossipFanout),
+		envInt("GOSSIP_TTL", defaultGossipTTL),
+		envDuration("GOSSIP_SEEN_TTL", defaultGossipSeenTTL),
+		outboxConfigFromEnv(),
+	)
+	registerGossipHandlers(withComponent(logger, componentGossip))
+
+	readyMaxLag = envInt("READY_MAX_LAG", defaultReadyMaxLag)
+	dialBackLimiter = envRateLimiter("RATE_LIMIT_DIAL_BACK", defaultDialBackRate, defaultDialBackBurst)
+
+	banPolicy = BanPolicy{
+		Threshold: float64(envInt("BAN_THRESHOLD", defaultBanThreshold)),
+		Duration:  envDuration("BAN_DURATION", defaultBanDuration),
+		HalfLife:  envDuration("SCORE_HALF_LIFE", defaultScoreHalfLife),
+	}
+
+	membership = NewMembership(
+		withComponent(logger, componentPeers),
+		envDuration("SWIM_INTERVAL", defaultSwimInterval),
+		envDuration("SWIM_PROBE_TIMEOUT", defaultSwimProbeTimeout),
+		envDuration("SWIM_SUSPECT_TIMEOUT", defaultSwimSuspectTimeout),
+		envInt("SWIM_INDIRECT_PROBES", defaultSwimIndirectProbes),
+	)
+
 	mux := http.NewServeMux()
-	addRoutes(mux, logger)
+	addRoutes(mux, withComponent(logger, componentHTTP))
 	return mux
 }
 
@@ -50,83 +77,212 @@ func decode[T any](r *http.Request) (T, error) {
 	return v, nil
 }
 
-// Checks if incoming request port is recognised or not
-// If not recognised adds to known nodes
-func checkIfNodeRecognised(logger *log.Logger) func(http.Handler) http.Handler {
+// Checks if incoming request comes from a recognised node.
+// Requests without Node-Addr header are plain API clients and are never added as peers.
+// Unknown nodes are admitted only after their address is verified with a hello exchange.
+// Admitted addresses are never dialed back, whatever Node-ID says, and dial-backs to other addresses
+// are rate limited per address and not repeated while one is in progress,
+// so requests can't make this node flood an address with hello exchanges.
+func checkIfNodeRecognised(logger *slog.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
+			// Clients penalised without a proven identity are banned by IP
+			if banList.IsBanned(remoteIP(r), "") {
+				_ = encode(w, r, http.StatusForbidden, ErrorData{Error: "Client is banned"})
+				return
+			}
+
 			nodeAddr := r.Header.Get("Node-Addr")
 
-			logger.Printf("Request address: %s", nodeAddr)
-			addNode(nodeAddr)
+			if nodeAddr == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if err := validateNodeAddr(nodeAddr); err != nil {
+				logger.Info("Rejected request", "err", err)
+				_ = encode(w, r, http.StatusBadRequest, ErrorData{Error: "Invalid Node-Addr header"})
+				return
+			}
+
+			nodeID := r.Header.Get("Node-ID")
+			logger.Debug("Peer request", "peer", nodeAddr, "route", r.Method+" "+r.URL.Path)
+
+			// With TLS the Node-ID header must match the key of the client certificate
+			if nodeTLS != nil && tlsNodeID(r.TLS) != nodeID {
+				logger.Warn("Rejected request: Node-ID doesn't match client certificate", "peer", nodeAddr)
+				_ = encode(w, r, http.StatusForbidden, ErrorData{Error: "Peer requests require a client certificate bound to Node-ID"})
+				return
+			}
+
+			if banList.IsBanned(nodeAddr, nodeID) {
+				_ = encode(w, r, http.StatusForbidden, ErrorData{Error: "Node is banned"})
+				return
+			}
+
+			knownID, known := peers.NodeID(nodeAddr)
+			switch {
+			case known && knownID == nodeID:
+				peers.Add(nodeAddr, nodeID)
+			case known || admissionPending(nodeAddr):
+			default:
+				if allowed, _ := dialBackLimiter.Allow(nodeAddr); !allowed {
+					logger.Debug("Peer not admitted: too many hello exchanges", "peer", nodeAddr)
+					break
+				}
+				go func() {
+					if err := admitPeer(nodeAddr, nodeID); err != nil {
+						logger.Info("Peer not admitted", "peer", nodeAddr, "err", err)
+					}
+				}()
+			}
 			next.ServeHTTP(w, r)
 		})
 	}
 }
 
-// Defines the JSON body for GET /chain response
+// Returns height of the chain, the index of its tip, -1 while there is no chain
+func chainHeight() int {
+	return len(block.GetBlockchain()) - 1
+}
+
+// Defines the JSON body for GET /ping response.
+// Height is the index of the chain tip, see chainHeight.
 type GetPingData struct {
-	Data string `json:"status"`
+	Data            string `json:"data"`
+	Height          int    `json:"height"`
+	ProtocolVersion int    `json:"protocolVersion"`
 }
 
 // Returns alive message.
 // Route: GET /ping
-func handlePing(logger *log.Logger) http.Handler {
+func handlePing(logger *slog.Logger) http.Handler {
 	return http.HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
-			logger.Println("GET /ping")
-			_ = encode(w, r, http.StatusOK, GetPingData{Data: "alive"})
+			logger.Info("Request", "route", "GET /ping")
+			_ = encode(w, r, http.StatusOK, GetPingData{
+				Data:            "alive",
+				Height:          chainHeight(),
+				ProtocolVersion: protocolVersion,
+			})
 		},
 	)
 }
 
-// If not present, adds new node address to the known nodes
-func addNode(address string) {
-	_, ok := nodes[address]
+// Defines the JSON body for GET /chain response
+type GetChainData struct {
+	Data []block.Block `json:"data"`
+}
 
-	if !ok {
-		nodes[address] = struct{}{}
-	}
+// Returns entire blockchain as a JSON array.
+// Route: GET /chain
+func handleGetChain(logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Info("Request", "route", "GET /chain")
+			_ = encode(w, r, http.StatusOK, GetChainData{Data: block.GetBlockchain()})
+		},
+	)
 }
 
-// If present, removes address from known nodes
-func removeNode(address string) {
-	_, ok := nodes[address]
+// Defines the JSON body for GET /blocks/{hash}, GET /blocks/by-index/{index}, GET /tip and POST /add responses
+type GetBlockData struct {
+	Data block.Block `json:"data"`
+}
 
-	if ok {
-		delete(nodes, address)
+// Returns HTTP status for an error from the node operations
+func serviceErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrBlockNotFound), errors.Is(err, ErrEmptyChain):
+		return http.StatusNotFound
+	case errors.Is(err, ErrNotReady), errors.Is(err, ErrMiningPaused):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
 	}
 }
 
-// Defines the JSON body for GET /chain response
-type GetChainData struct {
-	Data []block.Block `json:"data"`
+// Returns block with the hash.
+// Route: GET /blocks/{hash}
+func handleGetBlock(logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Info("Request", "route", "GET /blocks/{hash}")
+
+			b, err := getBlockByHash(r.PathValue("hash"))
+			if err != nil {
+				_ = encode(w, r, serviceErrorStatus(err), ErrorData{Error: err.Error()})
+				return
+			}
+			_ = encode(w, r, http.StatusOK, GetBlockData{Data: b})
+		},
+	)
 }
 
-// Returns entire blockchain as a JSON array.
-// Route: GET /chain
-func handleGetChain(logger *log.Logger) http.Handler {
+// Returns block at the index.
+// Route: GET /blocks/by-index/{index}
+func handleGetBlockByIndex(logger *slog.Logger) http.Handler {
 	return http.HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
-			logger.Println("GET /chain")
-			_ = encode(w, r, http.StatusOK, GetChainData{Data: block.GetBlockchain()})
+			logger.Info("Request", "route", "GET /blocks/by-index/{index}")
+
+			index, err := strconv.Atoi(r.PathValue("index"))
+			if err != nil {
+				_ = encode(w, r, http.StatusBadRequest, ErrorData{Error: "Invalid block index"})
+				return
+			}
+
+			b, err := getBlockByIndex(index)
+			if err != nil {
+				_ = encode(w, r, serviceErrorStatus(err), ErrorData{Error: err.Error()})
+				return
+			}
+			_ = encode(w, r, http.StatusOK, GetBlockData{Data: b})
+		},
+	)
+}
+
+// Returns the last block of the chain.
+// Route: GET /tip
+func handleGetTip(logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Info("Request", "route", "GET /tip")
+
+			b, err := getTip()
+			if err != nil {
+				_ = encode(w, r, serviceErrorStatus(err), ErrorData{Error: err.Error()})
+				return
+			}
+			_ = encode(w, r, http.StatusOK, GetBlockData{Data: b})
+		},
+	)
+}
+
+// Returns identity, version and chain, sync and mining state of this node.
+// Route: GET /status
+func handleStatus(logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Info("Request", "route", "GET /status")
+			_ = encode(w, r, http.StatusOK, nodeStatus())
 		},
 	)
 }
 
 // Defines the JSON body for GET /nodes response
 type GetNodesData struct {
-	Data []string `json:"data"`
+	Data []Peer `json:"data"`
 }
 
-// Returns all nodes as JSON array.
+// Returns all nodes with their metadata as JSON array.
 // Route: GET /nodes
-func handleGetNodes(logger *log.Logger) http.Handler {
+func handleGetNodes(logger *slog.Logger) http.Handler {
 	return http.HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
-			logger.Println("GET /nodes")
-			_ = encode(w, r, http.StatusOK, GetNodesData{Data: slices.Collect(maps.Keys(nodes))})
+			logger.Info("Request", "route", "GET /nodes")
+			_ = encode(w, r, http.StatusOK, GetNodesData{Data: listPeers()})
 		},
 	)
 }
@@ -136,27 +292,23 @@ type AddBlockData struct {
 	Data string `json:"data"`
 }
 
-// Adds new block with the provided data to the blockchain.
+// Adds new block with the provided data to the blockchain and returns it.
 // Route: POST /add
-func handleAddBlock(logger *log.Logger) http.Handler {
+func handleAddBlock(logger *slog.Logger) http.Handler {
 	return http.HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
-			logger.Println("POST /add")
+			logger.Info("Request", "route", "POST /add")
 
 			data, _ := decode[AddBlockData](r)
 
-			chain := block.GetBlockchain()
-
-			if len(chain) < 1 {
-				block.CreateGenesisBlock()
+			newBlock, err := submitData(r.Context(), logger, data.Data)
+			if err != nil {
+				logger.Error("Failed to add block", "err", err)
+				_ = encode(w, r, serviceErrorStatus(err), ErrorData{Error: err.Error()})
+				return
 			}
-			newBlock := block.GreateBlock(data.Data)
-
-			block.AddBlockToChain(newBlock)
 
-			shareMinedBlock(logger, newBlock)
-
-			_ = encode(w, r, http.StatusOK, "Block added to the chain")
+			_ = encode(w, r, http.StatusOK, GetBlockData{Data: newBlock})
 		},
 	)
 }
@@ -164,26 +316,35 @@ func handleAddBlock(logger *log.Logger) http.Handler {
 // Defines the JSON body for POST /receive-block request
 type ReceiveBlockData struct {
 	Data block.Block `json:"data"`
+	TTL  int         `json:"ttl,omitempty"`
 }
 
-// Adds new block with the provided data to the blockchain.
+// Adds block mined by another node to the blockchain and gossips it further.
 // Route: POST /receive-block
-func handleBlockReceive(logger *log.Logger) http.Handler {
+func handleBlockReceive(logger *slog.Logger) http.Handler {
 	return http.HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
-			logger.Println("POST /receive-block")
+			logger.Info("Request", "route", "POST /receive-block")
 
 			data, err := decode[ReceiveBlockData](r)
 
 			if err != nil {
-				logger.Printf("Failed to decode body: %v", err)
-				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				logger.Info("Failed to decode body", "peer", r.Header.Get("Node-Addr"), "err", err)
+				penalizePeer(logger, requestSender(r), offenceDecodeFailure)
+				_ = encode(w, r, http.StatusBadRequest, ErrorData{Error: "Invalid request body"})
+				return
 			}
 
-			err = block.AddMinedBlock(data.Data)
+			msg, err := newGossipMessage(gossipBlock, data.Data.Hash, announcedTTL(data.TTL), data.Data)
+
+			if err == nil {
+				msg.Origin = ""
+				msg.TraceParent = traceParent(r.Context())
+				_, err = gossiper.ReceiveFrom(msg, requestSender(r), requestPeer(r))
+			}
 
 			if err != nil {
-				_ = encode(w, r, http.StatusBadRequest, err)
+				_ = encode(w, r, http.StatusBadRequest, ErrorData{Error: err.Error()})
 			} else {
 				_ = encode(w, r, http.StatusOK, "Block added to the chain")
 
@@ -199,68 +360,219 @@ func Run(ctx context.Context, w io.Writer, args []string) error {
 	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt)
 	defer cancel()
 
-	// Load environment variables from .env
+	// Load environment variables from .env, if there is one
 	err := godotenv.Load()
-	if err != nil {
-		log.Fatal("Error loading .env file")
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("Error loading .env file: %w", err)
 	}
 
-	// Initialise local address
-	localAddr := strings.Join(strings.Split(os.Getenv("LOCAL_ADDR"), ","), "")
-	if len(localAddr) < 1 || localAddr == "" {
-		localAddr = "0.0.0.0:8001"
-		log.Println("Local address setup from .env failed, using default value")
+	// Load node identity
+	if keyPath := os.Getenv("NODE_KEY"); keyPath != "" {
+		id, err := LoadIdentity(keyPath)
+		if err != nil {
+			return fmt.Errorf("Failed to load node identity: %w", err)
+		}
+		identity = id
+	}
+
+	// Create development CA and node certificate: node certs init [dir]
+	if len(args) > 2 && args[1] == "certs" && args[2] == "init" {
+		dir := "certs"
+		if len(args) > 3 {
+			dir = args[3]
+		}
+		// Without NODE_KEY the certificate is issued for a key saved next to it,
+		// as a certificate for a key that isn't kept would be useless
+		if os.Getenv("NODE_KEY") == "" {
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				return fmt.Errorf("Failed to create %v: %w", dir, err)
+			}
+			keyPath := filepath.Join(dir, nodeKeyFile)
+			id, err := LoadIdentity(keyPath)
+			if err != nil {
+				return fmt.Errorf("Failed to load node identity: %w", err)
+			}
+			identity = id
+			fmt.Fprintf(w, "Node key saved in %v, start the node with NODE_KEY=%v\n", keyPath, keyPath)
+		}
+		if err := InitCerts(dir, identity); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "Node certificate for %v written to %v\n", identity.ID, filepath.Join(dir, nodeCertFile))
+		return nil
 	}
 
 	// Start new logger
-	logger := log.New(w, "", log.LstdFlags)
+	// LOG_LEVEL applies to every component, LOG_LEVELS overrides single ones as "gossip=debug,http=warn"
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(envString("LOG_LEVEL", "info"))); err != nil {
+		return fmt.Errorf("Invalid LOG_LEVEL: %w", err)
+	}
+	logLevels = NewLogLevels(level)
+	if err := logLevels.Parse(os.Getenv("LOG_LEVELS")); err != nil {
+		return fmt.Errorf("Invalid LOG_LEVELS: %w", err)
+	}
+	logger := NewLogger(w, envString("LOG_FORMAT", "text"))
+	slog.SetDefault(logger)
+
+	// Tracing setup
+	// Spans are appended to TRACE_FILE as JSON lines, or as OTLP/JSON with TRACE_FORMAT=otlp
+	if path := os.Getenv("TRACE_FILE"); path != "" {
+		exporter, err := NewFileExporter(path, envString("TRACE_FORMAT", traceFormatJSON))
+		if err != nil {
+			return fmt.Errorf("Failed to set up tracing: %w", err)
+		}
+		defer exporter.Close()
+		tracer = NewTracer(logger, exporter, localAddress(), identity.ID)
+	}
+
+	// TLS setup
+	// Node certificate is read from TLS_CERT or self-signed with the identity key,
+	// peers are trusted by TLS_CA or by node IDs in TLS_PINNED_KEYS
+	if envBool("TLS", false) {
+		config, err := LoadTLSConfig(identity, os.Getenv("TLS_CERT"), os.Getenv("TLS_CA"), parseSeedList(os.Getenv("TLS_PINNED_KEYS")))
+		if err != nil {
+			return fmt.Errorf("Failed to set up TLS: %w", err)
+		}
+		if !config.HasTrustAnchors() {
+			return errors.New("Failed to set up TLS: set TLS_CA or TLS_PINNED_KEYS to trust peers")
+		}
+		nodeTLS = config
+	}
+
+	// Client authentication setup
+	// API keys and HMAC keys are read from AUTH_KEYS_FILE, JWTs are verified with keys in AUTH_JWKS_FILE.
+	// Clients without credentials get AUTH_ANONYMOUS_SCOPES, reading by default.
+	auth, err = authFromEnv()
+	if err != nil {
+		return fmt.Errorf("Failed to set up client authentication: %w", err)
+	}
+	if auth != nil {
+		logger.Info("Client authentication enabled", "anonymousScopes", auth.anonymous)
+	} else {
+		logger.Info("Client authentication disabled, set AUTH_KEYS_FILE or AUTH_JWKS_FILE to enable it")
+	}
+
+	// Shared client for requests to peers
+	peerClient = NewPeerClient(peerClientConfigFromEnv(), nodeTLS)
+
+	// Binary protocol listener, peers learn its address from the handshake
+	var wireListener net.Listener
+	if wireAddr := os.Getenv("WIRE_ADDR"); wireAddr != "" {
+		wireListener, err = net.Listen("tcp", wireAddr)
+		if err != nil {
+			return fmt.Errorf("Failed to listen on WIRE_ADDR: %w", err)
+		}
+		if nodeTLS != nil {
+			wireListener = tls.NewListener(wireListener, nodeTLS.ServerConfig())
+		}
+		wireTransport = NewWireTransport(
+			withComponent(logger, componentGossip),
+			wireAddr,
+			envDuration("WIRE_PING_INTERVAL", defaultWirePingInterval),
+			envDuration("WIRE_DIAL_TIMEOUT", defaultWireDialTimeout),
+		)
+		go wireTransport.Run(ctx, wireListener)
+	}
 
 	// HTTP server setup
 	srv := NewServer(logger)
 	httpServer := &http.Server{
-		Addr:    localAddr,
+		Addr:    localAddress(),
 		Handler: srv,
 	}
+	if nodeTLS != nil {
+		httpServer.TLSConfig = nodeTLS.ServerConfig()
+	}
 
 	// Server start in goroutine
 	go func() {
-		logger.Printf("Listening on %s", httpServer.Addr)
-		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			fmt.Fprintf(os.Stderr, "error listening and serving: %s\n", err)
+		logger.Info("Listening", "address", httpServer.Addr)
+		var err error
+		if nodeTLS != nil {
+			err = httpServer.ListenAndServeTLS("", "")
+		} else {
+			err = httpServer.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			logger.Error("Failed to listen and serve", "err", err)
 		}
 	}()
 
+	// Admin listener setup
+	// Admin routes are only served on a loopback address and need ADMIN_TOKEN as bearer token
+	var adminServer *http.Server
+	if token := os.Getenv("ADMIN_TOKEN"); token != "" {
+		adminAddr := envString("ADMIN_ADDR", defaultAdminAddr)
+		if err := checkAdminAddr(adminAddr); err != nil {
+			return err
+		}
+		adminServer = &http.Server{
+			Addr:    adminAddr,
+			Handler: NewAdminServer(withComponent(logger, componentHTTP), token),
+		}
+		go func() {
+			logger.Info("Admin API listening", "address", adminServer.Addr)
+			if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Error("Failed to listen and serve admin API", "err", err)
+			}
+		}()
+	} else {
+		logger.Info("Admin API disabled, set ADMIN_TOKEN to enable it")
+	}
+
+	// Load peers known before restart
+	peerDB = NewPeerDB(envString("PEER_DB", defaultPeerDBPath), envDuration("PEER_DB_MAX_AGE", defaultPeerDBMaxAge))
+	previousPeers, bans, err := peerDB.Load()
+	if err != nil {
+		withComponent(logger, componentSync).Warn("Starting without saved peers", "err", err)
+	}
+	for _, ban := range bans {
+		banList.Ban(ban)
+	}
+	peers.Restore(previousPeers)
+	previousAddrs := []string{}
+	for _, peer := range previousPeers {
+		addressBook.Add(peer.Address, peer.NodeID)
+		previousAddrs = append(previousAddrs, peer.Address)
+	}
+	go peerDB.Run(ctx, withComponent(logger, componentSync), envDuration("PEER_DB_SAVE_INTERVAL", defaultPeerDBSaveInterval))
+
 	// Chain initialisation
-	// If bootstrap node is not specified, creates a new chain
-	// If bootstrap node exists, syncs
-	bootstrapNode := strings.Join(strings.Split(os.Getenv("BOOTSTRAP"), ","), "")
-	if len(bootstrapNode) < 1 || bootstrapNode == "" {
-		log.Println("Bootstrap setup from .env failed, creating a new network.")
+	// If no seeds or saved peers are specified, creates a new chain
+	// Otherwise syncs with the first reachable one and keeps retrying in background if none is
+	seeds := NewSeeds(
+		withComponent(logger, componentSync),
+		parseSeedList(os.Getenv("BOOTSTRAP")),
+		parseSeedList(os.Getenv("DNS_SEEDS")),
+		previousAddrs,
+		envInt("SEED_ATTEMPTS", defaultSeedAttempts),
+		envDuration("SEED_BACKOFF", defaultSeedBackoff),
+	)
+	if seeds.Empty() {
+		logger.Info("No BOOTSTRAP, DNS_SEEDS or saved peers, creating a new network")
 
 		if err := block.CreateGenesisBlock(); err != nil {
 			return fmt.Errorf("Failed to generate genesis block: %w", err)
 		}
-	} else {
-		if err := syncNode(bootstrapNode); err != nil {
-			return fmt.Errorf("Failed to sync with %v, %w", bootstrapNode, err)
-
-		}
+	} else if err := seeds.Sync(ctx); err != nil {
+		withComponent(logger, componentSync).Warn("Starting without sync", "err", err)
+		go seeds.RetryUntilSynced(ctx, envDuration("SEED_RETRY_INTERVAL", defaultSeedRetryInterval))
 	}
 
-	// Check in random intervals if nodes are alive
-	go func() {
-		for {
-			select {
-			case <-ctx.Done():
-				logger.Printf("Checking nodes stopped")
+	// Detect failed nodes and disseminate membership changes
+	go membership.Run(ctx)
 
-			default:
-				checkNodes(logger)
-				sleepDuration := time.Duration(20+rand.Intn(20)) * time.Second
-				time.Sleep(sleepDuration)
-			}
-		}
-	}()
+	// Sync again whenever the chain falls behind the best peer
+	go catchUp(ctx, withComponent(logger, componentSync), envDuration("CATCH_UP_INTERVAL", defaultCatchUpInterval))
+
+	// Keep discovering peers and dial them while below the outbound target
+	pex := NewPeerExchange(
+		withComponent(logger, componentSync),
+		envDuration("PEX_INTERVAL", defaultPexInterval),
+		envInt("PEX_TARGET_OUTBOUND", defaultPexTargetOutbound),
+	)
+	go pex.Run(ctx)
 
 	// Graceful shutdown
 	var wg sync.WaitGroup
@@ -270,13 +582,22 @@ func Run(ctx context.Context, w io.Writer, args []string) error {
 
 		// Block until termination signal
 		<-ctx.Done()
-		logger.Println("Shutting down HTTP server...")
+		logger.Info("Shutting down HTTP server")
 
 		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
 		if err := httpServer.Shutdown(shutdownCtx); err != nil {
-			fmt.Fprintf(os.Stderr, "error shutting down HTTP server: %s\n", err)
+			logger.Error("Failed to shut down HTTP server", "err", err)
+		}
+		if adminServer != nil {
+			if err := adminServer.Shutdown(shutdownCtx); err != nil {
+				logger.Error("Failed to shut down admin API", "err", err)
+			}
+		}
+
+		if err := peerDB.Save(peers.List(), banList.List()); err != nil {
+			logger.Error("Failed to save peers", "err", err)
 		}
 	}()
 
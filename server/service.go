@@ -0,0 +1,118 @@
+package server
+
+import (
+	"GoChain/block"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Node operations shared by the REST routes and the JSON-RPC methods,
+// so both APIs return the same data and errors.
+
+// Returned when the requested block doesn't exist
+var ErrBlockNotFound = errors.New("Block not found")
+
+// Returned when the chain has no blocks yet
+var ErrEmptyChain = errors.New("Chain is empty")
+
+// Defines the JSON body for GET /status response
+type NodeStatusData struct {
+	NodeID          string     `json:"nodeId"`
+	Address         string     `json:"address"`
+	Version         string     `json:"version"`
+	UptimeSeconds   int64      `json:"uptimeSeconds"`
+	ChainID         string     `json:"chainId"`
+	Height          int        `json:"height"`
+	Tip             string     `json:"tip"`
+	Sync            SyncStatus `json:"sync"`
+	Peers           int        `json:"peers"`
+	Mining          string     `json:"mining"`
+	ProtocolVersion int        `json:"protocolVersion"`
+	Capabilities    []string   `json:"capabilities"`
+}
+
+// Returns block with the hash
+func getBlockByHash(hash string) (block.Block, error) {
+	b, ok := block.GetBlockByHash(hash)
+	if !ok {
+		return block.Block{}, fmt.Errorf("%w: %v", ErrBlockNotFound, hash)
+	}
+	return b, nil
+}
+
+// Returns block at the index
+func getBlockByIndex(index int) (block.Block, error) {
+	chain := block.GetBlockchain()
+	if index < 0 || index >= len(chain) {
+		return block.Block{}, fmt.Errorf("%w: index %v", ErrBlockNotFound, index)
+	}
+	return chain[index], nil
+}
+
+// Returns the last block of the chain
+func getTip() (block.Block, error) {
+	chain := block.GetBlockchain()
+	if len(chain) == 0 {
+		return block.Block{}, ErrEmptyChain
+	}
+	return chain[len(chain)-1], nil
+}
+
+// Mines block with the data, adds it to the chain and queues it for broadcast.
+// Mining starts a new trace, or continues the one of a traced request.
+// Returns ErrNotReady while no chain is loaded and ErrMiningPaused while mining is paused.
+func submitData(ctx context.Context, logger *slog.Logger, data string) (block.Block, error) {
+	logger = withComponent(logger, componentMining)
+	if err := checkChainLoaded(); err != nil {
+		return block.Block{}, err
+	}
+	if miningPaused.Load() {
+		return block.Block{}, ErrMiningPaused
+	}
+	events.Publish(Event{Type: eventMempoolEntry, Height: len(block.GetBlockchain()), Data: MempoolEntryData{Data: data}})
+
+	ctx, span := tracer.Start(ctx, spanMine, spanInternal, "height", len(block.GetBlockchain()))
+	start := time.Now()
+	miningJobs.Add(1)
+	newBlock := block.GreateBlock(data)
+	miningJobs.Add(-1)
+	metrics.observeMined(newBlock, time.Since(start))
+	span.SetAttributes("block_hash", newBlock.Hash)
+	span.End()
+	logger.Info("Block mined", "block_hash", newBlock.Hash, "height", newBlock.Index, "duration", time.Since(start))
+
+	block.AddBlockToChain(newBlock)
+	publishNewTip(newBlock)
+
+	shareMinedBlock(ctx, logger, newBlock)
+	return newBlock, nil
+}
+
+// Returns known peers with their metadata
+func listPeers() []Peer {
+	return peers.List()
+}
+
+// Returns identity, version and chain, sync and mining state of this node
+func nodeStatus() NodeStatusData {
+	status := NodeStatusData{
+		NodeID:          identity.ID,
+		Address:         localAddress(),
+		Version:         nodeVersion,
+		UptimeSeconds:   int64(time.Since(startTime).Seconds()),
+		ChainID:         chainID(),
+		Height:          chainHeight(),
+		Sync:            syncStatus(),
+		Peers:           peers.Len(),
+		Mining:          miningState(),
+		ProtocolVersion: protocolVersion,
+		Capabilities:    localCapabilities,
+	}
+	if tip, err := getTip(); err == nil {
+		status.Tip = tip.Hash
+	}
+	return status
+}
@@ -0,0 +1,342 @@
+package server
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// Validity of generated certificates
+const (
+	nodeCertValidity = 365 * 24 * time.Hour
+	caCertValidity   = 10 * 365 * 24 * time.Hour
+)
+
+// File names written by the certs init command
+const (
+	caCertFile   = "ca.pem"
+	caKeyFile    = "ca-key.pem"
+	nodeCertFile = "node.pem"
+	nodeKeyFile  = "node.key"
+)
+
+// TLS settings of the node.
+// The node certificate key is always the node identity key, so the certificate is bound to the node ID.
+// Peers are accepted if their node ID is pinned or their certificate is issued by the CA,
+// without pins and CA no peer is trusted.
+type TLSConfig struct {
+	certificate tls.Certificate
+	ca          *x509.CertPool
+	pinned      []string
+}
+
+// TLS settings used by the node, nil if TLS is disabled
+var nodeTLS *TLSConfig
+
+// Loads TLS settings for the identity.
+// Certificate is read from certPath, or self-signed if certPath is empty.
+func LoadTLSConfig(id *Identity, certPath string, caPath string, pinned []string) (*TLSConfig, error) {
+	config := &TLSConfig{pinned: pinned}
+
+	if certPath != "" {
+		certificate, err := loadNodeCertificate(id, certPath)
+		if err != nil {
+			return nil, err
+		}
+		config.certificate = certificate
+	} else {
+		der, err := createCertificate(id.ID, id.PublicKey, nil, id.privateKey, false)
+		if err != nil {
+			return nil, err
+		}
+		config.certificate = tls.Certificate{Certificate: [][]byte{der}, PrivateKey: id.privateKey}
+	}
+
+	if caPath != "" {
+		content, err := os.ReadFile(caPath)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read TLS CA: %w", err)
+		}
+		config.ca = x509.NewCertPool()
+		if !config.ca.AppendCertsFromPEM(content) {
+			return nil, fmt.Errorf("No certificates found in TLS CA %v", caPath)
+		}
+	}
+	return config, nil
+}
+
+// Reads PEM certificate chain and checks that it is issued for the identity key
+func loadNodeCertificate(id *Identity, path string) (tls.Certificate, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("Failed to read TLS certificate: %w", err)
+	}
+
+	certificate := tls.Certificate{PrivateKey: id.privateKey}
+	for {
+		var p *pem.Block
+		p, content = pem.Decode(content)
+		if p == nil {
+			break
+		}
+		if p.Type == "CERTIFICATE" {
+			certificate.Certificate = append(certificate.Certificate, p.Bytes)
+		}
+	}
+	if len(certificate.Certificate) == 0 {
+		return tls.Certificate{}, fmt.Errorf("No certificates found in %v", path)
+	}
+
+	leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("Failed to parse TLS certificate: %w", err)
+	}
+	if key, ok := leaf.PublicKey.(ed25519.PublicKey); !ok || !key.Equal(id.PublicKey) {
+		return tls.Certificate{}, fmt.Errorf("TLS certificate %v is not issued for node %v", path, id.ID)
+	}
+	certificate.Leaf = leaf
+	return certificate, nil
+}
+
+// Creates DER certificate for the public key, signed by parent or self-signed if parent is nil
+func createCertificate(name string, publicKey ed25519.PublicKey, parent *x509.Certificate, signer ed25519.PrivateKey, isCA bool) ([]byte, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to generate certificate serial: %w", err)
+	}
+
+	validity := nodeCertValidity
+	if isCA {
+		validity = caCertValidity
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(validity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+	}
+	if isCA {
+		template.IsCA = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+		template.ExtKeyUsage = nil
+	}
+	if parent == nil {
+		parent = template
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, publicKey, signer)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create certificate: %w", err)
+	}
+	return der, nil
+}
+
+// Returns node ID bound to the certificate
+func certificateNodeID(cert *x509.Certificate) (string, error) {
+	key, ok := cert.PublicKey.(ed25519.PublicKey)
+	if !ok {
+		return "", errors.New("Certificate key is not an ed25519 node key")
+	}
+	return nodeIDFromKey(key), nil
+}
+
+// Returns node ID of the peer certificate in the TLS connection, empty if there is none
+func tlsNodeID(state *tls.ConnectionState) string {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return ""
+	}
+	id, err := certificateNodeID(state.PeerCertificates[0])
+	if err != nil {
+		return ""
+	}
+	return id
+}
+
+// Checks that the peer certificate carries a node key trusted by pin or CA.
+// Connections without certificate are left for the handlers to decide.
+func (c *TLSConfig) verifyPeerCertificate(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	if len(rawCerts) == 0 {
+		return nil
+	}
+
+	certs := make([]*x509.Certificate, 0, len(rawCerts))
+	for _, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return fmt.Errorf("Failed to parse peer certificate: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+
+	id, err := certificateNodeID(certs[0])
+	if err != nil {
+		return err
+	}
+	if slices.Contains(c.pinned, id) {
+		return nil
+	}
+	if c.ca != nil {
+		intermediates := x509.NewCertPool()
+		for _, cert := range certs[1:] {
+			intermediates.AddCert(cert)
+		}
+		_, err := certs[0].Verify(x509.VerifyOptions{
+			Roots:         c.ca,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		})
+		if err != nil {
+			return fmt.Errorf("Peer certificate of node %v is not trusted: %w", id, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("Node %v is not pinned", id)
+}
+
+// Reports whether peers can be trusted at all, by pinned node IDs or by a CA
+func (c *TLSConfig) HasTrustAnchors() bool {
+	return c.ca != nil || len(c.pinned) > 0
+}
+
+// Returns TLS config for the listener, requesting client certificates from peers
+func (c *TLSConfig) ServerConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:            tls.VersionTLS13,
+		Certificates:          []tls.Certificate{c.certificate},
+		ClientAuth:            tls.RequestClientCert,
+		VerifyPeerCertificate: c.verifyPeerCertificate,
+	}
+}
+
+// Returns TLS config for a connection to the peer with the node ID.
+// Host names are not checked since peers are identified by node ID, not by address,
+// instead the certificate must be trusted and bound to nodeID.
+// Empty nodeID accepts any trusted node, for addresses whose node isn't known yet.
+func (c *TLSConfig) ClientConfig(nodeID string) *tls.Config {
+	return &tls.Config{
+		MinVersion:            tls.VersionTLS13,
+		Certificates:          []tls.Certificate{c.certificate},
+		InsecureSkipVerify:    true,
+		VerifyPeerCertificate: c.verifyPeerCertificate,
+		VerifyConnection: func(state tls.ConnectionState) error {
+			if len(state.PeerCertificates) == 0 {
+				return errors.New("Peer sent no certificate")
+			}
+			if id := tlsNodeID(&state); nodeID != "" && id != nodeID {
+				return fmt.Errorf("Peer certificate is bound to node %v, expected %v", id, nodeID)
+			}
+			return nil
+		},
+	}
+}
+
+// Returns node ID expected at the address, known from peers or the address book
+func expectedNodeID(address string) string {
+	if nodeID, ok := peers.NodeID(address); ok {
+		return nodeID
+	}
+	return addressBook.NodeID(address)
+}
+
+// Returns node ID of an admitted peer proven by its TLS certificate
+func tlsPeerID(r *http.Request) (string, bool) {
+	return tlsNodeID(r.TLS), isProvenMember(r.Header.Get("Node-Addr"), r.TLS)
+}
+
+// Returns URL of the path on the peer, using https if TLS is enabled
+func peerURL(address string, path string) string {
+	if nodeTLS != nil {
+		return "https://" + address + path
+	}
+	return "http://" + address + path
+}
+
+// Creates development CA in dir if missing and issues certificate for the identity signed by it
+func InitCerts(dir string, id *Identity) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("Failed to create %v: %w", dir, err)
+	}
+
+	ca, caKey, err := loadOrCreateCA(dir)
+	if err != nil {
+		return err
+	}
+
+	der, err := createCertificate(id.ID, id.PublicKey, ca, caKey, false)
+	if err != nil {
+		return err
+	}
+	content := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	content = append(content, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})...)
+	if err := os.WriteFile(filepath.Join(dir, nodeCertFile), content, 0o644); err != nil {
+		return fmt.Errorf("Failed to save node certificate: %w", err)
+	}
+	return nil
+}
+
+// Reads CA certificate and key from dir, creating them if they don't exist
+func loadOrCreateCA(dir string) (*x509.Certificate, ed25519.PrivateKey, error) {
+	certPath := filepath.Join(dir, caCertFile)
+	keyPath := filepath.Join(dir, caKeyFile)
+
+	certContent, certErr := os.ReadFile(certPath)
+	keyContent, keyErr := os.ReadFile(keyPath)
+	if errors.Is(certErr, os.ErrNotExist) && errors.Is(keyErr, os.ErrNotExist) {
+		publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to generate CA key: %w", err)
+		}
+		der, err := createCertificate("GoChain development CA", publicKey, nil, privateKey, true)
+		if err != nil {
+			return nil, nil, err
+		}
+		keyDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to encode CA key: %w", err)
+		}
+		if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+			return nil, nil, fmt.Errorf("Failed to save CA key: %w", err)
+		}
+		if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644); err != nil {
+			return nil, nil, fmt.Errorf("Failed to save CA certificate: %w", err)
+		}
+		ca, err := x509.ParseCertificate(der)
+		return ca, privateKey, err
+	}
+	if certErr != nil || keyErr != nil {
+		return nil, nil, fmt.Errorf("Failed to read CA from %v: %v", dir, errors.Join(certErr, keyErr))
+	}
+
+	certBlock, _ := pem.Decode(certContent)
+	keyBlock, _ := pem.Decode(keyContent)
+	if certBlock == nil || keyBlock == nil {
+		return nil, nil, fmt.Errorf("CA in %v is not PEM encoded", dir)
+	}
+	ca, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to parse CA certificate: %w", err)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to parse CA key: %w", err)
+	}
+	caKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, nil, fmt.Errorf("CA key in %v is not an ed25519 key", dir)
+	}
+	return ca, caKey, nil
+}
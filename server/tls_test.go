@@ -0,0 +1,159 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+// Creates TLS config with a self-signed certificate, checking that it is bound to the node ID
+func TestLoadTLSConfigSelfSigned(t *testing.T) {
+	id := mustGenerateIdentity()
+
+	config, err := LoadTLSConfig(id, "", "", nil)
+	if err != nil {
+		t.Fatalf("LoadTLSConfig() returned an error: %v", err)
+	}
+
+	cert, err := x509.ParseCertificate(config.certificate.Certificate[0])
+	if err != nil {
+		t.Fatalf("ParseCertificate() returned an error: %v", err)
+	}
+	state := &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	if got := tlsNodeID(state); got != id.ID {
+		t.Errorf("tlsNodeID() = %v, want %v", got, id.ID)
+	}
+}
+
+// Calls verifyPeerCertificate with pinned node IDs, checking that only pinned nodes are accepted
+func TestVerifyPeerCertificatePinned(t *testing.T) {
+	pinned, other := mustGenerateIdentity(), mustGenerateIdentity()
+	pinnedConfig, _ := LoadTLSConfig(pinned, "", "", nil)
+	otherConfig, _ := LoadTLSConfig(other, "", "", nil)
+
+	config, _ := LoadTLSConfig(mustGenerateIdentity(), "", "", []string{pinned.ID})
+
+	if err := config.verifyPeerCertificate(pinnedConfig.certificate.Certificate, nil); err != nil {
+		t.Errorf("verifyPeerCertificate() rejected pinned node: %v", err)
+	}
+	if err := config.verifyPeerCertificate(otherConfig.certificate.Certificate, nil); err == nil {
+		t.Errorf("verifyPeerCertificate() accepted node that is not pinned")
+	}
+}
+
+// Issues certificates with InitCerts, checking that CA-issued certificates are trusted and self-signed are not
+func TestVerifyPeerCertificateCA(t *testing.T) {
+	dir := t.TempDir()
+	id := mustGenerateIdentity()
+	if err := InitCerts(dir, id); err != nil {
+		t.Fatalf("InitCerts() returned an error: %v", err)
+	}
+
+	issued, err := LoadTLSConfig(id, filepath.Join(dir, nodeCertFile), filepath.Join(dir, caCertFile), nil)
+	if err != nil {
+		t.Fatalf("LoadTLSConfig() returned an error: %v", err)
+	}
+	selfSigned, _ := LoadTLSConfig(mustGenerateIdentity(), "", "", nil)
+
+	if err := issued.verifyPeerCertificate(issued.certificate.Certificate, nil); err != nil {
+		t.Errorf("verifyPeerCertificate() rejected CA-issued certificate: %v", err)
+	}
+	if err := issued.verifyPeerCertificate(selfSigned.certificate.Certificate, nil); err == nil {
+		t.Errorf("verifyPeerCertificate() accepted self-signed certificate")
+	}
+}
+
+// Loads certificate issued for another identity, checking that it is rejected
+func TestLoadTLSConfigWrongIdentity(t *testing.T) {
+	dir := t.TempDir()
+	if err := InitCerts(dir, mustGenerateIdentity()); err != nil {
+		t.Fatalf("InitCerts() returned an error: %v", err)
+	}
+
+	if _, err := LoadTLSConfig(mustGenerateIdentity(), filepath.Join(dir, nodeCertFile), "", nil); err == nil {
+		t.Errorf("LoadTLSConfig() accepted certificate of another node")
+	}
+}
+
+// Sends request over mutual TLS, checking that both sides see each other's node ID
+func TestMutualTLS(t *testing.T) {
+	serverID, clientID := mustGenerateIdentity(), mustGenerateIdentity()
+	serverConfig, _ := LoadTLSConfig(serverID, "", "", []string{clientID.ID})
+	clientConfig, _ := LoadTLSConfig(clientID, "", "", []string{serverID.ID})
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, tlsNodeID(r.TLS))
+	}))
+	srv.TLS = serverConfig.ServerConfig()
+	srv.StartTLS()
+	defer srv.Close()
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig.ClientConfig(serverID.ID)}}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Get() returned an error: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if string(body) != clientID.ID || tlsNodeID(resp.TLS) != serverID.ID {
+		t.Errorf("Node IDs = %v, %v, want %v, %v", string(body), tlsNodeID(resp.TLS), clientID.ID, serverID.ID)
+	}
+}
+
+// Connects to a trusted node expecting another node ID, checking that the connection is refused
+func TestClientConfigWrongNode(t *testing.T) {
+	serverID, clientID := mustGenerateIdentity(), mustGenerateIdentity()
+	serverConfig, _ := LoadTLSConfig(serverID, "", "", []string{clientID.ID})
+	clientConfig, _ := LoadTLSConfig(clientID, "", "", []string{serverID.ID})
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = serverConfig.ServerConfig()
+	srv.StartTLS()
+	defer srv.Close()
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig.ClientConfig(mustGenerateIdentity().ID)}}
+	if resp, err := client.Get(srv.URL); err == nil {
+		resp.Body.Close()
+		t.Error("Get() accepted a certificate of another node")
+	}
+}
+
+// Calls verifyPeerCertificate without pins and CA, checking that no node is trusted
+func TestVerifyPeerCertificateNoTrustAnchors(t *testing.T) {
+	config, _ := LoadTLSConfig(mustGenerateIdentity(), "", "", nil)
+	peer, _ := LoadTLSConfig(mustGenerateIdentity(), "", "", nil)
+
+	if config.HasTrustAnchors() {
+		t.Error("HasTrustAnchors() = true without pins and CA")
+	}
+	if err := config.verifyPeerCertificate(peer.certificate.Certificate, nil); err == nil {
+		t.Error("verifyPeerCertificate() accepted a node without pins and CA")
+	}
+}
+
+// Runs certs init without NODE_KEY and without .env, checking that the node key is saved
+// next to the certificate and the certificate is issued for it
+func TestRunCertsInitSavesKey(t *testing.T) {
+	t.Setenv("NODE_KEY", "")
+	previous := identity
+	t.Cleanup(func() { identity = previous })
+	dir := t.TempDir()
+
+	if err := Run(context.Background(), io.Discard, []string{"node", "certs", "init", dir}); err != nil {
+		t.Fatalf("Run() returned an error: %v", err)
+	}
+
+	id, err := LoadIdentity(filepath.Join(dir, nodeKeyFile))
+	if err != nil {
+		t.Fatalf("LoadIdentity() returned an error: %v", err)
+	}
+	if _, err := LoadTLSConfig(id, filepath.Join(dir, nodeCertFile), "", nil); err != nil {
+		t.Errorf("LoadTLSConfig() with the saved key returned an error: %v", err)
+	}
+}
@@ -0,0 +1,487 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"math"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Formats of the span file
+const (
+	// One span per line in the SpanData layout
+	traceFormatJSON = "json"
+	// One OTLP/JSON export request per line, as written by the OpenTelemetry file exporter
+	traceFormatOTLP = "otlp"
+)
+
+// Kinds of spans, numbered as in OTLP
+const (
+	spanInternal = 1
+	spanServer   = 2
+	spanClient   = 3
+	spanProducer = 4
+	spanConsumer = 5
+)
+
+var spanKindNames = map[int]string{
+	spanInternal: "internal",
+	spanServer:   "server",
+	spanClient:   "client",
+	spanProducer: "producer",
+	spanConsumer: "consumer",
+}
+
+// Names of the spans recorded by the node
+const (
+	spanMine      = "mine"
+	spanValidate  = "validate"
+	spanBroadcast = "broadcast"
+	spanSync      = "sync"
+)
+
+// Header carrying the trace context of peer requests
+const traceParentHeader = "traceparent"
+
+// Trace context of a span, shared with peers in the W3C traceparent format
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+}
+
+// Reports whether trace and span IDs are set
+func (c SpanContext) IsValid() bool {
+	return c.TraceID != [16]byte{} && c.SpanID != [8]byte{}
+}
+
+// Returns the context as traceparent header value
+func (c SpanContext) TraceParent() string {
+	flags := 0
+	if c.Sampled {
+		flags = 1
+	}
+	return fmt.Sprintf("00-%x-%x-%02x", c.TraceID, c.SpanID, flags)
+}
+
+// Parses traceparent header value.
+// Versions other than 00 are read by their 00 fields, as the W3C spec requires.
+func parseTraceParent(value string) (SpanContext, error) {
+	invalid := fmt.Errorf("Invalid traceparent %q", value)
+	if len(value) < 55 || (len(value) > 55 && value[55] != '-') || value[2] != '-' || value[35] != '-' || value[52] != '-' {
+		return SpanContext{}, invalid
+	}
+
+	version, err := hex.DecodeString(value[:2])
+	if err != nil || version[0] == 0xff || (version[0] == 0 && len(value) != 55) {
+		return SpanContext{}, invalid
+	}
+
+	var c SpanContext
+	flags := make([]byte, 1)
+	if _, err := hex.Decode(c.TraceID[:], []byte(value[3:35])); err != nil {
+		return SpanContext{}, invalid
+	}
+	if _, err := hex.Decode(c.SpanID[:], []byte(value[36:52])); err != nil {
+		return SpanContext{}, invalid
+	}
+	if _, err := hex.Decode(flags, []byte(value[53:55])); err != nil {
+		return SpanContext{}, invalid
+	}
+	// IDs are lowercase hex only
+	if fmt.Sprintf("%x", c.TraceID) != value[3:35] || fmt.Sprintf("%x", c.SpanID) != value[36:52] || !c.IsValid() {
+		return SpanContext{}, invalid
+	}
+	c.Sampled = flags[0]&1 == 1
+	return c, nil
+}
+
+type spanContextKey struct{}
+
+// Returns the span context carried by ctx
+func spanContextFrom(ctx context.Context) (SpanContext, bool) {
+	c, ok := ctx.Value(spanContextKey{}).(SpanContext)
+	return c, ok
+}
+
+// Returns ctx carrying the span context
+func contextWithSpanContext(ctx context.Context, c SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, c)
+}
+
+// Returns ctx carrying the trace context of the traceparent value.
+// Invalid or empty values leave ctx unchanged.
+func contextWithTraceParent(ctx context.Context, value string) context.Context {
+	c, err := parseTraceParent(value)
+	if err != nil {
+		return ctx
+	}
+	return contextWithSpanContext(ctx, c)
+}
+
+// Returns traceparent value of the span carried by ctx, empty if there is none
+func traceParent(ctx context.Context) string {
+	if c, ok := spanContextFrom(ctx); ok {
+		return c.TraceParent()
+	}
+	return ""
+}
+
+// Defines a finished span as written to the span file
+type SpanData struct {
+	TraceID      string         `json:"traceId"`
+	SpanID       string         `json:"spanId"`
+	ParentSpanID string         `json:"parentSpanId,omitempty"`
+	Name         string         `json:"name"`
+	Kind         string         `json:"kind"`
+	Node         string         `json:"node"`
+	NodeID       string         `json:"nodeId,omitempty"`
+	Start        time.Time      `json:"start"`
+	End          time.Time      `json:"end"`
+	Attributes   map[string]any `json:"attributes,omitempty"`
+	Error        string         `json:"error,omitempty"`
+
+	kind int
+}
+
+// Receives spans when they end
+type SpanExporter interface {
+	ExportSpan(span SpanData) error
+}
+
+// Creates spans and passes the sampled ones to the exporter
+type Tracer struct {
+	logger   *slog.Logger
+	exporter SpanExporter
+	node     string
+	nodeID   string
+}
+
+// Tracer of the node, replaced in Run if TRACE_FILE is set.
+// Without an exporter spans only propagate the trace context.
+var tracer = NewTracer(slog.New(slog.DiscardHandler), nil, "", "")
+
+// Creates tracer exporting spans of the node with the address and ID
+func NewTracer(logger *slog.Logger, exporter SpanExporter, node string, nodeID string) *Tracer {
+	return &Tracer{logger: logger, exporter: exporter, node: node, nodeID: nodeID}
+}
+
+// Operation of the node being traced.
+// Methods of nil spans do nothing.
+type Span struct {
+	tracer  *Tracer
+	name    string
+	kind    int
+	context SpanContext
+	parent  [8]byte
+	start   time.Time
+
+	mu         sync.Mutex
+	attributes map[string]any
+	err        error
+	ended      bool
+}
+
+// Starts span as child of the span carried by ctx, or as root of a new trace.
+// Attributes are given as key-value pairs.
+// Returns ctx carrying the new span.
+func (t *Tracer) Start(ctx context.Context, name string, kind int, attrs ...any) (context.Context, *Span) {
+	s := &Span{tracer: t, name: name, kind: kind, start: time.Now(), attributes: make(map[string]any)}
+
+	if parent, ok := spanContextFrom(ctx); ok && parent.IsValid() {
+		s.context.TraceID = parent.TraceID
+		s.context.Sampled = parent.Sampled
+		s.parent = parent.SpanID
+	} else {
+		_, _ = rand.Read(s.context.TraceID[:])
+		s.context.Sampled = true
+	}
+	_, _ = rand.Read(s.context.SpanID[:])
+
+	s.SetAttributes(attrs...)
+	return contextWithSpanContext(ctx, s.context), s
+}
+
+// Starts span of a gossip message continuing the trace it carries.
+// Untraced messages get no span, so only traces started by this or other nodes are recorded.
+func (t *Tracer) StartMessage(msg GossipMessage, name string, kind int, attrs ...any) (context.Context, *Span) {
+	ctx := contextWithTraceParent(context.Background(), msg.TraceParent)
+	if _, ok := spanContextFrom(ctx); !ok {
+		return ctx, nil
+	}
+	return t.Start(ctx, name, kind, attrs...)
+}
+
+// Returns the trace context of the span
+func (s *Span) Context() SpanContext {
+	return s.context
+}
+
+// Sets attributes given as key-value pairs
+func (s *Span) SetAttributes(attrs ...any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := 0; i+1 < len(attrs); i += 2 {
+		if key, ok := attrs[i].(string); ok {
+			s.attributes[key] = attrs[i+1]
+		}
+	}
+}
+
+// Marks the span as failed with the error, nil errors are ignored
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.err = err
+}
+
+// Ends the span and exports it if sampled.
+// Later calls do nothing.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	end := time.Now()
+
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	data := SpanData{
+		TraceID:    hex.EncodeToString(s.context.TraceID[:]),
+		SpanID:     hex.EncodeToString(s.context.SpanID[:]),
+		Name:       s.name,
+		Kind:       spanKindNames[s.kind],
+		Node:       s.tracer.node,
+		NodeID:     s.tracer.nodeID,
+		Start:      s.start,
+		End:        end,
+		Attributes: s.attributes,
+		kind:       s.kind,
+	}
+	if s.parent != [8]byte{} {
+		data.ParentSpanID = hex.EncodeToString(s.parent[:])
+	}
+	if s.err != nil {
+		data.Error = s.err.Error()
+	}
+	s.mu.Unlock()
+
+	if s.tracer.exporter == nil || !s.context.Sampled {
+		return
+	}
+	if err := s.tracer.exporter.ExportSpan(data); err != nil {
+		s.tracer.logger.Warn("Failed to export span", "span", s.name, "err", err)
+	}
+}
+
+// Adds trace context of incoming peer requests to the request context
+func extractTraceContext(next http.Handler) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if value := r.Header.Get(traceParentHeader); value != "" {
+				r = r.WithContext(contextWithTraceParent(r.Context(), value))
+			}
+			next.ServeHTTP(w, r)
+		},
+	)
+}
+
+// Writes spans to a file, one per line
+type FileExporter struct {
+	mu     sync.Mutex
+	file   *os.File
+	buf    *bufio.Writer
+	format string
+}
+
+// Opens file for appending spans in the json or otlp format
+func NewFileExporter(path string, format string) (*FileExporter, error) {
+	if format != traceFormatJSON && format != traceFormatOTLP {
+		return nil, fmt.Errorf("Unknown trace format %q", format)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open trace file: %w", err)
+	}
+	return &FileExporter{file: file, buf: bufio.NewWriter(file), format: format}, nil
+}
+
+// Writes span to the file.
+// Each span is flushed, so the file stays readable while the node runs.
+func (e *FileExporter) ExportSpan(span SpanData) error {
+	var record any = span
+	if e.format == traceFormatOTLP {
+		record = otlpExportRequest(span)
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("encode json: %w", err)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.file == nil {
+		return errors.New("Trace file is closed")
+	}
+	if _, err := e.buf.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return e.buf.Flush()
+}
+
+// Closes the file, later spans are rejected
+func (e *FileExporter) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.file == nil {
+		return nil
+	}
+	err := errors.Join(e.buf.Flush(), e.file.Close())
+	e.file = nil
+	return err
+}
+
+// OTLP/JSON export request, see opentelemetry-proto trace/v1
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+// Attribute value, 64-bit integers are encoded as strings
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// OTLP status code of failed spans
+const otlpStatusError = 2
+
+// Converts attribute value to its OTLP form
+func otlpValueOf(value any) otlpValue {
+	switch v := value.(type) {
+	case string:
+		return otlpValue{StringValue: &v}
+	case bool:
+		return otlpValue{BoolValue: &v}
+	case int:
+		s := strconv.Itoa(v)
+		return otlpValue{IntValue: &s}
+	case int64:
+		s := strconv.FormatInt(v, 10)
+		return otlpValue{IntValue: &s}
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			s := strconv.FormatFloat(v, 'g', -1, 64)
+			return otlpValue{StringValue: &s}
+		}
+		return otlpValue{DoubleValue: &v}
+	case time.Duration:
+		s := strconv.FormatInt(int64(v), 10)
+		return otlpValue{IntValue: &s}
+	default:
+		s := fmt.Sprint(v)
+		return otlpValue{StringValue: &s}
+	}
+}
+
+// Returns OTLP attributes in key order
+func otlpAttributes(attrs map[string]any) []otlpAttribute {
+	list := []otlpAttribute{}
+	for _, key := range slices.Sorted(maps.Keys(attrs)) {
+		list = append(list, otlpAttribute{Key: key, Value: otlpValueOf(attrs[key])})
+	}
+	return list
+}
+
+// Wraps span in an export request with the node as resource
+func otlpExportRequest(span SpanData) otlpRequest {
+	resource := map[string]any{"service.name": "gochain", "node.address": span.Node}
+	if span.NodeID != "" {
+		resource["service.instance.id"] = span.NodeID
+	}
+
+	s := otlpSpan{
+		TraceID:           span.TraceID,
+		SpanID:            span.SpanID,
+		ParentSpanID:      span.ParentSpanID,
+		Name:              span.Name,
+		Kind:              span.kind,
+		StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+		Attributes:        otlpAttributes(span.Attributes),
+	}
+	if span.Error != "" {
+		s.Status = otlpStatus{Code: otlpStatusError, Message: span.Error}
+	}
+
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: otlpAttributes(resource)},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "GoChain/server"}, Spans: []otlpSpan{s}}},
+	}}}
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Records exported spans
+type recordedSpans struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func (r *recordedSpans) ExportSpan(span SpanData) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.spans = append(r.spans, span)
+	return nil
+}
+
+// Waits up to a second for a span with the name, failing the test if there is none
+func (r *recordedSpans) find(t *testing.T, name string) SpanData {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		r.mu.Lock()
+		for _, span := range r.spans {
+			if span.Name == name {
+				r.mu.Unlock()
+				return span
+			}
+		}
+		r.mu.Unlock()
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("No %v span was exported", name)
+	return SpanData{}
+}
+
+// Replaces the node tracer with one recording spans for the test
+func useTestTracer(t *testing.T) *recordedSpans {
+	spans := &recordedSpans{}
+	previous := tracer
+	tracer = NewTracer(slog.New(slog.DiscardHandler), spans, "node0:8000", "")
+	t.Cleanup(func() { tracer = previous })
+	return spans
+}
+
+// Parses valid and invalid traceparent values, checking the result and the round trip
+func TestParseTraceParent(t *testing.T) {
+	valid := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	c, err := parseTraceParent(valid)
+	if err != nil || !c.Sampled || c.TraceParent() != valid {
+		t.Errorf("parseTraceParent(%q) = %v, %v, want sampled context with the same value", valid, c.TraceParent(), err)
+	}
+
+	// Later versions may append fields
+	if _, err := parseTraceParent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra"); err != nil {
+		t.Errorf("parseTraceParent() rejected a later version: %v", err)
+	}
+
+	for _, value := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-xx",
+	} {
+		if _, err := parseTraceParent(value); err == nil {
+			t.Errorf("parseTraceParent(%q) returned no error", value)
+		}
+	}
+}
+
+// Publishes a message from a mining span and receives it on another gossiper,
+// checking that broadcast and validation spans continue the mining trace
+func TestGossipContinuesTrace(t *testing.T) {
+	spans := useTestTracer(t)
+	g, sent := newTestGossiper(1, 5, "node1:8001")
+
+	ctx, mine := tracer.Start(context.Background(), spanMine, spanInternal)
+	mine.End()
+	if err := g.Publish(ctx, "test", "1", "payload"); err != nil {
+		t.Fatalf("Publish() returned an error: %v", err)
+	}
+	sent.wait(1)
+
+	broadcast := spans.find(t, spanBroadcast)
+	root := spans.find(t, spanMine)
+	if broadcast.TraceID != root.TraceID || broadcast.ParentSpanID != root.SpanID {
+		t.Errorf("Broadcast span = %+v, want child of mining span %+v", broadcast, root)
+	}
+
+	sent.mu.Lock()
+	msg := sent.sent["node1:8001"]
+	sent.mu.Unlock()
+	if want := "00-" + broadcast.TraceID + "-" + broadcast.SpanID + "-01"; msg.TraceParent != want {
+		t.Errorf("Sent message traceparent = %q, want %q", msg.TraceParent, want)
+	}
+
+	receiver, _ := newTestGossiper(1, 5, "node2:8002")
+	if _, err := receiver.Receive(msg, "node0:8000"); err != nil {
+		t.Fatalf("Receive() returned an error: %v", err)
+	}
+	if validate := spans.find(t, spanValidate); validate.TraceID != root.TraceID || validate.ParentSpanID != broadcast.SpanID {
+		t.Errorf("Validation span = %+v, want child of broadcast span %+v", validate, broadcast)
+	}
+}
+
+// Sets peer headers on a request with a span, checking the traceparent header
+func TestSetPeerHeadersTraceParent(t *testing.T) {
+	ctx, span := NewTracer(slog.New(slog.DiscardHandler), nil, "", "").Start(context.Background(), spanSync, spanClient)
+	req := httptest.NewRequestWithContext(ctx, "GET", "/peers", nil)
+	setPeerHeaders(req)
+
+	if got := req.Header.Get(traceParentHeader); got != span.Context().TraceParent() {
+		t.Errorf("traceparent = %q, want %q", got, span.Context().TraceParent())
+	}
+}
+
+// Exports a failed span in the OTLP format, checking the written export request
+func TestFileExporterOTLP(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.jsonl")
+	exporter, err := NewFileExporter(path, traceFormatOTLP)
+	if err != nil {
+		t.Fatalf("NewFileExporter() returned an error: %v", err)
+	}
+
+	_, span := NewTracer(slog.New(slog.DiscardHandler), exporter, "node0:8000", "id0").Start(context.Background(), spanSync, spanClient, "height", 3)
+	span.SetError(os.ErrDeadlineExceeded)
+	span.End()
+	if err := exporter.Close(); err != nil {
+		t.Fatalf("Close() returned an error: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Reading span file returned an error: %v", err)
+	}
+	var request otlpRequest
+	if err := json.Unmarshal(data, &request); err != nil {
+		t.Fatalf("Span file is not an OTLP/JSON request: %v", err)
+	}
+
+	s := request.ResourceSpans[0].ScopeSpans[0].Spans[0]
+	if s.Name != spanSync || s.Kind != spanClient || s.TraceID != hexTraceID(span) || s.Status.Code != otlpStatusError {
+		t.Errorf("Exported span = %+v, want failed client span %v", s, spanSync)
+	}
+	if len(s.Attributes) != 1 || s.Attributes[0].Key != "height" || s.Attributes[0].Value.IntValue == nil || *s.Attributes[0].Value.IntValue != "3" {
+		t.Errorf("Exported attributes = %+v, want height 3 as intValue", s.Attributes)
+	}
+}
+
+// Returns trace ID of the span in hex
+func hexTraceID(span *Span) string {
+	return span.Context().TraceParent()[3:35]
+}
@@ -0,0 +1,536 @@
+package server
+
+import (
+	"GoChain/block"
+	"GoChain/wire"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+)
+
+// Default binary protocol settings, overridable with WIRE_PING_INTERVAL and WIRE_DIAL_TIMEOUT.
+// Binary protocol is enabled by setting WIRE_ADDR to the TCP address to listen on.
+const (
+	defaultWirePingInterval = 30 * time.Second
+	defaultWireDialTimeout  = 5 * time.Second
+)
+
+// Connections that haven't sent anything for this many ping intervals are closed
+const wireIdlePings = 3
+
+// Returns the TCP address this node accepts binary protocol connections on, empty if disabled
+func localWireAddress() string {
+	if wireTransport == nil {
+		return ""
+	}
+	return wireTransport.address
+}
+
+// Persistent TCP connection to a peer speaking the binary protocol
+type wireConn struct {
+	address string
+	nodeID  string
+	conn    net.Conn
+	// Whether this node dialed the connection
+	outbound bool
+
+	writeMu sync.Mutex
+
+	mu       sync.Mutex
+	lastRead time.Time
+	pingSent time.Time
+	nonce    uint64
+}
+
+// Writes message to the connection
+func (c *wireConn) write(msg wire.Message, timeout time.Duration) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(timeout))
+	return wire.WriteMessage(c.conn, msg)
+}
+
+// Returns node ID of the side that dialed the connection
+func (c *wireConn) dialerID() string {
+	if c.outbound {
+		return identity.ID
+	}
+	return c.nodeID
+}
+
+// Binary protocol between nodes over persistent TCP connections.
+// Connections are identified by the peer HTTP address, so the peer must be admitted over HTTP first.
+// The dialing side introduces itself with an addr message carrying its own address and node ID,
+// and proves the node ID by signing the challenge nonce sent back by the accepting side.
+type WireTransport struct {
+	logger       *slog.Logger
+	address      string
+	pingInterval time.Duration
+	dialTimeout  time.Duration
+
+	// Passes received block to gossip
+	receiveBlock func(ctx context.Context, logger *slog.Logger, b block.Block, from string, ttl int)
+	// Passes relayed address to gossip
+	receiveAddress func(logger *slog.Logger, a wire.NetAddress, from string, ttl int)
+	// Pulls requested blocks the peer didn't deliver from their next announcer
+	retryPull func(ctx context.Context, logger *slog.Logger, hashes []string, tried string, ttl int)
+
+	mu    sync.Mutex
+	conns map[string]*wireConn
+
+	// Connection goroutines, waited for when the transport stops
+	wg sync.WaitGroup
+}
+
+// Binary protocol transport of the node, nil if it is disabled
+var wireTransport *WireTransport
+
+// Creates binary protocol transport listening on address
+func NewWireTransport(logger *slog.Logger, address string, pingInterval time.Duration, dialTimeout time.Duration) *WireTransport {
+	return &WireTransport{
+		logger:         logger,
+		address:        address,
+		pingInterval:   pingInterval,
+		dialTimeout:    dialTimeout,
+		receiveBlock:   receiveBlock,
+		receiveAddress: receiveAddress,
+		retryPull:      retryPull,
+		conns:          make(map[string]*wireConn),
+	}
+}
+
+// Returns open connection to the peer, dialing it if there is none
+func (t *WireTransport) connection(address string) (*wireConn, error) {
+	t.mu.Lock()
+	c, ok := t.conns[address]
+	t.mu.Unlock()
+	if ok {
+		return c, nil
+	}
+
+	peer, ok := peers.Get(address)
+	if !ok || peer.WireAddress == "" {
+		return nil, fmt.Errorf("Node %v doesn't accept binary protocol connections", address)
+	}
+
+	conn, err := net.DialTimeout("tcp", peer.WireAddress, t.dialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("Error connecting to host: %v, %v", peer.WireAddress, err)
+	}
+	if nodeTLS != nil {
+		tlsConn := tls.Client(conn, nodeTLS.ClientConfig(peer.NodeID))
+		tlsConn.SetDeadline(time.Now().Add(t.dialTimeout))
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("TLS handshake with %v failed: %v", peer.WireAddress, err)
+		}
+		tlsConn.SetDeadline(time.Time{})
+		conn = tlsConn
+	}
+
+	c = &wireConn{address: address, nodeID: peer.NodeID, conn: conn, outbound: true, lastRead: time.Now()}
+	hello := &wire.Addr{Addresses: []wire.NetAddress{{Address: localAddress(), NodeID: identity.ID}}}
+	if err := c.write(hello, t.dialTimeout); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := t.answerChallenge(c); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("Binary protocol authentication with %v failed: %w", address, err)
+	}
+
+	if existing, ok := t.register(c); !ok {
+		conn.Close()
+		return existing, nil
+	}
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		t.serve(c)
+	}()
+	return c, nil
+}
+
+// Returns message signed by the dialing node to prove its node ID.
+// It names the accepting node, so the signature can't be relayed to another node.
+func wireAuthMessage(nonce string, address string, acceptingID string) []byte {
+	return []byte("GoChain wire\n" + nonce + "\n" + address + "\n" + acceptingID)
+}
+
+// Signs the challenge sent by the accepting peer after the introduction
+func (t *WireTransport) answerChallenge(c *wireConn) error {
+	c.conn.SetReadDeadline(time.Now().Add(t.dialTimeout))
+	msg, err := wire.ReadMessage(c.conn)
+	c.conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		return err
+	}
+	challenge, ok := msg.(*wire.Challenge)
+	if !ok {
+		return fmt.Errorf("Expected challenge, got %v", msg.Command())
+	}
+
+	signature := identity.Sign(wireAuthMessage(challenge.Nonce, localAddress(), c.nodeID))
+	return c.write(&wire.Auth{Signature: hex.EncodeToString(signature)}, t.dialTimeout)
+}
+
+// Sends a fresh nonce to the introduced node and checks that it is signed with the key of its node ID
+func (t *WireTransport) challenge(c *wireConn) error {
+	nonce := rand.Text()
+	if err := c.write(&wire.Challenge{Nonce: nonce}, t.dialTimeout); err != nil {
+		return err
+	}
+
+	c.conn.SetReadDeadline(time.Now().Add(t.dialTimeout))
+	msg, err := wire.ReadMessage(c.conn)
+	c.conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		return err
+	}
+	auth, ok := msg.(*wire.Auth)
+	if !ok {
+		return fmt.Errorf("Expected auth, got %v", msg.Command())
+	}
+	signature, err := hex.DecodeString(auth.Signature)
+	if err != nil {
+		return errors.New("Malformed signature")
+	}
+	return verifyNodeSignature(c.nodeID, wireAuthMessage(nonce, c.address, identity.ID), signature)
+}
+
+// Adds connection unless the one already open to the peer is kept, which is returned instead.
+// When both nodes dial each other at once, both keep the connection dialed by the lower node ID.
+// A dialed connection doesn't replace another dialed one, while an accepted one replaces
+// the older accepted one, as the peer may have restarted.
+func (t *WireTransport) register(c *wireConn) (*wireConn, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if existing, ok := t.conns[c.address]; ok {
+		keep := existing.dialerID() < c.dialerID()
+		if existing.outbound == c.outbound {
+			keep = c.outbound
+		}
+		if keep {
+			return existing, false
+		}
+		existing.conn.Close()
+	}
+	t.conns[c.address] = c
+	return c, true
+}
+
+// Closes connection and forgets it
+func (t *WireTransport) close(c *wireConn) {
+	t.mu.Lock()
+	if t.conns[c.address] == c {
+		delete(t.conns, c.address)
+	}
+	t.mu.Unlock()
+	c.conn.Close()
+}
+
+// Sends message to the peer, dialing it if needed
+func (t *WireTransport) Send(address string, msg wire.Message) error {
+	c, err := t.connection(address)
+	if err != nil {
+		return err
+	}
+	if err := c.write(msg, t.dialTimeout); err != nil {
+		t.close(c)
+		return fmt.Errorf("Failed to send %v to %v: %w", msg.Command(), address, err)
+	}
+	return nil
+}
+
+// Accepts incoming connection, which must start with addr message introducing a known peer
+// followed by the signed challenge proving its node ID
+func (t *WireTransport) accept(conn net.Conn) {
+	conn.SetReadDeadline(time.Now().Add(t.dialTimeout))
+	msg, err := wire.ReadMessage(conn)
+	conn.SetReadDeadline(time.Time{})
+
+	hello, ok := msg.(*wire.Addr)
+	if err != nil || !ok || len(hello.Addresses) != 1 {
+		t.logger.Info("Rejected binary protocol connection: missing introduction", "remote", conn.RemoteAddr())
+		conn.Close()
+		return
+	}
+
+	address, nodeID := hello.Addresses[0].Address, hello.Addresses[0].NodeID
+	if knownID, ok := peers.NodeID(address); !ok || knownID != nodeID || banList.IsBanned(address, nodeID) {
+		t.logger.Info("Rejected binary protocol connection: not an admitted peer", "remote", conn.RemoteAddr(), "peer", address)
+		conn.Close()
+		return
+	}
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		state := tlsConn.ConnectionState()
+		if tlsNodeID(&state) != nodeID {
+			t.logger.Warn("Rejected binary protocol connection: certificate is not bound to node ID", "remote", conn.RemoteAddr(), "node_id", nodeID)
+			conn.Close()
+			return
+		}
+	}
+
+	c := &wireConn{address: address, nodeID: nodeID, conn: conn, lastRead: time.Now()}
+	if err := t.challenge(c); err != nil {
+		t.logger.Warn("Rejected binary protocol connection: node ID not proven", "remote", conn.RemoteAddr(), "peer", address, "err", err)
+		conn.Close()
+		return
+	}
+
+	// Registered only now that the node is proven
+	if _, ok := t.register(c); !ok {
+		t.logger.Debug("Closed binary protocol connection: keeping the one dialed by the lower node ID", "peer", address)
+		conn.Close()
+		return
+	}
+
+	t.serve(c)
+}
+
+// Reads and handles messages until the connection fails
+func (t *WireTransport) serve(c *wireConn) {
+	defer t.close(c)
+
+	for {
+		msg, err := wire.ReadMessage(c.conn)
+		if errors.Is(err, wire.ErrUnknownCommand) {
+			continue
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				t.logger.Info("Binary protocol connection failed", "peer", c.address, "err", err)
+				if !isNetError(err) {
+					penalizePeer(t.logger, c.address, offenceDecodeFailure)
+				}
+			}
+			return
+		}
+
+		c.mu.Lock()
+		c.lastRead = time.Now()
+		c.mu.Unlock()
+
+		if err := t.handle(c, msg); err != nil {
+			t.logger.Info("Binary protocol connection failed", "peer", c.address, "err", err)
+			return
+		}
+	}
+}
+
+// Checks if the error comes from the connection rather than from message contents
+func isNetError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// Handles one message from the peer
+func (t *WireTransport) handle(c *wireConn, msg wire.Message) error {
+	switch m := msg.(type) {
+	case *wire.Ping:
+		return c.write(&wire.Pong{Nonce: m.Nonce}, t.dialTimeout)
+
+	case *wire.Pong:
+		c.mu.Lock()
+		latency := time.Since(c.pingSent)
+		matches := m.Nonce == c.nonce
+		c.mu.Unlock()
+		if peer, ok := peers.Get(c.address); ok && matches {
+			peers.RecordSuccess(c.address, latency, peer.Height, peer.ProtocolVersion)
+		}
+
+	case *wire.Inv:
+		return t.requestUnknown(c, m.Hashes, m.TTL, m.TraceParent)
+
+	case *wire.GetData:
+		for _, hash := range m.Hashes {
+			b, ok := block.GetBlockByHash(hash)
+			if !ok {
+				continue
+			}
+			peers.MarkKnown(c.address, hash)
+			if err := c.write(&wire.BlockMessage{Block: b, TTL: m.TTL, TraceParent: m.TraceParent}, t.dialTimeout); err != nil {
+				return err
+			}
+		}
+
+	case *wire.BlockMessage:
+		t.receiveBlock(contextWithTraceParent(context.Background(), m.TraceParent), t.logger, m.Block, c.address, m.TTL)
+
+	case *wire.Addr:
+		for _, a := range m.Addresses {
+			if m.TTL > 0 {
+				t.receiveAddress(t.logger, a, c.address, m.TTL)
+				continue
+			}
+			if validateNodeAddr(a.Address) != nil {
+				penalizePeer(t.logger, c.address, offenceInvalidMessage)
+				continue
+			}
+			addressBook.Add(a.Address, a.NodeID)
+		}
+	}
+	return nil
+}
+
+// Passes address relayed over the binary protocol to gossip as peer announcement,
+// which adds it to the address book and relays it further while the TTL lasts
+func receiveAddress(logger *slog.Logger, a wire.NetAddress, from string, ttl int) {
+	announcement := PeerAnnouncement{Address: a.Address, NodeID: a.NodeID}
+	msg, err := newGossipMessage(gossipPeer, a.Address+"/"+a.NodeID, announcedTTL(ttl), announcement)
+	if err != nil {
+		logger.Error("Failed to encode peer announcement", "address", a.Address, "err", err)
+		return
+	}
+	// The origin of a relayed address is unknown
+	msg.Origin = ""
+	if _, err := gossiper.Receive(msg, from); err != nil {
+		logger.Info("Peer announcement rejected", "address", a.Address, "peer", from, "err", err)
+	}
+}
+
+// Marks hashes as known to the peer and requests blocks this node doesn't have yet.
+// The request carries the TTL of the announcement and continues its trace, if any.
+// Blocks the peer doesn't deliver in time are pulled from their next announcer.
+func (t *WireTransport) requestUnknown(c *wireConn, hashes []string, ttl int, traceParent string) error {
+	unknown := []string{}
+	for _, hash := range hashes {
+		peers.MarkKnown(c.address, hash)
+		if _, ok := block.GetBlockByHash(hash); ok {
+			continue
+		}
+		blockAnnouncers.Add(hash, c.address)
+		if !requestedBlocks.Seen(hash) {
+			unknown = append(unknown, hash)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+
+	ctx := contextWithTraceParent(context.Background(), traceParent)
+	if err := c.write(&wire.GetData{Hashes: unknown, TTL: ttl, TraceParent: traceParent}, t.dialTimeout); err != nil {
+		t.retryPull(ctx, t.logger, unknown, c.address, ttl)
+		return err
+	}
+	time.AfterFunc(blockPullTimeout, func() { t.retryPull(ctx, t.logger, unknown, c.address, ttl) })
+	return nil
+}
+
+// Sends gossip message to the peer over the binary protocol.
+// Blocks are announced with inv, peer announcements are sent as addr.
+func (t *WireTransport) SendGossip(address string, msg GossipMessage) error {
+	switch msg.Kind {
+	case gossipBlock:
+		var b block.Block
+		if err := json.Unmarshal(msg.Payload, &b); err != nil {
+			return fmt.Errorf("decode json: %w", err)
+		}
+		if !peers.MarkKnown(address, b.Hash) {
+			return nil
+		}
+		// Unmarked on failure, so the HTTP fallback still announces the block
+		if err := t.Send(address, &wire.Inv{Hashes: []string{b.Hash}, TTL: msg.TTL, TraceParent: msg.TraceParent}); err != nil {
+			peers.ForgetKnown(address, b.Hash)
+			return err
+		}
+		return nil
+	case gossipPeer:
+		var announcement PeerAnnouncement
+		if err := json.Unmarshal(msg.Payload, &announcement); err != nil {
+			return fmt.Errorf("decode json: %w", err)
+		}
+		return t.Send(address, &wire.Addr{Addresses: []wire.NetAddress{{Address: announcement.Address, NodeID: announcement.NodeID}}, TTL: msg.TTL})
+	}
+	return fmt.Errorf("Unknown gossip message kind %q", msg.Kind)
+}
+
+// Pings open connections and closes idle ones and those of peers that are gone
+func (t *WireTransport) keepAlive() {
+	t.mu.Lock()
+	conns := make([]*wireConn, 0, len(t.conns))
+	for _, c := range t.conns {
+		conns = append(conns, c)
+	}
+	t.mu.Unlock()
+
+	for _, c := range conns {
+		c.mu.Lock()
+		idle := time.Since(c.lastRead)
+		c.mu.Unlock()
+
+		if idle > wireIdlePings*t.pingInterval || !peers.Contains(c.address) {
+			t.close(c)
+			continue
+		}
+
+		var buf [8]byte
+		rand.Read(buf[:])
+		nonce := binary.BigEndian.Uint64(buf[:])
+		c.mu.Lock()
+		c.nonce = nonce
+		c.pingSent = time.Now()
+		c.mu.Unlock()
+		if err := c.write(&wire.Ping{Nonce: nonce}, t.dialTimeout); err != nil {
+			t.close(c)
+		}
+	}
+}
+
+// Accepts connections and keeps them alive until the context is cancelled.
+// Returns once all connections are closed.
+func (t *WireTransport) Run(ctx context.Context, listener net.Listener) {
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	go func() {
+		ticker := time.NewTicker(t.pingInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				t.keepAlive()
+			}
+		}
+	}()
+
+	t.logger.Info("Binary protocol listening", "address", listener.Addr())
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() == nil {
+				t.logger.Info("Binary protocol listener stopped", "err", err)
+			}
+			break
+		}
+		t.wg.Add(1)
+		go func() {
+			defer t.wg.Done()
+			t.accept(conn)
+		}()
+	}
+
+	t.mu.Lock()
+	for _, c := range t.conns {
+		c.conn.Close()
+	}
+	t.mu.Unlock()
+	t.wg.Wait()
+}
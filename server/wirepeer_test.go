@@ -0,0 +1,248 @@
+package server
+
+import (
+	"GoChain/block"
+	"GoChain/wire"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+)
+
+// Starts binary protocol transport on a local port, recording received blocks.
+// Options change the transport before it starts.
+func startTestWireTransport(t *testing.T, options ...func(*WireTransport)) (*WireTransport, chan block.Block) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() returned an error: %v", err)
+	}
+
+	received := make(chan block.Block, 1)
+	transport := NewWireTransport(slog.New(slog.DiscardHandler), listener.Addr().String(), time.Minute, time.Second)
+	transport.receiveBlock = func(ctx context.Context, logger *slog.Logger, b block.Block, from string, ttl int) { received <- b }
+	for _, option := range options {
+		option(transport)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		transport.Run(ctx, listener)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return transport, received
+}
+
+// Connects to the transport introducing itself as the peer and signing the challenge with the key of id
+func dialTestWire(t *testing.T, transport *WireTransport, address string, nodeID string, id *Identity) net.Conn {
+	t.Helper()
+	conn, err := net.Dial("tcp", transport.address)
+	if err != nil {
+		t.Fatalf("Dial() returned an error: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(time.Second))
+
+	wire.WriteMessage(conn, &wire.Addr{Addresses: []wire.NetAddress{{Address: address, NodeID: nodeID}}})
+	msg, err := wire.ReadMessage(conn)
+	if challenge, ok := msg.(*wire.Challenge); err == nil && ok {
+		signature := id.Sign(wireAuthMessage(challenge.Nonce, address, identity.ID))
+		wire.WriteMessage(conn, &wire.Auth{Signature: hex.EncodeToString(signature)})
+	}
+	return conn
+}
+
+// Connects as a node that isn't a peer, checking that the connection is closed
+func TestWireTransportRejectsUnknownPeer(t *testing.T) {
+	peers = NewPeerSet()
+	transport, _ := startTestWireTransport(t)
+	peer := mustGenerateIdentity()
+
+	conn := dialTestWire(t, transport, "node1:8001", peer.ID, peer)
+
+	if _, err := wire.ReadMessage(conn); err != io.EOF {
+		t.Errorf("ReadMessage() = %v, want connection closed", err)
+	}
+}
+
+// Sends ping as a known peer, checking that pong with the same nonce is returned
+func TestWireTransportPing(t *testing.T) {
+	peers = NewPeerSet()
+	peer := mustGenerateIdentity()
+	peers.Add("node1:8001", peer.ID)
+	transport, _ := startTestWireTransport(t)
+
+	conn := dialTestWire(t, transport, "node1:8001", peer.ID, peer)
+	wire.WriteMessage(conn, &wire.Ping{Nonce: 7})
+
+	msg, err := wire.ReadMessage(conn)
+	if pong, ok := msg.(*wire.Pong); err != nil || !ok || pong.Nonce != 7 {
+		t.Errorf("ReadMessage() = %+v, %v, want pong with nonce 7", msg, err)
+	}
+}
+
+// Announces unknown block with inv and sends it, checking that it is requested and received
+func TestWireTransportInvAndBlock(t *testing.T) {
+	peers = NewPeerSet()
+	peer := mustGenerateIdentity()
+	peers.Add("node1:8001", peer.ID)
+	transport, received := startTestWireTransport(t)
+
+	// Hash must be new to the requested blocks cache
+	hash := fmt.Sprintf("wire-test-%d", time.Now().UnixNano())
+
+	conn := dialTestWire(t, transport, "node1:8001", peer.ID, peer)
+	wire.WriteMessage(conn, &wire.Inv{Hashes: []string{hash}, TTL: 4})
+
+	msg, err := wire.ReadMessage(conn)
+	if getData, ok := msg.(*wire.GetData); err != nil || !ok || len(getData.Hashes) != 1 || getData.Hashes[0] != hash || getData.TTL != 4 {
+		t.Fatalf("ReadMessage() = %+v, %v, want getdata for the hash with TTL 4", msg, err)
+	}
+
+	wire.WriteMessage(conn, &wire.BlockMessage{Block: block.Block{Hash: hash}, TTL: 4})
+	select {
+	case b := <-received:
+		if b.Hash != hash {
+			t.Errorf("Received block %v, want %v", b.Hash, hash)
+		}
+	case <-time.After(time.Second):
+		t.Error("Block was not received")
+	}
+}
+
+// Calls SendGossip for a block, checking that the peer is dialed, introduced to, the challenge is signed and inv is sent
+func TestWireTransportSendGossip(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() returned an error: %v", err)
+	}
+	defer listener.Close()
+
+	peers = NewPeerSet()
+	peer := mustGenerateIdentity()
+	peers.Add("node1:8001", peer.ID)
+	peers.SetWireAddress("node1:8001", listener.Addr().String())
+	transport := NewWireTransport(slog.New(slog.DiscardHandler), "127.0.0.1:0", time.Minute, time.Second)
+
+	msg, _ := newGossipMessage(gossipBlock, "abc", 3, block.Block{Hash: "abc"})
+	sent := make(chan error, 1)
+	go func() { sent <- transport.SendGossip("node1:8001", msg) }()
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept() returned an error: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Second))
+
+	hello, err := wire.ReadMessage(conn)
+	if addr, ok := hello.(*wire.Addr); err != nil || !ok || addr.Addresses[0].NodeID != identity.ID {
+		t.Errorf("First message = %+v, %v, want introduction", hello, err)
+	}
+	wire.WriteMessage(conn, &wire.Challenge{Nonce: "nonce"})
+	auth, err := wire.ReadMessage(conn)
+	m, ok := auth.(*wire.Auth)
+	if err != nil || !ok {
+		t.Fatalf("Answer to challenge = %+v, %v, want auth", auth, err)
+	}
+	signature, _ := hex.DecodeString(m.Signature)
+	if err := verifyNodeSignature(identity.ID, wireAuthMessage("nonce", localAddress(), peer.ID), signature); err != nil {
+		t.Errorf("Challenge signature doesn't verify: %v", err)
+	}
+	inv, err := wire.ReadMessage(conn)
+	if m, ok := inv.(*wire.Inv); err != nil || !ok || m.Hashes[0] != "abc" {
+		t.Errorf("Message after auth = %+v, %v, want inv for abc", inv, err)
+	}
+	if err := <-sent; err != nil {
+		t.Errorf("SendGossip() returned an error: %v", err)
+	}
+}
+
+// Connects as a known peer and then as an impostor naming the same address and node ID,
+// checking that the impostor is rejected and the proven connection keeps working
+func TestWireTransportRejectsImpostor(t *testing.T) {
+	peers = NewPeerSet()
+	peer := mustGenerateIdentity()
+	peers.Add("node1:8001", peer.ID)
+	transport, _ := startTestWireTransport(t)
+
+	conn := dialTestWire(t, transport, "node1:8001", peer.ID, peer)
+	wire.WriteMessage(conn, &wire.Ping{Nonce: 1})
+	if _, err := wire.ReadMessage(conn); err != nil {
+		t.Fatalf("ReadMessage() on the proven connection returned an error: %v", err)
+	}
+
+	impostor := dialTestWire(t, transport, "node1:8001", peer.ID, mustGenerateIdentity())
+	if _, err := wire.ReadMessage(impostor); err != io.EOF {
+		t.Errorf("ReadMessage() from impostor = %v, want connection closed", err)
+	}
+
+	wire.WriteMessage(conn, &wire.Ping{Nonce: 2})
+	msg, err := wire.ReadMessage(conn)
+	if pong, ok := msg.(*wire.Pong); err != nil || !ok || pong.Nonce != 2 {
+		t.Errorf("ReadMessage() on the proven connection = %+v, %v, want pong with nonce 2", msg, err)
+	}
+}
+
+// Sends addr relayed with a TTL, checking that it is passed to gossip with the TTL
+func TestWireTransportRelaysAddr(t *testing.T) {
+	peers = NewPeerSet()
+	peer := mustGenerateIdentity()
+	peers.Add("node1:8001", peer.ID)
+	relayed := make(chan int, 1)
+	transport, _ := startTestWireTransport(t, func(transport *WireTransport) {
+		transport.receiveAddress = func(logger *slog.Logger, a wire.NetAddress, from string, ttl int) { relayed <- ttl }
+	})
+
+	conn := dialTestWire(t, transport, "node1:8001", peer.ID, peer)
+	wire.WriteMessage(conn, &wire.Addr{Addresses: []wire.NetAddress{{Address: "node2:8002", NodeID: "id2"}}, TTL: 3})
+
+	select {
+	case ttl := <-relayed:
+		if ttl != 3 {
+			t.Errorf("Address relayed with TTL %v, want 3", ttl)
+		}
+	case <-time.After(time.Second):
+		t.Error("Address was not relayed")
+	}
+}
+
+// Registers the connections of a simultaneous dial in both orders,
+// checking that the one dialed by the lower node ID is kept either way
+func TestWireTransportRegisterKeepsLowerDialer(t *testing.T) {
+	peer := mustGenerateIdentity()
+	newConn := func(outbound bool) *wireConn {
+		local, remote := net.Pipe()
+		t.Cleanup(func() { local.Close(); remote.Close() })
+		return &wireConn{address: "node1:8001", nodeID: peer.ID, conn: local, outbound: outbound}
+	}
+
+	for _, outboundFirst := range []bool{true, false} {
+		transport := NewWireTransport(slog.New(slog.DiscardHandler), "127.0.0.1:0", time.Minute, time.Second)
+		outbound, inbound := newConn(true), newConn(false)
+		want := inbound
+		if identity.ID < peer.ID {
+			want = outbound
+		}
+
+		if outboundFirst {
+			transport.register(outbound)
+			transport.register(inbound)
+		} else {
+			transport.register(inbound)
+			transport.register(outbound)
+		}
+		if transport.conns["node1:8001"] != want {
+			t.Errorf("register() with outbound first %v didn't keep the connection dialed by the lower node ID", outboundFirst)
+		}
+	}
+}
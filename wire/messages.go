@@ -0,0 +1,374 @@
+package wire
+
+import (
+	"GoChain/block"
+	"encoding/binary"
+	"fmt"
+)
+
+// Message commands
+const (
+	CmdPing      = "ping"
+	CmdPong      = "pong"
+	CmdInv       = "inv"
+	CmdGetData   = "getdata"
+	CmdBlock     = "block"
+	CmdAddr      = "addr"
+	CmdChallenge = "challenge"
+	CmdAuth      = "auth"
+)
+
+// Largest number of entries in inv, getdata and addr messages
+const (
+	MaxInvHashes  = 50000
+	MaxAddresses  = 1000
+	maxStringSize = 1 << 20
+)
+
+// Largest hop count carried by inv, getdata, block and addr messages
+const MaxTTL = 255
+
+// Message of the protocol
+type Message interface {
+	// Returns command of the message
+	Command() string
+
+	appendPayload(buf []byte) []byte
+	decodePayload(d *decoder) error
+}
+
+// Creates empty message for the command
+func newMessage(command string) (Message, error) {
+	switch command {
+	case CmdPing:
+		return &Ping{}, nil
+	case CmdPong:
+		return &Pong{}, nil
+	case CmdInv:
+		return &Inv{}, nil
+	case CmdGetData:
+		return &GetData{}, nil
+	case CmdBlock:
+		return &BlockMessage{}, nil
+	case CmdAddr:
+		return &Addr{}, nil
+	case CmdChallenge:
+		return &Challenge{}, nil
+	case CmdAuth:
+		return &Auth{}, nil
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnknownCommand, command)
+}
+
+// Liveness check, answered with pong carrying the same nonce
+type Ping struct {
+	Nonce uint64
+}
+
+func (m *Ping) Command() string { return CmdPing }
+
+func (m *Ping) appendPayload(buf []byte) []byte {
+	return binary.BigEndian.AppendUint64(buf, m.Nonce)
+}
+
+func (m *Ping) decodePayload(d *decoder) error {
+	m.Nonce = d.uint64()
+	return d.finish()
+}
+
+// Answer to ping
+type Pong struct {
+	Nonce uint64
+}
+
+func (m *Pong) Command() string { return CmdPong }
+
+func (m *Pong) appendPayload(buf []byte) []byte {
+	return binary.BigEndian.AppendUint64(buf, m.Nonce)
+}
+
+func (m *Pong) decodePayload(d *decoder) error {
+	m.Nonce = d.uint64()
+	return d.finish()
+}
+
+// Announces hashes of blocks the sender has
+type Inv struct {
+	Hashes []string
+	// Remaining hop count of the announced blocks
+	TTL int
+	// W3C trace context of the announcement, optional
+	TraceParent string
+}
+
+func (m *Inv) Command() string { return CmdInv }
+
+func (m *Inv) appendPayload(buf []byte) []byte {
+	buf = binary.AppendUvarint(appendStrings(buf, m.Hashes), uint64(m.TTL))
+	return appendOptionalString(buf, m.TraceParent)
+}
+
+func (m *Inv) decodePayload(d *decoder) error {
+	m.Hashes = d.strings(MaxInvHashes)
+	m.TTL = d.ttl()
+	m.TraceParent = d.optionalString()
+	return d.finish()
+}
+
+// Requests full blocks for the hashes, answered with block messages
+type GetData struct {
+	Hashes []string
+	// Hop count of the announcement, returned in the block messages
+	TTL int
+	// W3C trace context of the request, optional
+	TraceParent string
+}
+
+func (m *GetData) Command() string { return CmdGetData }
+
+func (m *GetData) appendPayload(buf []byte) []byte {
+	buf = binary.AppendUvarint(appendStrings(buf, m.Hashes), uint64(m.TTL))
+	return appendOptionalString(buf, m.TraceParent)
+}
+
+func (m *GetData) decodePayload(d *decoder) error {
+	m.Hashes = d.strings(MaxInvHashes)
+	m.TTL = d.ttl()
+	m.TraceParent = d.optionalString()
+	return d.finish()
+}
+
+// Carries a full block
+type BlockMessage struct {
+	Block block.Block
+	// Hop count of the getdata request
+	TTL int
+	// W3C trace context of the request, optional
+	TraceParent string
+}
+
+func (m *BlockMessage) Command() string { return CmdBlock }
+
+func (m *BlockMessage) appendPayload(buf []byte) []byte {
+	buf = binary.AppendVarint(buf, int64(m.Block.Index))
+	buf = appendString(buf, m.Block.Time)
+	buf = appendString(buf, m.Block.Data)
+	buf = appendString(buf, m.Block.PrevHash)
+	buf = appendString(buf, m.Block.Hash)
+	buf = binary.AppendVarint(buf, int64(m.Block.Nonce))
+	buf = binary.AppendUvarint(buf, uint64(m.TTL))
+	return appendOptionalString(buf, m.TraceParent)
+}
+
+func (m *BlockMessage) decodePayload(d *decoder) error {
+	m.Block.Index = int(d.varint())
+	m.Block.Time = d.string()
+	m.Block.Data = d.string()
+	m.Block.PrevHash = d.string()
+	m.Block.Hash = d.string()
+	m.Block.Nonce = int(d.varint())
+	m.TTL = d.ttl()
+	m.TraceParent = d.optionalString()
+	return d.finish()
+}
+
+// Address of a node
+type NetAddress struct {
+	Address string
+	NodeID  string
+}
+
+// Shares addresses of known nodes
+type Addr struct {
+	Addresses []NetAddress
+	// Remaining hop count of the announcement, zero for addresses that aren't relayed
+	TTL int
+}
+
+func (m *Addr) Command() string { return CmdAddr }
+
+func (m *Addr) appendPayload(buf []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(m.Addresses)))
+	for _, a := range m.Addresses {
+		buf = appendString(buf, a.Address)
+		buf = appendString(buf, a.NodeID)
+	}
+	return binary.AppendUvarint(buf, uint64(m.TTL))
+}
+
+func (m *Addr) decodePayload(d *decoder) error {
+	n := d.count(MaxAddresses)
+	m.Addresses = make([]NetAddress, 0, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		m.Addresses = append(m.Addresses, NetAddress{Address: d.string(), NodeID: d.string()})
+	}
+	m.TTL = d.ttl()
+	return d.finish()
+}
+
+// Nonce the accepting side sends after the introduction, to be signed by the introduced node
+type Challenge struct {
+	Nonce string
+}
+
+func (m *Challenge) Command() string { return CmdChallenge }
+
+func (m *Challenge) appendPayload(buf []byte) []byte {
+	return appendString(buf, m.Nonce)
+}
+
+func (m *Challenge) decodePayload(d *decoder) error {
+	m.Nonce = d.string()
+	return d.finish()
+}
+
+// Signature of the challenge by the identity key of the introduced node
+type Auth struct {
+	Signature string
+}
+
+func (m *Auth) Command() string { return CmdAuth }
+
+func (m *Auth) appendPayload(buf []byte) []byte {
+	return appendString(buf, m.Signature)
+}
+
+func (m *Auth) decodePayload(d *decoder) error {
+	m.Signature = d.string()
+	return d.finish()
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+// Appends string ending the payload, left out when empty
+// so messages without it keep the layout older nodes accept
+func appendOptionalString(buf []byte, s string) []byte {
+	if s == "" {
+		return buf
+	}
+	return appendString(buf, s)
+}
+
+func appendStrings(buf []byte, list []string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(list)))
+	for _, s := range list {
+		buf = appendString(buf, s)
+	}
+	return buf
+}
+
+// Reads payload fields, remembering the first error so fields can be read without checking each one
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) fail(format string, args ...any) {
+	if d.err == nil {
+		d.err = fmt.Errorf("%w: "+format, append([]any{ErrMalformed}, args...)...)
+	}
+}
+
+func (d *decoder) uint64() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.buf) < 8 {
+		d.fail("truncated integer")
+		return 0
+	}
+	v := binary.BigEndian.Uint64(d.buf)
+	d.buf = d.buf[8:]
+	return v
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.fail("invalid varint")
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.fail("invalid varint")
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+// Reads hop count, which can't exceed MaxTTL
+func (d *decoder) ttl() int {
+	n := d.uvarint()
+	if d.err == nil && n > MaxTTL {
+		d.fail("TTL of %v", n)
+		return 0
+	}
+	return int(n)
+}
+
+// Reads number of list entries, which can't exceed max or the remaining payload
+func (d *decoder) count(max int) int {
+	n := d.uvarint()
+	if d.err != nil {
+		return 0
+	}
+	if n > uint64(max) || n > uint64(len(d.buf)) {
+		d.fail("list of %v entries", n)
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) string() string {
+	n := d.uvarint()
+	if d.err != nil {
+		return ""
+	}
+	if n > maxStringSize || n > uint64(len(d.buf)) {
+		d.fail("string of %v bytes", n)
+		return ""
+	}
+	s := string(d.buf[:n])
+	d.buf = d.buf[n:]
+	return s
+}
+
+func (d *decoder) strings(max int) []string {
+	n := d.count(max)
+	list := make([]string, 0, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		list = append(list, d.string())
+	}
+	return list
+}
+
+// Reads string ending the payload, empty if the payload ends without it
+func (d *decoder) optionalString() string {
+	if d.err != nil || len(d.buf) == 0 {
+		return ""
+	}
+	return d.string()
+}
+
+// Returns the first error, or an error if the payload has trailing bytes
+func (d *decoder) finish() error {
+	if d.err == nil && len(d.buf) > 0 {
+		d.fail("%v trailing bytes", len(d.buf))
+	}
+	return d.err
+}
@@ -0,0 +1,153 @@
+// Package wire implements the binary protocol spoken between nodes over persistent TCP connections.
+//
+// Every message is a 24 byte header followed by the payload:
+//
+//	magic    4 bytes  network identifier
+//	command 12 bytes  ASCII message name padded with zeros
+//	length   4 bytes  payload length
+//	checksum 4 bytes  first 4 bytes of the SHA-256 of the payload
+//
+// Integers in the header are big endian, payload fields are encoded with varints
+// and length-prefixed byte strings.
+package wire
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Identifies GoChain messages in the stream, "GOCH"
+const Magic uint32 = 0x474f4348
+
+// Sizes of the message header and its fields
+const (
+	HeaderSize   = 24
+	commandSize  = 12
+	checksumSize = 4
+)
+
+// Largest accepted payload
+const MaxPayloadSize = 4 << 20
+
+// Errors returned when reading a malformed message
+var (
+	ErrBadMagic        = errors.New("Bad message magic")
+	ErrBadChecksum     = errors.New("Message checksum mismatch")
+	ErrPayloadTooLarge = errors.New("Message payload too large")
+	ErrUnknownCommand  = errors.New("Unknown message command")
+	ErrMalformed       = errors.New("Malformed message payload")
+)
+
+// Message header
+type Header struct {
+	Magic    uint32
+	Command  string
+	Length   uint32
+	Checksum [checksumSize]byte
+}
+
+// Returns checksum of the payload
+func Checksum(payload []byte) [checksumSize]byte {
+	sum := sha256.Sum256(payload)
+	var checksum [checksumSize]byte
+	copy(checksum[:], sum[:checksumSize])
+	return checksum
+}
+
+// Encodes header into its 24 byte form
+func (h Header) MarshalBinary() ([]byte, error) {
+	if len(h.Command) > commandSize {
+		return nil, fmt.Errorf("Command %q is longer than %v bytes", h.Command, commandSize)
+	}
+	buf := make([]byte, HeaderSize)
+	binary.BigEndian.PutUint32(buf[0:4], h.Magic)
+	copy(buf[4:4+commandSize], h.Command)
+	binary.BigEndian.PutUint32(buf[16:20], h.Length)
+	copy(buf[20:24], h.Checksum[:])
+	return buf, nil
+}
+
+// Decodes header from its 24 byte form
+func (h *Header) UnmarshalBinary(buf []byte) error {
+	if len(buf) != HeaderSize {
+		return fmt.Errorf("%w: header is %v bytes", ErrMalformed, len(buf))
+	}
+	h.Magic = binary.BigEndian.Uint32(buf[0:4])
+	command := buf[4 : 4+commandSize]
+	if i := bytes.IndexByte(command, 0); i >= 0 {
+		// Padding must be zeros only
+		if bytes.ContainsFunc(command[i:], func(r rune) bool { return r != 0 }) {
+			return fmt.Errorf("%w: command is not zero padded", ErrMalformed)
+		}
+		command = command[:i]
+	}
+	h.Command = string(command)
+	h.Length = binary.BigEndian.Uint32(buf[16:20])
+	copy(h.Checksum[:], buf[20:24])
+	return nil
+}
+
+// Writes message with header to w
+func WriteMessage(w io.Writer, msg Message) error {
+	payload := msg.appendPayload(nil)
+	if len(payload) > MaxPayloadSize {
+		return ErrPayloadTooLarge
+	}
+
+	header, err := Header{
+		Magic:    Magic,
+		Command:  msg.Command(),
+		Length:   uint32(len(payload)),
+		Checksum: Checksum(payload),
+	}.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(append(header, payload...)); err != nil {
+		return fmt.Errorf("Failed to write %v message: %w", msg.Command(), err)
+	}
+	return nil
+}
+
+// Reads next message from r.
+// Messages with unknown commands are skipped whole and reported with ErrUnknownCommand,
+// so the stream can still be read after them.
+func ReadMessage(r io.Reader) (Message, error) {
+	buf := make([]byte, HeaderSize)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+
+	var header Header
+	if err := header.UnmarshalBinary(buf); err != nil {
+		return nil, err
+	}
+	if header.Magic != Magic {
+		return nil, ErrBadMagic
+	}
+	if header.Length > MaxPayloadSize {
+		return nil, ErrPayloadTooLarge
+	}
+
+	payload := make([]byte, header.Length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	if Checksum(payload) != header.Checksum {
+		return nil, ErrBadChecksum
+	}
+
+	msg, err := newMessage(header.Command)
+	if err != nil {
+		return nil, err
+	}
+	if err := msg.decodePayload(&decoder{buf: payload}); err != nil {
+		return nil, fmt.Errorf("Failed to decode %v message: %w", header.Command, err)
+	}
+	return msg, nil
+}
@@ -0,0 +1,127 @@
+package wire
+
+import (
+	"GoChain/block"
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// Messages of every command used in round trip tests and as fuzz seeds
+var testMessages = []Message{
+	&Ping{Nonce: 42},
+	&Pong{Nonce: 42},
+	&Inv{Hashes: []string{"0000abc", "0000def"}},
+	&Inv{Hashes: []string{"0000abc"}, TTL: 5, TraceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+	&GetData{Hashes: []string{"0000abc"}},
+	&GetData{Hashes: []string{"0000abc"}, TTL: 5, TraceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+	&BlockMessage{Block: block.Block{Index: 1, Time: "2025-01-01T12:00:00Z", Data: "data", PrevHash: "0000abc", Hash: "0000def", Nonce: 7}},
+	&BlockMessage{Block: block.Block{Index: 1, Hash: "0000def"}, TTL: 5, TraceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+	&Addr{Addresses: []NetAddress{{Address: "node1:8001", NodeID: "id1"}}},
+	&Addr{Addresses: []NetAddress{{Address: "node1:8001", NodeID: "id1"}}, TTL: 5},
+	&Challenge{Nonce: "4bf92f3577b34da6a3ce929d0e0e4736"},
+	&Auth{Signature: "00f067aa0ba902b7"},
+}
+
+// Writes and reads every message, checking that it survives the round trip
+func TestRoundTrip(t *testing.T) {
+	for _, msg := range testMessages {
+		var buf bytes.Buffer
+		if err := WriteMessage(&buf, msg); err != nil {
+			t.Fatalf("WriteMessage(%v) returned an error: %v", msg.Command(), err)
+		}
+
+		got, err := ReadMessage(&buf)
+		if err != nil || !reflect.DeepEqual(got, msg) {
+			t.Errorf("ReadMessage() = %+v, %v, want %+v", got, err, msg)
+		}
+	}
+}
+
+// Calls Header.MarshalBinary, checking the header layout
+func TestHeaderLayout(t *testing.T) {
+	buf, _ := Header{Magic: Magic, Command: "inv", Length: 5, Checksum: [4]byte{1, 2, 3, 4}}.MarshalBinary()
+
+	want := []byte{'G', 'O', 'C', 'H', 'i', 'n', 'v', 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 5, 1, 2, 3, 4}
+	if !bytes.Equal(buf, want) {
+		t.Errorf("MarshalBinary() = %v, want %v", buf, want)
+	}
+}
+
+// Corrupts written messages, checking that ReadMessage reports each corruption
+func TestReadMessageErrors(t *testing.T) {
+	var valid bytes.Buffer
+	WriteMessage(&valid, &Ping{Nonce: 1})
+
+	corrupt := func(f func(b []byte)) []byte {
+		b := bytes.Clone(valid.Bytes())
+		f(b)
+		return b
+	}
+
+	tests := []struct {
+		name  string
+		input []byte
+		want  error
+	}{
+		{"magic", corrupt(func(b []byte) { b[0] = 'X' }), ErrBadMagic},
+		{"checksum", corrupt(func(b []byte) { b[HeaderSize] ^= 1 }), ErrBadChecksum},
+		{"length", corrupt(func(b []byte) { b[16] = 0xff }), ErrPayloadTooLarge},
+		{"command", corrupt(func(b []byte) { copy(b[4:16], "nope") }), ErrUnknownCommand},
+	}
+
+	for _, test := range tests {
+		if _, err := ReadMessage(bytes.NewReader(test.input)); !errors.Is(err, test.want) {
+			t.Errorf("ReadMessage() with bad %v = %v, want %v", test.name, err, test.want)
+		}
+	}
+}
+
+// Reads inv message claiming more hashes than it has, checking that it is rejected
+func TestReadMessageMalformedPayload(t *testing.T) {
+	var buf bytes.Buffer
+	payload := []byte{0xff, 0xff, 0x03}
+	header, _ := Header{Magic: Magic, Command: CmdInv, Length: uint32(len(payload)), Checksum: Checksum(payload)}.MarshalBinary()
+	buf.Write(header)
+	buf.Write(payload)
+
+	if _, err := ReadMessage(&buf); !errors.Is(err, ErrMalformed) {
+		t.Errorf("ReadMessage() = %v, want ErrMalformed", err)
+	}
+}
+
+// Reads inv message with TTL over MaxTTL, checking that it is rejected
+func TestReadMessageTTLTooLarge(t *testing.T) {
+	var buf bytes.Buffer
+	WriteMessage(&buf, &Inv{Hashes: []string{"0000abc"}, TTL: MaxTTL + 1})
+
+	if _, err := ReadMessage(&buf); !errors.Is(err, ErrMalformed) {
+		t.Errorf("ReadMessage() = %v, want ErrMalformed", err)
+	}
+}
+
+// Reads arbitrary input, checking that decoding never panics and decoded messages encode back the same
+func FuzzReadMessage(f *testing.F) {
+	for _, msg := range testMessages {
+		var buf bytes.Buffer
+		WriteMessage(&buf, msg)
+		f.Add(buf.Bytes())
+	}
+
+	f.Fuzz(func(t *testing.T, input []byte) {
+		msg, err := ReadMessage(bytes.NewReader(input))
+		if err != nil {
+			return
+		}
+
+		var buf bytes.Buffer
+		if err := WriteMessage(&buf, msg); err != nil {
+			t.Fatalf("WriteMessage() returned an error for decoded message: %v", err)
+		}
+		again, err := ReadMessage(&buf)
+		if err != nil || !reflect.DeepEqual(again, msg) {
+			t.Fatalf("Round trip changed %+v to %+v, %v", msg, again, err)
+		}
+	})
+}